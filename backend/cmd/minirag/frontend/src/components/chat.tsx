@@ -1,6 +1,6 @@
 import { Bot, User } from 'lucide-react';
 import { useEffect, useRef, useState } from 'react';
-import { ChatResponse } from '../lib/types';
+import { ChatResponse, Source } from '../lib/types';
 import { MemoizedMarkdown } from './MemoizedMarkdown';
 
 interface Message {
@@ -20,6 +20,7 @@ export function Chat() {
   const chatContainerRef = useRef<HTMLDivElement>(null);
   const [autoScroll, setAutoScroll] = useState(true);
   const abortControllerRef = useRef<AbortController | null>(null);
+  const conversationIdRef = useRef<string | null>(null);
 
   // Scroll to bottom only if autoScroll is enabled
   useEffect(() => {
@@ -80,6 +81,7 @@ export function Chat() {
           query: userMessage,
           temperature: 0.7,
           max_tokens: 1000,
+          conversation_id: conversationIdRef.current ?? undefined,
         }),
         signal: abortController.signal,
       });
@@ -119,7 +121,12 @@ export function Chat() {
                     };
                     return updated;
                   });
+                } else if (parsed.type === 'error') {
+                  setError(parsed.error);
                 } else if (parsed.type === 'meta' && parsed.meta) {
+                  if (parsed.meta.conversation_id) {
+                    conversationIdRef.current = parsed.meta.conversation_id;
+                  }
                   setMessages(prev => {
                     const updated = [...prev];
                     updated[updated.length - 1] = {
@@ -275,11 +282,21 @@ function SourceCollapse({
   similarity,
   id,
 }: {
-  source: { id: string; content: string };
+  source: Source;
   similarity: number;
   id: string;
 }) {
   const [open, setOpen] = useState(false);
+  const location = [
+    source.title ?? '',
+    source.path ?? source.id,
+    source.page ? `p. ${source.page}` : '',
+    source.slide ? `slide ${source.slide}` : '',
+    source.sheet ? `sheet ${source.sheet}` : '',
+    source.heading ?? '',
+  ]
+    .filter(Boolean)
+    .join(' · ');
 
   return (
     <div className="text-xs bg-muted rounded-lg mb-2">
@@ -288,7 +305,7 @@ function SourceCollapse({
         onClick={() => setOpen((v) => !v)}
         type="button"
       >
-        <span className="truncate">{source.id}</span>
+        <span className="truncate" title={source.id}>{location}</span>
         <span className="ml-2 text-muted-foreground">{(similarity * 100).toFixed(1)}%</span>
         <span className="ml-2">{open ? '▲' : '▼'}</span>
       </button>
@@ -1,13 +1,40 @@
+export interface RetrievalFilter {
+  path_prefix?: string;
+  extensions?: string[];
+  modified_after?: string;
+  modified_before?: string;
+  files?: string[];
+}
+
 export interface ChatRequest {
   query: string;
   temperature?: number;
   max_tokens?: number;
+  mode?: 'vector' | 'lexical' | 'hybrid';
+  workspace?: string;
+  filter?: RetrievalFilter;
+  conversation_id?: string;
+  messages?: { role: 'user' | 'assistant'; content: string }[];
 }
 
 export interface Source {
   id: string;
   content: string;
   similarity: number;
+  score?: number;
+  path?: string;
+  file_type?: string;
+  page?: number;
+  slide?: number;
+  sheet?: number;
+  heading?: string;
+  title?: string;
+  author?: string;
+  created?: string;
+  updated?: string;
+  char_start: number;
+  char_end: number;
+  modified?: string;
 }
 
 export interface ChatResponse {
@@ -15,4 +42,39 @@ export interface ChatResponse {
   sources: Source[];
   model: string;
   processing_time_ms: number;
-} 
\ No newline at end of file
+}
+
+export interface IndexStatus {
+  running: boolean;
+  started_at?: string;
+  finished_at?: string;
+  files_discovered: number;
+  files_done: number;
+  files_failed: number;
+  files_removed: number;
+  chunks: number;
+  eta_seconds?: number;
+  error?: string;
+}
+
+export interface IndexEvent {
+  type: 'status' | 'started' | 'indexed' | 'unchanged' | 'failed' | 'removed' | 'finished';
+  time: string;
+  path?: string;
+  chunks?: number;
+  error?: string;
+  status: IndexStatus;
+}
+
+export interface WorkspaceInfo {
+  name: string;
+  default: boolean;
+  dirs: string[];
+  chunker: string;
+  embed_model: string;
+  files: number;
+  chunks: number;
+  failed: number;
+  indexing: boolean;
+  rebuilding: boolean;
+}
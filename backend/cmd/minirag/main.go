@@ -20,17 +20,10 @@ import (
 var frontendFS embed.FS
 
 func main() {
-	cfg := &config.Config{}
-
-	flag.StringVar(&cfg.DocsDir, "docs", "./docs", "Directory containing documents to index")
-	flag.StringVar(&cfg.DataDir, "data", "", "Directory for storing index and metadata")
-	flag.StringVar(&cfg.OllamaURL, "ollama-url", "http://127.0.0.1:11434", "Ollama API URL")
-	flag.StringVar(&cfg.OllamaModel, "ollama-model", "gemma3:12b", "Ollama model name for chat")
-	flag.StringVar(&cfg.OllamaEmbedModel, "ollama-embed-model", "nomic-embed-text:latest", "Ollama model name for embeddings")
-	httpAddr := flag.String("http", ":7492", "HTTP listen address (e.g. ':7492' or '0.0.0.0:7492')")
-	flag.BoolVar(&cfg.DevMode, "dev", false, "Run in development mode")
-	flag.BoolVar(&cfg.ForceReindex, "force-reindex", false, "Force reindexing of all documents, ignoring saved state")
-	flag.Parse()
+	cfg, err := config.Parse(flag.CommandLine, os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
 
 	// If DataDir is not set, use ~/.minirag
 	if cfg.DataDir == "" {
@@ -53,6 +46,9 @@ func main() {
 	// Initialize metadata file path
 	cfg.MetadataFile = filepath.Join(cfg.DataDir, "metadata.json")
 	cfg.DBFile = filepath.Join(cfg.DataDir, "vectordb.gob")
+	cfg.LexicalFile = filepath.Join(cfg.DataDir, "lexical.gob")
+	cfg.SessionsDir = filepath.Join(cfg.DataDir, "sessions")
+	cfg.EmbedCacheFile = filepath.Join(cfg.DataDir, "embeddings.gob")
 
 	// Create a new mux
 	mux := http.NewServeMux()
@@ -69,7 +65,7 @@ func main() {
 			proxy.ServeHTTP(w, r)
 		})
 
-		log.Printf("Development server starting on %s...", *httpAddr)
+		log.Printf("Development server starting on %s...", cfg.HTTPAddr)
 		log.Printf("Proxying requests to Vite dev server at http://localhost:5173")
 	} else {
 		// Production mode - serve embedded frontend files
@@ -81,7 +77,7 @@ func main() {
 		frontendHandler := http.FileServer(http.FS(frontend))
 		mux.Handle("/", frontendHandler)
 
-		log.Printf("Production server starting on %s...", *httpAddr)
+		log.Printf("Production server starting on %s...", cfg.HTTPAddr)
 	}
 
 	// Create and run application
@@ -92,7 +88,7 @@ func main() {
 
 	log.Printf("Starting application...")
 
-	if err := app.Run(mux, *httpAddr); err != nil {
+	if err := app.Run(mux, cfg.HTTPAddr); err != nil {
 		log.Fatalf("Application error: %v", err)
 	}
 }
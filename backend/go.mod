@@ -7,4 +7,4 @@ require (
 	github.com/philippgille/chromem-go v0.7.0
 )
 
-require github.com/nguyenthenguyen/docx v0.0.0-20230621112118-9c8e795a11db
+require golang.org/x/net v0.35.0
@@ -1,13 +1,18 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"bytes"
@@ -18,98 +23,213 @@ import (
 )
 
 type App struct {
-	cfg           *config.Config
-	db            *chromem.DB
-	metadata      *Metadata
-	embeddingFunc chromem.EmbeddingFunc
+	cfg        *config.Config
+	db         *chromem.DB
+	embedCache *embeddingCache
+	llm        ChatProvider
+	sessions   *sessionStore
+	// The first one is the default
+	workspaces []*workspace
 }
 
 type Metadata struct {
 	Files    map[string]FileInfo `json:"files"`
 	DataPath string              `json:"data_path"`
+	// Settings the index was built with, a mismatch requires a rebuild
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	EmbedModel    string `json:"embed_model,omitempty"`
+	EmbedDim      int    `json:"embed_dim,omitempty"`
+	Chunker       string `json:"chunker,omitempty"`
+	// Files that could not be extracted, retried once they change
+	Failed map[string]FailedFile `json:"failed,omitempty"`
 }
 
+// Version of the index format, bumped when stored chunks or metadata change
+// in a way older indexes can't be used with
+const metadataSchemaVersion = 2
+
 type FileInfo struct {
 	Path         string    `json:"path"`
 	LastModified time.Time `json:"last_modified"`
 	Size         int64     `json:"size"`
+	Chunks       int       `json:"chunks"`
+	Hash         string    `json:"hash,omitempty"`      // SHA-256 of the contents
+	Extractor    int       `json:"extractor,omitempty"` // version of the extractor
+}
+
+// FailedFile records why a file was skipped during indexing
+type FailedFile struct {
+	Path         string    `json:"path"`
+	Error        string    `json:"error"`
+	FailedAt     time.Time `json:"failed_at"`
+	LastModified time.Time `json:"last_modified"`
+	Size         int64     `json:"size"`
+	Hash         string    `json:"hash,omitempty"`
+	Extractor    int       `json:"extractor,omitempty"`
 }
 
 func NewApp(cfg *config.Config) (*App, error) {
 	app := &App{
-		cfg:      cfg,
-		metadata: &Metadata{Files: make(map[string]FileInfo)},
+		cfg: cfg,
+	}
+
+	// Embeddings of all workspaces share one on-disk cache
+	embedCache, err := newEmbeddingCache(cfg.EmbedCacheFile)
+	if err != nil {
+		return nil, err
+	}
+	app.embedCache = embedCache
+
+	// Initialize chat provider
+	llm, err := NewChatProvider(cfg)
+	if err != nil {
+		return nil, err
 	}
+	app.llm = llm
 
-	// Initialize embedding function
-	ollamaEmbeddingURL := cfg.OllamaURL + "/api"
-	app.embeddingFunc = chromem.NewEmbeddingFuncOllama(cfg.OllamaEmbedModel, ollamaEmbeddingURL)
+	// Load stored chat sessions
+	sessions, err := newSessionStore(cfg.SessionsDir)
+	if err != nil {
+		return nil, err
+	}
+	app.sessions = sessions
+
+	// Validate default retrieval mode
+	if _, err := app.retrievalMode(""); err != nil {
+		return nil, err
+	}
 
 	// Initialize vector database
 	app.db = chromem.NewDB()
 
+	// Set up the workspaces, each in a collection of its own
+	workspaces := cfg.Workspaces
+	if len(workspaces) == 0 {
+		workspaces = []config.Workspace{{Name: defaultWorkspaceName, Dirs: []string{cfg.DocsDir}}}
+	}
+	names := make(map[string]bool)
+	for _, wc := range workspaces {
+		if err := checkWorkspaceName(wc.Name); err != nil {
+			return nil, err
+		}
+		if names[wc.Name] {
+			return nil, fmt.Errorf("duplicate workspace %s", wc.Name)
+		}
+		names[wc.Name] = true
+		ws, err := newWorkspace(cfg, wc, app.db, embedCache)
+		if err != nil {
+			return nil, err
+		}
+		app.workspaces = append(app.workspaces, ws)
+	}
+
 	return app, nil
 }
 
 func (a *App) Run(mux *http.ServeMux, addr string) error {
-	// Ensure Ollama and models are available
-	if err := ensureOllamaAndModels(a.cfg); err != nil {
-		return fmt.Errorf("ollama model check failed: %w", err)
+	// Stop indexing and the server cleanly on Ctrl+C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Restore the saved indexes
+	for _, ws := range a.workspaces {
+		if err := ws.load(ctx); err != nil {
+			return fmt.Errorf("workspace %s: %w", ws.name, err)
+		}
 	}
 
-	// Load metadata first
-	_ = a.loadMetadata() // ignore error, may not exist
+	// Start HTTP server
+	mux.HandleFunc("/query", a.handleQuery)
+	mux.HandleFunc("/chat", a.handleChat)
+	mux.HandleFunc("/v1/chat/completions", a.handleOpenAIChatCompletions)
+	mux.HandleFunc("/v1/models", a.handleOpenAIModels)
+	mux.HandleFunc("/sessions", a.handleSessions)
+	mux.HandleFunc("/sessions/", a.handleSession)
+	mux.HandleFunc("/index/status", a.handleIndexStatus)
+	mux.HandleFunc("/index/events", a.handleIndexEvents)
+	mux.HandleFunc("/index/errors", a.handleIndexErrors)
+	mux.HandleFunc("/workspaces", a.handleWorkspaces)
+	mux.HandleFunc("/debug/db", a.handleDebugDB)
 
-	// Invalidate metadata if data dir changed
-	absDataDir, err := filepath.Abs(a.cfg.DataDir)
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute data dir: %w", err)
-	}
-	needInvalidate := a.metadata.DataPath != "" && a.metadata.DataPath != absDataDir
-	if needInvalidate {
-		log.Printf("Data directory changed from %s to %s, invalidating metadata and index...", a.metadata.DataPath, absDataDir)
-		a.metadata.Files = make(map[string]FileInfo)
-		a.metadata.DataPath = absDataDir
-		_ = os.Remove(a.cfg.MetadataFile)
-		_ = os.Remove(a.cfg.DBFile)
-		a.db.DeleteCollection("docs")
-		log.Printf("Deleted metadata and DB files")
-		// Save the new (empty) metadata with updated DataPath
-		if err := a.saveMetadata(); err != nil {
-			return fmt.Errorf("failed to save new metadata: %w", err)
-		}
+		return err
 	}
+	log.Printf("Server is running on http://%s", trimHostPrefix(addr))
 
-	// Load existing DB if it exists
-	if _, err := os.Stat(a.cfg.DBFile); err == nil {
-		log.Printf("Found existing DB file, loading...")
-		if err := a.loadDB(); err != nil {
-			return fmt.Errorf("failed to load vector database: %w", err)
+	// Check the models and index in the background so that the UI is
+	// reachable right away. Queries are answered from whatever is indexed
+	// so far; a failure here stops the server.
+	indexErr := make(chan error, 1)
+	go func() {
+		if err := a.startIndexing(ctx); err != nil && ctx.Err() == nil {
+			indexErr <- err
+			stop()
 		}
+	}()
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	select {
+	case err := <-indexErr:
+		return err
+	default:
+		return nil
+	}
+}
 
-		log.Printf("Successfully restored collection with %d documents", len(a.metadata.Files))
-	} else {
-		log.Printf("No existing DB file found, starting fresh")
-		// Create initial collection if no DB exists
-		_, err = a.db.CreateCollection("docs", map[string]string{}, a.embeddingFunc)
-		if err != nil {
-			return fmt.Errorf("failed to create initial collection: %w", err)
-		}
+// startIndexing makes sure the models are available, runs the initial
+// indexing pass and then starts the watcher if enabled
+func (a *App) startIndexing(ctx context.Context) error {
+	// Ensure the chat backend and models are available
+	if err := a.llm.EnsureReady(ctx); err != nil {
+		return fmt.Errorf("chat model check failed: %w", err)
 	}
 
-	// Index documents
-	if err := a.indexDocuments(); err != nil {
-		return fmt.Errorf("failed to index documents: %w", err)
+	var embedModels []string
+	seenModels := make(map[string]bool)
+	for _, ws := range a.workspaces {
+		if model := ws.embedder.Model(); ws.embedProvider == ProviderOllama && !seenModels[model] {
+			seenModels[model] = true
+			embedModels = append(embedModels, model)
+		}
+	}
+	if len(embedModels) > 0 {
+		if err := ensureOllamaModels(a.cfg.OllamaURL, embedModels...); err != nil {
+			return fmt.Errorf("ollama model check failed: %w", err)
+		}
 	}
 
-	// Start HTTP server
-	mux.HandleFunc("/query", a.handleQuery)
-	mux.HandleFunc("/chat", a.handleChat)
-	mux.HandleFunc("/debug/db", a.handleDebugDB)
+	// Index the workspaces one after another
+	for _, ws := range a.workspaces {
+		if err := ws.indexDocuments(ctx); err != nil {
+			return fmt.Errorf("failed to index workspace %s: %w", ws.name, err)
+		}
+		ws.initialIndexDone.Store(true)
 
-	log.Printf("Documents indexed: %d", len(a.metadata.Files))
-	log.Printf("Server is running on http://%s", trimHostPrefix(addr))
-	return http.ListenAndServe(addr, mux)
+		ws.mu.RLock()
+		log.Printf("Documents indexed in workspace %s: %d", ws.name, len(ws.metadata.Files))
+		ws.mu.RUnlock()
+	}
+
+	// Keep the indexes in sync with the directories while serving
+	if a.cfg.Watch {
+		for _, ws := range a.workspaces {
+			if err := ws.startWatcher(ctx); err != nil {
+				return fmt.Errorf("failed to start watcher: %w", err)
+			}
+		}
+	}
+	return nil
 }
 
 // Helper to print address nicely in logs
@@ -130,7 +250,10 @@ func (a *App) handleQuery(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Query string `json:"query"`
+		Query     string           `json:"query"`
+		Workspace string           `json:"workspace,omitempty"`
+		Mode      string           `json:"mode,omitempty"`
+		Filter    *RetrievalFilter `json:"filter,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -138,63 +261,45 @@ func (a *App) handleQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Query: %s", req.Query)
-	// Get relevant documents
-	coll := a.db.GetCollection("docs", a.embeddingFunc)
-
-	results, err := coll.Query(r.Context(), req.Query, 5, nil, nil)
+	ws, err := a.workspaceFor(req.Workspace)
 	if err != nil {
-		log.Printf("Query failed: %v", err)
-		http.Error(w, "Query failed", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
-}
-
-func (a *App) loadMetadata() error {
-	f, err := os.Open(a.cfg.MetadataFile)
-	if os.IsNotExist(err) {
-		return nil
-	} else if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	return json.NewDecoder(f).Decode(&a.metadata)
-}
-
-func (a *App) saveMetadata() error {
-	f, err := os.Create(a.cfg.MetadataFile)
+	mode, err := a.retrievalMode(req.Mode)
 	if err != nil {
-		return err
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	defer f.Close()
-
-	return json.NewEncoder(f).Encode(a.metadata)
-}
-
-func (a *App) loadDB() error {
-	log.Printf("Loading vector database from: %s", a.cfg.DBFile)
-	err := a.db.ImportFromFile(a.cfg.DBFile, "", "docs")
+	if err := ws.checkRetrievalMode(mode); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	filter, err := compileFilter(req.Filter)
 	if err != nil {
-		return fmt.Errorf("failed to import DB: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Проверяем состояние после загрузки
-	coll := a.db.GetCollection("docs", a.embeddingFunc)
-	if coll == nil {
-		log.Printf("Warning: Collection 'docs' not found after DB load")
-	} else {
-		log.Printf("Successfully loaded vector database and found 'docs' collection")
-	}
+	log.Printf("Query (%s, %s): %s", ws.name, mode, req.Query)
+	// Get relevant documents, answering from whatever is indexed so far
+	// while indexing runs
+	indexing := ws.indexingInProgress()
+	coll := ws.db.GetCollection(ws.name, ws.embeddingFunc)
 
-	return nil
-}
+	results, err := ws.retrieve(r.Context(), coll, req.Query, 5, mode, filter)
+	if errors.Is(err, errIndexRebuilding) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		log.Printf("Query failed: %v", err)
+		http.Error(w, "Query failed", http.StatusInternalServerError)
+		return
+	}
 
-func (a *App) saveDB() error {
-	return a.db.ExportToFile(a.cfg.DBFile, true, "", "docs")
+	w.Header().Set("X-Indexing-In-Progress", strconv.FormatBool(indexing))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
 }
 
 func (a *App) handleDebugDB(w http.ResponseWriter, r *http.Request) {
@@ -214,10 +319,22 @@ func (a *App) handleDebugDB(w http.ResponseWriter, r *http.Request) {
 		} `json:"config"`
 	}
 
+	ws, ok := a.workspaceParam(w, r)
+	if !ok {
+		return
+	}
+
+	ws.mu.RLock()
+	files := make(map[string]FileInfo, len(ws.metadata.Files))
+	for k, v := range ws.metadata.Files {
+		files[k] = v
+	}
+	ws.mu.RUnlock()
+
 	debugInfo := DebugInfo{
-		CollectionName: "docs",
-		DocumentCount:  len(a.metadata.Files),
-		Metadata:       a.metadata.Files,
+		CollectionName: ws.name,
+		DocumentCount:  len(files),
+		Metadata:       files,
 		Config: struct {
 			OllamaURL        string `json:"ollama_url"`
 			OllamaModel      string `json:"ollama_model"`
@@ -233,24 +350,23 @@ func (a *App) handleDebugDB(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(debugInfo)
 }
 
-func ensureOllamaAndModels(cfg *config.Config) error {
+func ensureOllamaModels(ollamaURL string, models ...string) error {
 	type ollamaPullRequest struct {
 		Name   string `json:"name"`
 		Stream bool   `json:"stream"`
 	}
 
 	// 1. Check if Ollama is running
-	resp, err := http.Get(cfg.OllamaURL + "/api/tags")
+	resp, err := http.Get(ollamaURL + "/api/tags")
 	if err != nil || resp.StatusCode != 200 {
-		return fmt.Errorf("ollama is not running or not reachable at %s", cfg.OllamaURL)
+		return fmt.Errorf("ollama is not running or not reachable at %s", ollamaURL)
 	}
 	defer resp.Body.Close()
 
-	// 2. Check if chat model exists
-	models := []string{cfg.OllamaModel, cfg.OllamaEmbedModel}
+	// 2. Check if models exist
 	for _, model := range models {
 		found := false
-		resp, err := http.Get(cfg.OllamaURL + "/api/tags")
+		resp, err := http.Get(ollamaURL + "/api/tags")
 		if err == nil && resp.StatusCode == 200 {
 			body, _ := io.ReadAll(resp.Body)
 			if bytes.Contains(body, []byte(model)) {
@@ -261,7 +377,7 @@ func ensureOllamaAndModels(cfg *config.Config) error {
 			log.Printf("Model %s not found, pulling...", model)
 			pullReq := ollamaPullRequest{Name: model, Stream: false}
 			b, _ := json.Marshal(pullReq)
-			pullResp, err := http.Post(cfg.OllamaURL+"/api/pull", "application/json", bytes.NewBuffer(b))
+			pullResp, err := http.Post(ollamaURL+"/api/pull", "application/json", bytes.NewBuffer(b))
 			if err != nil {
 				return fmt.Errorf("failed to pull model %s: %v", model, err)
 			}
@@ -0,0 +1,247 @@
+package app
+
+import (
+	"encoding/gob"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// lexicalIndex is an in-memory BM25 inverted index over chunk contents. It
+// is kept next to the vector collection and uses the same chunk IDs, so
+// exact identifiers, SKUs and names that embeddings blur can still be found.
+type lexicalIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]map[string]int // chunk ID -> term frequencies
+	lengths  map[string]int            // chunk ID -> number of terms
+	postings map[string]map[string]int // term -> chunk ID -> term frequency
+	totalLen int
+}
+
+type lexicalHit struct {
+	ID    string
+	Score float64
+}
+
+func newLexicalIndex() *lexicalIndex {
+	return &lexicalIndex{
+		docs:     make(map[string]map[string]int),
+		lengths:  make(map[string]int),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// Add indexes the content of a chunk, replacing a previous version
+func (l *lexicalIndex) Add(id, content string) {
+	terms := tokenize(content)
+	tf := make(map[string]int)
+	for _, t := range terms {
+		tf[t]++
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remove(id)
+	l.insert(id, tf, len(terms))
+}
+
+// Delete removes chunks from the index
+func (l *lexicalIndex) Delete(ids ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		l.remove(id)
+	}
+}
+
+// Reset removes all chunks from the index
+func (l *lexicalIndex) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.docs = make(map[string]map[string]int)
+	l.lengths = make(map[string]int)
+	l.postings = make(map[string]map[string]int)
+	l.totalLen = 0
+}
+
+// Count returns the number of indexed chunks
+func (l *lexicalIndex) Count() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.docs)
+}
+
+func (l *lexicalIndex) insert(id string, tf map[string]int, length int) {
+	l.docs[id] = tf
+	l.lengths[id] = length
+	l.totalLen += length
+	for t, n := range tf {
+		p := l.postings[t]
+		if p == nil {
+			p = make(map[string]int)
+			l.postings[t] = p
+		}
+		p[id] = n
+	}
+}
+
+func (l *lexicalIndex) remove(id string) {
+	tf, ok := l.docs[id]
+	if !ok {
+		return
+	}
+	for t := range tf {
+		delete(l.postings[t], id)
+		if len(l.postings[t]) == 0 {
+			delete(l.postings, t)
+		}
+	}
+	l.totalLen -= l.lengths[id]
+	delete(l.docs, id)
+	delete(l.lengths, id)
+}
+
+// Search returns up to n chunks ranked by BM25 score for the query
+func (l *lexicalIndex) Search(query string, n int) []lexicalHit {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.docs) == 0 || n <= 0 {
+		return nil
+	}
+
+	avgLen := float64(l.totalLen) / float64(len(l.docs))
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		p := l.postings[t]
+		if len(p) == 0 {
+			continue
+		}
+		df := float64(len(p))
+		idf := math.Log(1 + (float64(len(l.docs))-df+0.5)/(df+0.5))
+		for id, n := range p {
+			tf := float64(n)
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(l.lengths[id])/avgLen)
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+	}
+
+	hits := make([]lexicalHit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, lexicalHit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > n {
+		hits = hits[:n]
+	}
+	return hits
+}
+
+// Only the term frequencies are persisted, postings are rebuilt on load
+type lexicalSnapshot struct {
+	Docs    map[string]map[string]int
+	Lengths map[string]int
+}
+
+// SaveToFile writes the index to path
+func (l *lexicalIndex) SaveToFile(path string) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewEncoder(f).Encode(lexicalSnapshot{Docs: l.docs, Lengths: l.lengths})
+}
+
+// LoadFromFile replaces the index with the one stored at path
+func (l *lexicalIndex) LoadFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var snap lexicalSnapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.docs = make(map[string]map[string]int)
+	l.lengths = make(map[string]int)
+	l.postings = make(map[string]map[string]int)
+	l.totalLen = 0
+	for id, tf := range snap.Docs {
+		l.insert(id, tf, snap.Lengths[id])
+	}
+	return nil
+}
+
+// tokenize lowercases text and splits it into terms. Identifiers joined
+// by '-', '_', '.' or '/' such as "SKU-1042" produce both the whole
+// identifier and its parts. CJK characters are indexed one by one.
+func tokenize(text string) []string {
+	var terms []string
+	var word []rune
+	var parts []string
+	var part []rune
+
+	flushPart := func() {
+		if len(part) > 0 {
+			parts = append(parts, string(part))
+			part = part[:0]
+		}
+	}
+	flushWord := func() {
+		flushPart()
+		w := strings.Trim(string(word), "-_./")
+		if w != "" && len(parts) > 1 {
+			terms = append(terms, w)
+		}
+		terms = append(terms, parts...)
+		word = word[:0]
+		parts = parts[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			terms = append(terms, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+			part = append(part, r)
+		case (r == '-' || r == '_' || r == '.' || r == '/') && len(part) > 0:
+			word = append(word, r)
+			flushPart()
+		default:
+			flushWord()
+		}
+	}
+	flushWord()
+	return terms
+}
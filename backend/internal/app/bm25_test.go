@@ -0,0 +1,85 @@
+package app
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, World!", []string{"hello", "world"}},
+		{"SKU-1042", []string{"sku-1042", "sku", "1042"}},
+		{"Customer_ID", []string{"customer_id", "customer", "id"}},
+		{"docs/api/v2", []string{"docs/api/v2", "docs", "api", "v2"}},
+		{"version v1.2.", []string{"version", "v1.2", "v1", "2"}},
+		{"-flag", []string{"flag"}},
+		{"Привет, МИР", []string{"привет", "мир"}},
+		{"Café_au lait", []string{"café_au", "café", "au", "lait"}},
+		{"東京 tower", []string{"東", "京", "tower"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLexicalSearch(t *testing.T) {
+	l := newLexicalIndex()
+	l.Add("a", "The order for SKU-1042 shipped on Monday.")
+	l.Add("b", "Widgets and gadgets are listed in the catalog.")
+	l.Add("c", "SKU-2001 replaces the older widget.")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SKU-1042", []string{"a", "c"}},
+		{"sku 1042", []string{"a", "c"}},
+		{"widgets", []string{"b"}},
+		{"nothing here", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, h := range l.Search(tt.query, 10) {
+			got = append(got, h.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	// Replacing and deleting chunks updates the postings
+	l.Add("a", "Nothing to see")
+	l.Delete("c")
+	if hits := l.Search("SKU-1042", 10); len(hits) != 0 {
+		t.Errorf("Search after update = %v, want no hits", hits)
+	}
+	if n := l.Count(); n != 2 {
+		t.Errorf("Count() = %d, want 2", n)
+	}
+}
+
+func TestLexicalIndexSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lexical.gob")
+	l := newLexicalIndex()
+	l.Add("a", "alpha beta")
+	l.Add("b", "beta gamma")
+	if err := l.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newLexicalIndex()
+	if err := loaded.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Search("beta gamma", 10), l.Search("beta gamma", 10)) {
+		t.Errorf("loaded index ranks differently")
+	}
+}
@@ -0,0 +1,266 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// Compound File Binary (OLE2) containers hold the streams of legacy Office
+// files. See [MS-CFB].
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// Special sector numbers
+const (
+	cfbMaxRegSect = 0xFFFFFFFA
+	cfbEndOfChain = 0xFFFFFFFE
+	cfbNoStream   = 0xFFFFFFFF
+)
+
+// Directory entry types
+const (
+	cfbTypeStream = 2
+	cfbTypeRoot   = 5
+)
+
+// cfbFile is a compound file read fully into memory
+type cfbFile struct {
+	data       []byte
+	sectorSize int
+	miniSize   int
+	miniCutoff uint64
+	fat        []uint32
+	miniFAT    []uint32
+	dir        []cfbEntry
+	miniStream []byte
+}
+
+type cfbEntry struct {
+	name  string
+	typ   byte
+	left  uint32
+	right uint32
+	child uint32
+	start uint32
+	size  uint64
+}
+
+func openCFB(data []byte) (*cfbFile, error) {
+	if len(data) < 512 || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, fmt.Errorf("not an OLE2 compound file")
+	}
+	le := binary.LittleEndian
+	major := le.Uint16(data[0x1A:])
+	sectorShift := le.Uint16(data[0x1E:])
+	miniShift := le.Uint16(data[0x20:])
+	if (major != 3 || sectorShift != 9) && (major != 4 || sectorShift != 12) {
+		return nil, fmt.Errorf("unsupported compound file version %d with sector shift %d", major, sectorShift)
+	}
+	if miniShift != 6 {
+		return nil, fmt.Errorf("unsupported mini sector shift %d", miniShift)
+	}
+
+	f := &cfbFile{
+		data:       data,
+		sectorSize: 1 << sectorShift,
+		miniSize:   1 << miniShift,
+		miniCutoff: uint64(le.Uint32(data[0x38:])),
+	}
+	numFATSectors := le.Uint32(data[0x2C:])
+	firstDirSector := le.Uint32(data[0x30:])
+	firstMiniFATSector := le.Uint32(data[0x3C:])
+	numMiniFATSectors := le.Uint32(data[0x40:])
+	firstDIFATSector := le.Uint32(data[0x44:])
+
+	// The sectors holding the FAT are listed in the header, continued in
+	// a chain of DIFAT sectors
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if s := le.Uint32(data[0x4C+4*i:]); s <= cfbMaxRegSect {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	perSector := f.sectorSize / 4
+	for s, n := firstDIFATSector, 0; s <= cfbMaxRegSect; n++ {
+		if n > f.numSectors() {
+			return nil, fmt.Errorf("DIFAT chain loops")
+		}
+		sec, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector-1; i++ {
+			if e := le.Uint32(sec[4*i:]); e <= cfbMaxRegSect {
+				fatSectors = append(fatSectors, e)
+			}
+		}
+		s = le.Uint32(sec[4*(perSector-1):])
+	}
+	if uint32(len(fatSectors)) < numFATSectors {
+		return nil, fmt.Errorf("FAT is truncated")
+	}
+
+	for _, s := range fatSectors {
+		sec, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector; i++ {
+			f.fat = append(f.fat, le.Uint32(sec[4*i:]))
+		}
+	}
+
+	// Directory, whose size version 3 files don't record
+	dirData, err := f.readChain(firstDirSector, f.fat, f.sectorSize, nil, math.MaxUint64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	for off := 0; off+128 <= len(dirData); off += 128 {
+		f.dir = append(f.dir, parseCFBEntry(dirData[off:off+128], major))
+	}
+	if len(f.dir) == 0 || f.dir[0].typ != cfbTypeRoot {
+		return nil, fmt.Errorf("missing root directory entry")
+	}
+
+	// Small streams live in the mini stream, which is stored in the
+	// root entry's chain and allocated through the mini FAT
+	if firstMiniFATSector <= cfbMaxRegSect {
+		miniFATData, err := f.readChain(firstMiniFATSector, f.fat, f.sectorSize, nil, uint64(numMiniFATSectors)*uint64(f.sectorSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mini FAT: %w", err)
+		}
+		for i := 0; i+4 <= len(miniFATData); i += 4 {
+			f.miniFAT = append(f.miniFAT, le.Uint32(miniFATData[i:]))
+		}
+		root := f.dir[0]
+		f.miniStream, err = f.readChain(root.start, f.fat, f.sectorSize, nil, root.size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mini stream: %w", err)
+		}
+	}
+	return f, nil
+}
+
+func parseCFBEntry(b []byte, major uint16) cfbEntry {
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(b[0x40:]))/2 - 1 // without the terminating NUL
+	if nameLen < 0 || nameLen > 31 {
+		nameLen = 0
+	}
+	name := make([]uint16, nameLen)
+	for i := range name {
+		name[i] = le.Uint16(b[2*i:])
+	}
+	e := cfbEntry{
+		name:  string(utf16.Decode(name)),
+		typ:   b[0x42],
+		left:  le.Uint32(b[0x44:]),
+		right: le.Uint32(b[0x48:]),
+		child: le.Uint32(b[0x4C:]),
+		start: le.Uint32(b[0x74:]),
+		size:  le.Uint64(b[0x78:]),
+	}
+	if major == 3 {
+		// The high part may be garbage in version 3 files
+		e.size &= 0xFFFFFFFF
+	}
+	return e
+}
+
+func (f *cfbFile) numSectors() int {
+	return (len(f.data) - 512 + f.sectorSize - 1) / f.sectorSize
+}
+
+// Helper to get the contents of a regular sector. The last sector of a
+// file may be cut short, it is padded with zeros.
+func (f *cfbFile) sector(n uint32) ([]byte, error) {
+	if int(n) >= f.numSectors() {
+		return nil, fmt.Errorf("sector %d out of range", n)
+	}
+	start := 512 + int(n)*f.sectorSize
+	end := start + f.sectorSize
+	if end > len(f.data) {
+		sec := make([]byte, f.sectorSize)
+		copy(sec, f.data[start:])
+		return sec, nil
+	}
+	return f.data[start:end], nil
+}
+
+// readChain concatenates the sectors of a chain, either regular sectors or
+// mini sectors of the mini stream when stream is set. Reading stops after
+// limit bytes, the declared size of the stream, and a chain that comes
+// back to a sector it already visited is rejected.
+func (f *cfbFile) readChain(start uint32, fat []uint32, size int, stream []byte, limit uint64) ([]byte, error) {
+	var out []byte
+	visited := make(map[uint32]bool)
+	for s := start; s != cfbEndOfChain && uint64(len(out)) < limit; s = fat[s] {
+		if s > cfbMaxRegSect || int(s) >= len(fat) {
+			return nil, fmt.Errorf("invalid sector %d in chain", s)
+		}
+		if visited[s] {
+			return nil, fmt.Errorf("sector chain loops")
+		}
+		visited[s] = true
+		if stream != nil {
+			off := int(s) * size
+			if off+size > len(stream) {
+				return nil, fmt.Errorf("mini sector %d out of range", s)
+			}
+			out = append(out, stream[off:off+size]...)
+		} else {
+			sec, err := f.sector(s)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, sec...)
+		}
+	}
+	if uint64(len(out)) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// stream returns the contents of a stream stored directly below the root
+// storage. Names are compared case-insensitively, as in the format.
+func (f *cfbFile) stream(name string) ([]byte, error) {
+	e, ok := f.findChild(f.dir[0].child, name, 0)
+	if !ok || e.typ != cfbTypeStream {
+		return nil, fmt.Errorf("stream %s not found", name)
+	}
+
+	var data []byte
+	var err error
+	if e.size < f.miniCutoff {
+		data, err = f.readChain(e.start, f.miniFAT, f.miniSize, f.miniStream, e.size)
+	} else {
+		data, err = f.readChain(e.start, f.fat, f.sectorSize, nil, e.size)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream %s: %w", name, err)
+	}
+	if uint64(len(data)) < e.size {
+		return nil, fmt.Errorf("stream %s is truncated", name)
+	}
+	return data, nil
+}
+
+// Helper to search the tree of sibling entries starting at id for a name
+func (f *cfbFile) findChild(id uint32, name string, depth int) (cfbEntry, bool) {
+	if id == cfbNoStream || int(id) >= len(f.dir) || depth > len(f.dir) {
+		return cfbEntry{}, false
+	}
+	e := f.dir[id]
+	if strings.EqualFold(e.name, name) {
+		return e, true
+	}
+	if found, ok := f.findChild(e.left, name, depth+1); ok {
+		return found, true
+	}
+	return f.findChild(e.right, name, depth+1)
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+type testStream struct {
+	name string
+	data []byte
+}
+
+// buildCFB builds a version 3 compound file with up to three streams below
+// the root. Sector 0 holds the FAT, sector 1 the directory and the streams
+// follow in order from sector 2. There is no mini stream, every stream is
+// stored in regular sectors.
+func buildCFB(streams ...testStream) []byte {
+	le := binary.LittleEndian
+	const sectorSize = 512
+
+	fat := make([]uint32, sectorSize/4)
+	for i := range fat {
+		fat[i] = cfbNoStream
+	}
+	fat[0] = 0xFFFFFFFD // FAT sector
+	fat[1] = cfbEndOfChain
+
+	var body []byte
+	starts := make([]uint32, len(streams))
+	next := uint32(2)
+	for i, s := range streams {
+		n := (len(s.data) + sectorSize - 1) / sectorSize
+		starts[i] = next
+		for j := 0; j < n; j++ {
+			fat[next] = next + 1
+			next++
+		}
+		fat[next-1] = cfbEndOfChain
+		padded := make([]byte, n*sectorSize)
+		copy(padded, s.data)
+		body = append(body, padded...)
+	}
+
+	header := make([]byte, 512)
+	copy(header, cfbSignature)
+	le.PutUint16(header[0x18:], 0x3E)
+	le.PutUint16(header[0x1A:], 3)
+	le.PutUint16(header[0x1C:], 0xFFFE)
+	le.PutUint16(header[0x1E:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2C:], 1)             // FAT sectors
+	le.PutUint32(header[0x30:], 1)             // first directory sector
+	le.PutUint32(header[0x38:], 0)             // mini stream cutoff
+	le.PutUint32(header[0x3C:], cfbEndOfChain) // no mini FAT
+	le.PutUint32(header[0x44:], cfbEndOfChain) // no DIFAT sectors
+	for i := 0; i < 109; i++ {
+		le.PutUint32(header[0x4C+4*i:], cfbNoStream)
+	}
+	le.PutUint32(header[0x4C:], 0)
+
+	fatSector := make([]byte, sectorSize)
+	for i, e := range fat {
+		le.PutUint32(fatSector[4*i:], e)
+	}
+
+	dir := make([]byte, sectorSize)
+	entry := func(i int, name string, typ byte, right, child, start uint32, size int) {
+		b := dir[128*i:]
+		units := utf16.Encode([]rune(name))
+		for j, u := range units {
+			le.PutUint16(b[2*j:], u)
+		}
+		le.PutUint16(b[0x40:], uint16(2*len(units)+2))
+		b[0x42] = typ
+		le.PutUint32(b[0x44:], cfbNoStream)
+		le.PutUint32(b[0x48:], right)
+		le.PutUint32(b[0x4C:], child)
+		le.PutUint32(b[0x74:], start)
+		le.PutUint64(b[0x78:], uint64(size))
+	}
+	child := uint32(cfbNoStream)
+	if len(streams) > 0 {
+		child = 1
+	}
+	entry(0, "Root Entry", cfbTypeRoot, cfbNoStream, child, cfbEndOfChain, 0)
+	for i, s := range streams {
+		right := uint32(i + 2)
+		if i == len(streams)-1 {
+			right = cfbNoStream
+		}
+		entry(i+1, s.name, cfbTypeStream, right, cfbNoStream, starts[i], len(s.data))
+	}
+
+	out := append(header, fatSector...)
+	out = append(out, dir...)
+	return append(out, body...)
+}
+
+// Helper to change the FAT entry of a sector in a file from buildCFB
+func setFATEntry(data []byte, sector, next uint32) {
+	binary.LittleEndian.PutUint32(data[512+4*sector:], next)
+}
+
+func TestCFBStream(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 120) // three sectors
+	data := buildCFB(testStream{"Small", []byte("hello")}, testStream{"WordDocument", payload})
+
+	// Small is at sector 2 and the payload at sectors 3-5
+	tests := []struct {
+		name    string
+		corrupt func([]byte) []byte
+		stream  string
+		want    []byte
+		wantErr string
+	}{
+		{name: "stream", stream: "WordDocument", want: payload},
+		{name: "case-insensitive name", stream: "worddocument", want: payload},
+		{name: "single sector", stream: "Small", want: []byte("hello")},
+		{name: "missing stream", stream: "1Table", wantErr: "not found"},
+		{
+			name:    "cyclic chain",
+			corrupt: func(d []byte) []byte { setFATEntry(d, 4, 3); return d },
+			stream:  "WordDocument",
+			wantErr: "loops",
+		},
+		{
+			name:    "cycle past the stream size",
+			corrupt: func(d []byte) []byte { setFATEntry(d, 5, 3); return d },
+			stream:  "WordDocument",
+			want:    payload,
+		},
+		{
+			name:    "chain longer than the stream",
+			corrupt: func(d []byte) []byte { setFATEntry(d, 2, 3); return d },
+			stream:  "Small",
+			want:    []byte("hello"),
+		},
+		{
+			name:    "chain to itself",
+			corrupt: func(d []byte) []byte { setFATEntry(d, 4, 4); return d },
+			stream:  "WordDocument",
+			wantErr: "loops",
+		},
+		{
+			name:    "chain ends early",
+			corrupt: func(d []byte) []byte { setFATEntry(d, 4, cfbEndOfChain); return d },
+			stream:  "WordDocument",
+			wantErr: "truncated",
+		},
+		{
+			name:    "chain points past the FAT",
+			corrupt: func(d []byte) []byte { setFATEntry(d, 3, 1000); return d },
+			stream:  "WordDocument",
+			wantErr: "invalid sector",
+		},
+		{
+			name:    "free sector in chain",
+			corrupt: func(d []byte) []byte { setFATEntry(d, 3, cfbNoStream); return d },
+			stream:  "WordDocument",
+			wantErr: "invalid sector",
+		},
+		{
+			name:    "file cut short",
+			corrupt: func(d []byte) []byte { return d[:512+4*512] },
+			stream:  "WordDocument",
+			wantErr: "out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := bytes.Clone(data)
+			if tt.corrupt != nil {
+				d = tt.corrupt(d)
+			}
+			cf, err := openCFB(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := cf.stream(tt.stream)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("stream() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("stream() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenCFBErrors(t *testing.T) {
+	le := binary.LittleEndian
+	data := buildCFB(testStream{"WordDocument", []byte("text")})
+
+	tests := []struct {
+		name    string
+		corrupt func([]byte) []byte
+		wantErr string
+	}{
+		{"too short", func(d []byte) []byte { return d[:100] }, "not an OLE2"},
+		{"signature", func(d []byte) []byte { d[0] = 'P'; return d }, "not an OLE2"},
+		{"version", func(d []byte) []byte { le.PutUint16(d[0x1A:], 4); return d }, "unsupported compound file version"},
+		{"mini sector shift", func(d []byte) []byte { le.PutUint16(d[0x20:], 7); return d }, "unsupported mini sector shift"},
+		{"FAT truncated", func(d []byte) []byte { le.PutUint32(d[0x2C:], 2); return d }, "FAT is truncated"},
+		{"FAT sector out of range", func(d []byte) []byte { le.PutUint32(d[0x4C:], 50); return d }, "out of range"},
+		{"cyclic directory", func(d []byte) []byte { setFATEntry(d, 1, 1); return d }, "loops"},
+		{"DIFAT out of range", func(d []byte) []byte { le.PutUint32(d[0x44:], 50); return d }, "out of range"},
+		{"no root", func(d []byte) []byte { d[512*2+0x42] = cfbTypeStream; return d }, "missing root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := openCFB(tt.corrupt(bytes.Clone(data)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("openCFB() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
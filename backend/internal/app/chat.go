@@ -1,12 +1,12 @@
 package app
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"math"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -14,6 +14,17 @@ type ChatRequest struct {
 	Query       string  `json:"query"`
 	Temperature float64 `json:"temperature,omitempty"`
 	MaxTokens   int     `json:"max_tokens,omitempty"`
+	Mode        string  `json:"mode,omitempty"`
+	// Workspace to answer from, the default one when empty
+	Workspace string `json:"workspace,omitempty"`
+	// Filter restricts retrieval to some of the documents
+	Filter *RetrievalFilter `json:"filter,omitempty"`
+	// ConversationID continues a conversation kept on the server. A new
+	// one is started and returned in the meta event when it's empty.
+	ConversationID string `json:"conversation_id,omitempty"`
+	// Messages optionally supplies the previous turns explicitly instead
+	// of using the server-side history
+	Messages []Message `json:"messages,omitempty"`
 }
 
 type ChatResponse struct {
@@ -27,14 +38,28 @@ type Document struct {
 	ID         string  `json:"id"`
 	Content    string  `json:"content"`
 	Similarity float64 `json:"similarity"`
-}
+	Score      float64 `json:"score,omitempty"`
 
-type ollamaRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Temperature float64   `json:"temperature,omitempty"`
-	MaxTokens   int       `json:"num_predict,omitempty"`
-	Stream      bool      `json:"stream"`
+	// Where the chunk comes from. Offsets are in characters of the
+	// extracted text, page is set for PDFs, slide and sheet for
+	// presentations and spreadsheets, heading is the trail of enclosing
+	// headings separated by " > ". Title, author, created and updated
+	// come from the document's own properties, e.g. the <title> of an
+	// HTML page or the info dictionary of a PDF; modified is the time of
+	// the file.
+	Path      string `json:"path,omitempty"`
+	FileType  string `json:"file_type,omitempty"`
+	Page      int    `json:"page,omitempty"`
+	Slide     int    `json:"slide,omitempty"`
+	Sheet     int    `json:"sheet,omitempty"`
+	Heading   string `json:"heading,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Created   string `json:"created,omitempty"`
+	Updated   string `json:"updated,omitempty"`
+	CharStart int    `json:"char_start"`
+	CharEnd   int    `json:"char_end"`
+	Modified  string `json:"modified,omitempty"`
 }
 
 type Message struct {
@@ -57,6 +82,26 @@ func (a *App) handleChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ws, err := a.workspaceFor(req.Workspace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := a.retrievalMode(req.Mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ws.checkRetrievalMode(mode); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	filter, err := compileFilter(req.Filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Set defaults if not provided
 	if req.Temperature == 0 {
 		req.Temperature = 0.7
@@ -65,76 +110,32 @@ func (a *App) handleChat(w http.ResponseWriter, r *http.Request) {
 		req.MaxTokens = 10000
 	}
 
-	// Get relevant documents
-	coll := a.db.GetCollection("docs", a.embeddingFunc)
-
-	var context string
-	var sources []Document
-
-	maxResults := math.Min(10, float64(coll.Count()))
-	results, err := coll.Query(ctx, req.Query, int(maxResults), nil, nil)
-	if err != nil {
-		log.Printf("Query failed: %v", err)
-	} else {
-		for _, doc := range results {
-			context += fmt.Sprintf("\nDocument %s:\n%s\n", doc.ID, doc.Content)
-			sources = append(sources, Document{
-				ID:         doc.ID,
-				Content:    doc.Content,
-				Similarity: float64(doc.Similarity),
-			})
-		}
-	}
-
-	// Prepare prompt
-	prompt := fmt.Sprintf(`You are a helpful AI assistant. Your task is to provide detailed and informative answers based on the given context.
-
-Instructions:
-1. Read the context carefully
-2. Provide a complete, well-structured answer
-3. If the context doesn't contain enough information, acknowledge that and provide general guidance
-4. Always write full sentences and complete thoughts
-5. Use markdown formatting for better readability
-
-Context:
-%s
-
-User Question: %s
-
-Important: Provide a complete, detailed response. Never stop at single words or incomplete sentences.
-IMPORTANT: ANSWER IN LANGUAGE OF THE USER QUESTION.
-Response:`, context, req.Query)
-	// Call Ollama
-	ollamaReq := ollamaRequest{
-		Model:       a.cfg.OllamaModel,
-		Messages:    []Message{{Role: "user", Content: prompt}},
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		Stream:      true,
-	}
-
-	ollamaBody, err := json.Marshal(ollamaReq)
-	if err != nil {
-		log.Printf("Failed to create Ollama request: %v", err)
-		http.Error(w, "Failed to create Ollama request", http.StatusInternalServerError)
+	// Load previous turns of the conversation
+	if req.ConversationID == "" {
+		req.ConversationID = newConversationID()
+	} else if !sessionIDRe.MatchString(req.ConversationID) {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
 		return
 	}
-
-	ollamaHttpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.OllamaURL+"/api/chat", bytes.NewBuffer(ollamaBody))
+	history, err := clientHistory(req.Messages)
 	if err != nil {
-		log.Printf("Failed to create Ollama request: %v", err)
-		http.Error(w, "Failed to create Ollama request", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if len(history) == 0 {
+		history = a.sessions.History(req.ConversationID)
+	}
 
-	ollamaHttpReq.Header.Set("Content-Type", "application/json")
-	ollamaResp, err := http.DefaultClient.Do(ollamaHttpReq)
+	rag := a.prepareRAG(ctx, ws, req.Query, history, mode, filter)
+
+	// Call the model with the previous turns followed by the new question
+	stream, err := a.llm.StreamChat(ctx, rag.Messages, ChatOptions{Temperature: req.Temperature, MaxTokens: req.MaxTokens})
 	if err != nil {
-		log.Printf("Failed to call Ollama API: %v", err)
-		http.Error(w, "Failed to call Ollama API", http.StatusInternalServerError)
+		log.Printf("Failed to call chat model: %v", err)
+		http.Error(w, "Failed to call chat model", http.StatusInternalServerError)
 		return
 	}
-	defer ollamaResp.Body.Close()
+	defer stream.Close()
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -145,35 +146,64 @@ Response:`, context, req.Query)
 		return
 	}
 
-	type ollamaResponseChunk struct {
-		CreatedAt time.Time `json:"created_at"`
-		Done      bool      `json:"done"`
-		Message   Message   `json:"message"`
-		Model     string    `json:"model"`
-	}
 	// Begin streaming tokens
-	decoder := json.NewDecoder(ollamaResp.Body)
+	var answer strings.Builder
 	for {
-		var chunk ollamaResponseChunk
-		if err := decoder.Decode(&chunk); err != nil {
+		piece, ok := stream.Next()
+		if !ok {
 			break // done streaming
 		}
+		answer.WriteString(piece)
 		// send chunk (you can wrap in SSE-style JSON delta if needed)
 		fmt.Fprintf(w, "data: %s\n\n", encodeJSON(map[string]string{
-			"role":    chunk.Message.Role,
-			"content": chunk.Message.Content,
+			"role":    "assistant",
+			"content": piece,
 		}))
 		flusher.Flush()
 	}
 
+	// A broken stream leaves a truncated answer, which is reported instead
+	// of being kept as a turn of the conversation
+	if err := stream.Err(); err != nil {
+		log.Printf("Chat model stream failed: %v", err)
+		fmt.Fprintf(w, "data: %s\n\n", encodeJSON(map[string]interface{}{
+			"type":  "error",
+			"error": "The chat model stopped before the answer was complete",
+		}))
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+		return
+	}
+
 	// Calculate processing time
 	processingTimeMs := time.Since(startTime).Milliseconds()
 
+	// Store the turn for follow-up questions and later review
+	turn := SessionTurn{
+		Question:         req.Query,
+		SearchQuery:      rag.SearchQuery,
+		Workspace:        ws.name,
+		Answer:           answer.String(),
+		Sources:          rag.Sources,
+		Model:            a.llm.Model(),
+		CreatedAt:        startTime,
+		ProcessingTimeMs: processingTimeMs,
+	}
+	if err := a.sessions.AddTurn(req.ConversationID, turn); err != nil {
+		log.Printf("Failed to save session %s: %v", req.ConversationID, err)
+	}
+
 	// Send sources and metadata as a final event before [DONE]
 	meta := map[string]interface{}{
-		"sources":            sources,
-		"model":              a.cfg.OllamaModel,
+		"sources":            rag.Sources,
+		"context":            rag.Report,
+		"conversation_id":    req.ConversationID,
+		"search_query":       rag.SearchQuery,
+		"workspace":          ws.name,
+		"model":              a.llm.Model(),
 		"processing_time_ms": processingTimeMs,
+
+		"indexing_in_progress": rag.IndexingInProgress,
 	}
 	fmt.Fprintf(w, "data: %s\n\n", encodeJSON(map[string]interface{}{
 		"type": "meta",
@@ -186,6 +216,78 @@ Response:`, context, req.Query)
 	flusher.Flush()
 }
 
+// ragContext is the outcome of retrieval for one question
+type ragContext struct {
+	// Messages to send to the model: the history followed by the prompt
+	Messages    []Message
+	Sources     []Document
+	Report      ContextReport
+	SearchQuery string
+	// Set when the index was still being built, so sources may be missing
+	IndexingInProgress bool
+}
+
+// prepareRAG condenses a follow-up question, retrieves matching chunks from
+// the workspace, fits them into the context budget and builds the messages
+// for the model. Retrieval failures are logged and leave the context empty.
+func (a *App) prepareRAG(ctx context.Context, ws *workspace, query string, history []Message, mode string, filter *fileFilter) ragContext {
+	// Turn follow-up questions into standalone ones for retrieval
+	searchQuery, err := a.condenseQuery(ctx, history, query)
+	if err != nil {
+		log.Printf("Failed to condense follow-up question: %v", err)
+		searchQuery = query
+	} else if searchQuery != query {
+		log.Printf("Condensed follow-up question to: %s", searchQuery)
+	}
+
+	// Get relevant documents, answering from whatever is indexed so far
+	// while indexing runs
+	indexing := ws.indexingInProgress()
+	coll := ws.db.GetCollection(ws.name, ws.embeddingFunc)
+
+	ranked, err := ws.retrieve(ctx, coll, searchQuery, 10, mode, filter)
+	if err != nil {
+		log.Printf("Query failed: %v", err)
+	}
+
+	// Fit the best chunks into the context window
+	docContext, sources, report := assembleContext(ranked, a.cfg.ContextTokens)
+	if len(report.Truncated) > 0 || len(report.Dropped) > 0 {
+		log.Printf("Context budget of %d tokens exceeded: truncated %v, dropped %v", report.BudgetTokens, report.Truncated, report.Dropped)
+	}
+
+	messages := append(append([]Message(nil), history...), Message{Role: "user", Content: buildPrompt(docContext, query)})
+	return ragContext{
+		Messages:    messages,
+		Sources:     sources,
+		Report:      report,
+		SearchQuery: searchQuery,
+
+		IndexingInProgress: indexing,
+	}
+}
+
+// Helper to build the prompt with the retrieved context for a question
+func buildPrompt(context, query string) string {
+	return fmt.Sprintf(`You are a helpful AI assistant. Your task is to provide detailed and informative answers based on the given context.
+
+Instructions:
+1. Read the context carefully
+2. Provide a complete, well-structured answer
+3. If the context doesn't contain enough information, acknowledge that and provide general guidance
+4. Always write full sentences and complete thoughts
+5. Use markdown formatting for better readability
+
+Context:
+%s
+
+User Question: %s
+
+Important: Provide a complete, detailed response. Never stop at single words or incomplete sentences.
+IMPORTANT: ANSWER IN LANGUAGE OF THE USER QUESTION.
+Response:`, context, query)
+}
+
 func encodeJSON(v any) string {
 	b, _ := json.Marshal(v)
 	return string(b)
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// chatEvent is an event of the /chat stream
+type chatEvent struct {
+	Type    string         `json:"type"`
+	Role    string         `json:"role"`
+	Content string         `json:"content"`
+	Error   string         `json:"error"`
+	Meta    map[string]any `json:"meta"`
+}
+
+// Helper to decode the events of a /chat stream, which ends with [DONE]
+func chatEvents(t *testing.T, body string) []chatEvent {
+	t.Helper()
+	data := sseData(t, body)
+	if data[len(data)-1] != "[DONE]" {
+		t.Fatalf("stream doesn't end with [DONE]: %q", data)
+	}
+	events := make([]chatEvent, len(data)-1)
+	for i, d := range data[:len(data)-1] {
+		if err := json.Unmarshal([]byte(d), &events[i]); err != nil {
+			t.Fatalf("event %q: %v", d, err)
+		}
+	}
+	return events
+}
+
+func TestChat(t *testing.T) {
+	app, llm := newTestApp(t, testDocs)
+	llm.reply = replyWith("The zebra ", "lives in Africa.")
+
+	rec := serveTest(app.handleChat, http.MethodPost, "/chat", `{"query":"Where does the zebra live?"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	events := chatEvents(t, rec.Body.String())
+	if len(events) != 3 || events[0].Content != "The zebra " || events[1].Content != "lives in Africa." || events[0].Role != "assistant" {
+		t.Fatalf("events = %+v, want two pieces and the meta event", events)
+	}
+	meta := events[2].Meta
+	if events[2].Type != "meta" || meta["model"] != "fake-chat" || meta["workspace"] != defaultWorkspaceName {
+		t.Errorf("meta = %+v", meta)
+	}
+	if sources, _ := meta["sources"].([]any); len(sources) == 0 {
+		t.Errorf("meta without sources: %+v", meta)
+	}
+
+	// The turn is stored for follow-up questions
+	id, _ := meta["conversation_id"].(string)
+	sess, ok := app.sessions.Get(id)
+	if !ok || len(sess.Turns) != 1 || sess.Turns[0].Answer != "The zebra lives in Africa." {
+		t.Errorf("session %q = %+v, %v", id, sess, ok)
+	}
+}
+
+func TestChatStreamError(t *testing.T) {
+	app, llm := newTestApp(t, testDocs)
+	llm.reply = func([]Message) ([]string, error) {
+		return []string{"The zebra "}, errors.New("connection reset")
+	}
+
+	rec := serveTest(app.handleChat, http.MethodPost, "/chat", `{"query":"Where does the zebra live?","conversation_id":"broken"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	// The piece sent so far is followed by an error event instead of the
+	// meta event, and the truncated answer isn't stored
+	events := chatEvents(t, rec.Body.String())
+	if len(events) != 2 || events[0].Content != "The zebra " {
+		t.Fatalf("events = %+v, want the piece and the error", events)
+	}
+	if ev := events[1]; ev.Type != "error" || ev.Error == "" || strings.Contains(ev.Error, "connection reset") || ev.Meta != nil {
+		t.Errorf("error event = %+v, want a generic error", ev)
+	}
+	if _, ok := app.sessions.Get("broken"); ok {
+		t.Error("truncated answer stored in the session")
+	}
+}
+
+func TestChatErrors(t *testing.T) {
+	app, llm := newTestApp(t, testDocs)
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid JSON", http.MethodPost, `{"query":`, http.StatusBadRequest},
+		{"unknown workspace", http.MethodPost, `{"query":"Hi","workspace":"nope"}`, http.StatusBadRequest},
+		{"invalid conversation ID", http.MethodPost, `{"query":"Hi","conversation_id":"../x"}`, http.StatusBadRequest},
+		{"system message in the history", http.MethodPost, `{"query":"Hi","messages":[{"role":"system","content":"x"}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveTest(app.handleChat, tt.method, "/chat", tt.body); rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+
+	// A model that can't be reached fails before the stream starts
+	llm.start = errors.New("refused")
+	rec := serveTest(app.handleChat, http.MethodPost, "/chat", `{"query":"Hi"}`)
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Type") == "text/event-stream" {
+		t.Errorf("status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,385 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Chunker splits the extracted text of a document into pieces that are
+// embedded and retrieved separately. Sizes are measured in tokens as
+// approximated by estimateTokens, so that a chunk fits the embedding model
+// whatever the script. Text is only cut between runes, so multi-byte text
+// such as Cyrillic or CJK is never cut inside a character.
+type Chunker interface {
+	Chunk(text string) []Chunk
+}
+
+// Chunk is a piece of a document. Start and End are the rune offsets of the
+// part of the document it was cut from; text repeated from the previous
+// chunk or from the section heading is not included.
+type Chunk struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Available chunking strategies for the -chunker flag
+const (
+	ChunkerFixed     = "fixed"
+	ChunkerParagraph = "paragraph"
+	ChunkerMarkdown  = "markdown"
+)
+
+// NewChunker creates a chunker for the given strategy. Size is the target
+// chunk length in tokens, overlap is the number of tokens repeated from the
+// end of the previous chunk.
+func NewChunker(strategy string, size, overlap int) (Chunker, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", size)
+	}
+	if overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("chunk overlap must be between 0 and chunk size, got %d", overlap)
+	}
+
+	switch strategy {
+	case ChunkerFixed:
+		return &fixedChunker{size: size, overlap: overlap}, nil
+	case ChunkerParagraph:
+		return &paragraphChunker{size: size, overlap: overlap}, nil
+	case ChunkerMarkdown:
+		return &markdownChunker{size: size, overlap: overlap}, nil
+	default:
+		return nil, fmt.Errorf("unknown chunker %q (expected %s, %s or %s)", strategy, ChunkerFixed, ChunkerParagraph, ChunkerMarkdown)
+	}
+}
+
+// Helper to describe chunker settings, stored in metadata so that a change
+// triggers reindexing. Sizes used to be in characters, the unit keeps
+// indexes chunked that way from being taken as up to date.
+func chunkerSignature(strategy string, size, overlap int) string {
+	return fmt.Sprintf("%s:%d:%d:tokens", strategy, size, overlap)
+}
+
+// fixedChunker cuts text into windows of a fixed number of tokens, each
+// window starting overlap tokens before the end of the previous one
+type fixedChunker struct {
+	size    int
+	overlap int
+}
+
+func (c *fixedChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	runes := []rune(text)
+	own := 0
+	for start := 0; start < len(runes); {
+		end := prefixForTokens(runes[start:], c.size) + start
+		chunks = append(chunks, Chunk{Text: string(runes[start:end]), Start: own, End: end})
+		if end == len(runes) {
+			break
+		}
+		// The next window repeats the overlap but always moves on
+		next := end - suffixForTokens(runes[start:end], c.overlap)
+		if next <= start {
+			next = end
+		}
+		start, own = next, end
+	}
+	return chunks
+}
+
+// paragraphChunker packs whole paragraphs into chunks and only falls back to
+// line, sentence and word boundaries for paragraphs that don't fit
+type paragraphChunker struct {
+	size    int
+	overlap int
+}
+
+func (c *paragraphChunker) Chunk(text string) []Chunk {
+	loc := newSpanLocator(text)
+	return addOverlap(loc.locateAll(packText(text, c.size)), c.overlap)
+}
+
+// markdownChunker keeps Markdown heading sections together. Sections larger
+// than a chunk are split like paragraphs and every piece repeats the heading.
+type markdownChunker struct {
+	size    int
+	overlap int
+}
+
+func (c *markdownChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	loc := newSpanLocator(text)
+	for _, section := range splitMarkdownSections(text) {
+		if estimateTokens(section) <= c.size || !strings.HasPrefix(section, "#") {
+			chunks = append(chunks, addOverlap(loc.locateAll(packText(section, c.size)), c.overlap)...)
+			continue
+		}
+
+		heading, body, _ := strings.Cut(section, "\n")
+		size := c.size - estimateTokens(heading)
+		if size <= c.overlap {
+			size = c.size
+		}
+		loc.locate(heading)
+		for _, piece := range addOverlap(loc.locateAll(packText(body, size)), c.overlap) {
+			piece.Text = heading + "\n\n" + piece.Text
+			chunks = append(chunks, piece)
+		}
+	}
+	return chunks
+}
+
+var (
+	markdownHeadingRe = regexp.MustCompile(`^#{1,6}\s`)
+	paragraphBreakRe  = regexp.MustCompile(`\n[ \t]*\n`)
+)
+
+// Helper to split Markdown into sections, each starting with its heading.
+// Headings inside fenced code blocks are ignored.
+func splitMarkdownSections(text string) []string {
+	var sections []string
+	var cur []string
+	inFence := false
+
+	flush := func() {
+		if s := strings.TrimSpace(strings.Join(cur, "\n")); s != "" {
+			sections = append(sections, s)
+		}
+		cur = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if !inFence && markdownHeadingRe.MatchString(line) {
+			flush()
+		}
+		cur = append(cur, line)
+	}
+	flush()
+	return sections
+}
+
+// splitLevel is one kind of boundary text can be split at, together with
+// the separator used to glue the pieces back together
+type splitLevel struct {
+	split func(string) []string
+	sep   string
+}
+
+// Boundaries tried from coarsest to finest
+var splitLevels = []splitLevel{
+	{split: func(s string) []string { return paragraphBreakRe.Split(s, -1) }, sep: "\n\n"},
+	{split: func(s string) []string { return strings.Split(s, "\n") }, sep: "\n"},
+	{split: splitSentences, sep: " "},
+	{split: strings.Fields, sep: " "},
+}
+
+// packText splits text into chunks of at most size tokens, cutting at the
+// coarsest boundary that makes the pieces fit
+func packText(text string, size int) []string {
+	return packLevel(strings.TrimSpace(text), size, 0)
+}
+
+func packLevel(text string, size, level int) []string {
+	if text == "" {
+		return nil
+	}
+	if estimateTokens(text) <= size {
+		return []string{text}
+	}
+
+	for ; level < len(splitLevels); level++ {
+		parts := splitLevels[level].split(text)
+		if len(parts) < 2 {
+			continue
+		}
+
+		var pieces []string
+		for _, part := range parts {
+			pieces = append(pieces, packLevel(strings.TrimSpace(part), size, level+1)...)
+		}
+		return mergePieces(pieces, splitLevels[level].sep, size)
+	}
+
+	// A single word longer than a chunk
+	return splitTokens(text, size)
+}
+
+// Helper to greedily join consecutive pieces while they fit into size
+// tokens. Separators are whitespace, which adds no tokens.
+func mergePieces(pieces []string, sep string, size int) []string {
+	var chunks []string
+	var cur strings.Builder
+	curLen := 0
+	sepLen := estimateTokens(sep)
+
+	for _, p := range pieces {
+		pLen := estimateTokens(p)
+		if curLen > 0 && curLen+sepLen+pLen > size {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+			curLen = 0
+		}
+		if curLen > 0 {
+			cur.WriteString(sep)
+			curLen += sepLen
+		}
+		cur.WriteString(p)
+		curLen += pLen
+	}
+	if curLen > 0 {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks
+}
+
+// Helper to split text after sentence terminators that are followed by
+// whitespace. CJK full stops end a sentence without a following space.
+func splitSentences(text string) []string {
+	var sentences []string
+	runes := []rune(text)
+	start := 0
+	for i, r := range runes {
+		end := false
+		switch r {
+		case '.', '!', '?', '…':
+			end = i+1 < len(runes) && unicode.IsSpace(runes[i+1])
+		case '。', '！', '？':
+			end = true
+		}
+		if end {
+			sentences = append(sentences, string(runes[start:i+1]))
+			start = i + 1
+		}
+	}
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
+
+// Helper to split text into pieces of at most size tokens
+func splitTokens(text string, size int) []string {
+	var chunks []string
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		end := start + prefixForTokens(runes[start:], size)
+		chunks = append(chunks, string(runes[start:end]))
+		start = end
+	}
+	return chunks
+}
+
+// Helper to find the length of the longest prefix of runes that is at most
+// size tokens long, at least one rune so that splitting makes progress
+func prefixForTokens(runes []rune, size int) int {
+	lo, hi := 1, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if estimateTokens(string(runes[:mid])) <= size {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// Helper to find the length of the longest suffix of runes that is at most
+// size tokens long
+func suffixForTokens(runes []rune, size int) int {
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if estimateTokens(string(runes[len(runes)-mid:])) <= size {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// addOverlap prefixes every chunk with up to overlap tokens from the end of
+// the previous one, starting at a word boundary when there is one
+func addOverlap(chunks []Chunk, overlap int) []Chunk {
+	if overlap <= 0 || len(chunks) < 2 {
+		return chunks
+	}
+
+	out := make([]Chunk, len(chunks))
+	copy(out, chunks)
+	for i := 1; i < len(chunks); i++ {
+		prev := []rune(chunks[i-1].Text)
+		n := suffixForTokens(prev, overlap)
+		if n == len(prev) {
+			out[i].Text = chunks[i-1].Text + "\n" + chunks[i].Text
+			continue
+		}
+
+		tail := prev[len(prev)-n:]
+		for j, r := range tail {
+			if unicode.IsSpace(r) {
+				tail = tail[j+1:]
+				break
+			}
+		}
+		if len(tail) == 0 {
+			continue
+		}
+		out[i].Text = strings.TrimSpace(string(tail)) + "\n" + chunks[i].Text
+	}
+	return out
+}
+
+// spanLocator finds consecutive pieces of a text in it. The pieces may
+// differ from the text in whitespace only, as produced by packText.
+type spanLocator struct {
+	src []rune
+	pos int
+}
+
+func newSpanLocator(text string) *spanLocator {
+	return &spanLocator{src: []rune(text)}
+}
+
+// locate returns the rune offsets of the next piece and moves past it
+func (l *spanLocator) locate(piece string) (int, int) {
+	start, i := -1, l.pos
+	for _, r := range piece {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		for i < len(l.src) && unicode.IsSpace(l.src[i]) {
+			i++
+		}
+		if i >= len(l.src) || l.src[i] != r {
+			// Not a piece of the text, leave the position as it is
+			return l.pos, l.pos
+		}
+		if start < 0 {
+			start = i
+		}
+		i++
+	}
+	if start < 0 {
+		return l.pos, l.pos
+	}
+	l.pos = i
+	return start, i
+}
+
+// Helper to turn consecutive pieces of the text into chunks
+func (l *spanLocator) locateAll(pieces []string) []Chunk {
+	chunks := make([]Chunk, len(pieces))
+	for i, p := range pieces {
+		start, end := l.locate(p)
+		chunks[i] = Chunk{Text: p, Start: start, End: end}
+	}
+	return chunks
+}
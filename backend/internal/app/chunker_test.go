@@ -0,0 +1,159 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSpanLocator(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		pieces []string
+		want   [][2]int
+	}{
+		{
+			name:   "ascii",
+			text:   "one two\n\nthree",
+			pieces: []string{"one two", "three"},
+			want:   [][2]int{{0, 7}, {9, 14}},
+		},
+		{
+			name:   "cyrillic offsets are in runes",
+			text:   "Привет мир.\n\nВторой  абзац.",
+			pieces: []string{"Привет мир.", "Второй абзац."},
+			want:   [][2]int{{0, 11}, {13, 27}},
+		},
+		{
+			name:   "whitespace differs",
+			text:   "a\n  b\tc",
+			pieces: []string{"a b c"},
+			want:   [][2]int{{0, 7}},
+		},
+		{
+			name:   "unknown piece keeps the position",
+			text:   "alpha beta",
+			pieces: []string{"alpha", "gamma", "beta"},
+			want:   [][2]int{{0, 5}, {5, 5}, {6, 10}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := newSpanLocator(tt.text)
+			for i, p := range tt.pieces {
+				start, end := loc.locate(p)
+				if start != tt.want[i][0] || end != tt.want[i][1] {
+					t.Errorf("locate(%q) = %d, %d, want %d, %d", p, start, end, tt.want[i][0], tt.want[i][1])
+				}
+			}
+		})
+	}
+}
+
+func TestChunkersKeepRunesAndOffsets(t *testing.T) {
+	text := "# Заголовок\n\n" +
+		strings.Repeat("Это тестовое предложение про виджеты. ", 30) + "\n\n" +
+		"## 東京\n\n" + strings.Repeat("東京は日本の首都です。", 20) + "\n\n" +
+		strings.Repeat("word ", 200)
+	runes := []rune(text)
+
+	for _, strategy := range []string{ChunkerFixed, ChunkerParagraph, ChunkerMarkdown} {
+		t.Run(strategy, func(t *testing.T) {
+			c, err := NewChunker(strategy, 60, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := c.Chunk(text)
+			if len(chunks) < 2 {
+				t.Fatalf("got %d chunks, want several", len(chunks))
+			}
+
+			prevEnd := 0
+			for i, ch := range chunks {
+				if !utf8.ValidString(ch.Text) {
+					t.Errorf("chunk %d is not valid UTF-8", i)
+				}
+				if ch.Start < prevEnd || ch.End <= ch.Start || ch.End > len(runes) {
+					t.Fatalf("chunk %d has span %d-%d after %d", i, ch.Start, ch.End, prevEnd)
+				}
+				// The text of the span is part of the chunk, which may add
+				// overlap and put spaces between CJK sentences
+				own := strings.Join(strings.Fields(string(runes[ch.Start:ch.End])), "")
+				if !strings.Contains(strings.Join(strings.Fields(ch.Text), ""), own) {
+					t.Errorf("chunk %d does not contain its span %q", i, own)
+				}
+				prevEnd = ch.End
+			}
+			// Trailing whitespace may or may not be part of the last span
+			if trimmed := len([]rune(strings.TrimSpace(text))); prevEnd < trimmed {
+				t.Errorf("chunks end at %d, want %d", prevEnd, trimmed)
+			}
+		})
+	}
+}
+
+func TestPackTextSizesInTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		size int
+	}{
+		{"sentences", strings.Repeat("The quick brown fox jumps over the lazy dog. ", 50), 40},
+		{"cyrillic", strings.Repeat("Съешь же ещё этих мягких французских булок. ", 50), 40},
+		{"cjk without spaces", strings.Repeat("東京は日本の首都です。", 30), 25},
+		{"single long word", strings.Repeat("x", 1000), 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pieces := packText(tt.text, tt.size)
+			for i, p := range pieces {
+				if n := estimateTokens(p); n > tt.size {
+					t.Errorf("piece %d has %d tokens, want at most %d", i, n, tt.size)
+				}
+			}
+			got := strings.Join(strings.Fields(strings.Join(pieces, "")), "")
+			want := strings.Join(strings.Fields(tt.text), "")
+			if got != want {
+				t.Errorf("pieces don't add up to the text")
+			}
+		})
+	}
+}
+
+func TestSplitMarkdownSections(t *testing.T) {
+	text := "intro\n# One\ntext\n```\n# not a heading\n```\n## Two\nmore"
+	want := []string{"intro", "# One\ntext\n```\n# not a heading\n```", "## Two\nmore"}
+
+	got := splitMarkdownSections(text)
+	if len(got) != len(want) {
+		t.Fatalf("got %d sections %q, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("section %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNewChunkerValidates(t *testing.T) {
+	tests := []struct {
+		strategy      string
+		size, overlap int
+		ok            bool
+	}{
+		{ChunkerParagraph, 500, 50, true},
+		{ChunkerParagraph, 0, 0, false},
+		{ChunkerParagraph, 100, 100, false},
+		{ChunkerParagraph, 100, -1, false},
+		{"sentences", 100, 10, false},
+	}
+	for _, tt := range tests {
+		_, err := NewChunker(tt.strategy, tt.size, tt.overlap)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewChunker(%q, %d, %d) error = %v, want ok %v", tt.strategy, tt.size, tt.overlap, err, tt.ok)
+		}
+	}
+}
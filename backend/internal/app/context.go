@@ -0,0 +1,59 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chunks that would have to be cut below this many tokens are dropped
+// instead of truncated
+const minTruncatedTokens = 64
+
+// ContextReport describes how retrieved chunks were fitted into the
+// prompt. It is sent to the client in the final meta event.
+type ContextReport struct {
+	BudgetTokens int      `json:"budget_tokens"`
+	UsedTokens   int      `json:"used_tokens"`
+	Truncated    []string `json:"truncated,omitempty"`
+	Dropped      []string `json:"dropped,omitempty"`
+}
+
+// assembleContext fills the token budget with the given chunks in rank
+// order. The first chunk that doesn't fit is truncated if enough budget
+// is left, every chunk after it is dropped. It returns the prompt context,
+// the chunks that made it in and a report of what was left out.
+func assembleContext(docs []Document, budget int) (string, []Document, ContextReport) {
+	report := ContextReport{BudgetTokens: budget}
+	var sb strings.Builder
+	var included []Document
+
+	full := false
+	for _, doc := range docs {
+		if full {
+			report.Dropped = append(report.Dropped, doc.ID)
+			continue
+		}
+
+		header := fmt.Sprintf("\nDocument %s:\n", doc.ID)
+		entry := header + doc.Content + "\n"
+		cost := estimateTokens(entry)
+		if report.UsedTokens+cost > budget {
+			full = true
+			left := budget - report.UsedTokens - estimateTokens(header) - 1
+			if left < minTruncatedTokens {
+				report.Dropped = append(report.Dropped, doc.ID)
+				continue
+			}
+			doc.Content = truncateToTokens(doc.Content, left)
+			entry = header + doc.Content + "\n"
+			cost = estimateTokens(entry)
+			report.Truncated = append(report.Truncated, doc.ID)
+		}
+
+		sb.WriteString(entry)
+		report.UsedTokens += cost
+		included = append(included, doc)
+	}
+
+	return sb.String(), included, report
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Helpers to compute the tokens assembleContext charges for a chunk
+func headerTokens(id string) int {
+	return estimateTokens(fmt.Sprintf("\nDocument %s:\n", id))
+}
+
+func entryTokens(doc Document) int {
+	return estimateTokens(fmt.Sprintf("\nDocument %s:\n%s\n", doc.ID, doc.Content))
+}
+
+func TestAssembleContext(t *testing.T) {
+	a := Document{ID: "a.md#chunk-0", Content: "The zebra lives in Africa."}
+	b := Document{ID: "b.md#chunk-0", Content: strings.Repeat("word ", 400)}
+	c := Document{ID: "c.md#chunk-0", Content: "Short."}
+	// Budget left for the content of b after a and its header
+	forB := func(left int) int {
+		return entryTokens(a) + headerTokens(b.ID) + 1 + left
+	}
+
+	tests := []struct {
+		name          string
+		docs          []Document
+		budget        int
+		wantIncluded  []string
+		wantTruncated []string
+		wantDropped   []string
+	}{
+		{"everything fits", []Document{a, c}, 1000, []string{a.ID, c.ID}, nil, nil},
+		{"exact fit", []Document{a, c}, entryTokens(a) + entryTokens(c), []string{a.ID, c.ID}, nil, nil},
+		{"no chunks", nil, 1000, nil, nil, nil},
+		{"truncated, later ones dropped", []Document{a, b, c}, forB(100), []string{a.ID, b.ID}, []string{b.ID}, []string{c.ID}},
+		{"truncated at the cutoff", []Document{a, b, c}, forB(minTruncatedTokens), []string{a.ID, b.ID}, []string{b.ID}, []string{c.ID}},
+		{"dropped below the cutoff", []Document{a, b, c}, forB(minTruncatedTokens - 1), []string{a.ID}, nil, []string{b.ID, c.ID}},
+		{"first chunk too large", []Document{b, a}, 10, nil, nil, []string{b.ID, a.ID}},
+		{"first chunk truncated", []Document{b}, 200, []string{b.ID}, []string{b.ID}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docContext, included, report := assembleContext(tt.docs, tt.budget)
+
+			var ids []string
+			var want strings.Builder
+			for _, doc := range included {
+				ids = append(ids, doc.ID)
+				fmt.Fprintf(&want, "\nDocument %s:\n%s\n", doc.ID, doc.Content)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIncluded) {
+				t.Errorf("included %q, want %q", ids, tt.wantIncluded)
+			}
+			if docContext != want.String() {
+				t.Errorf("context = %q, want the included chunks %q", docContext, want.String())
+			}
+			if !reflect.DeepEqual(report.Truncated, tt.wantTruncated) || !reflect.DeepEqual(report.Dropped, tt.wantDropped) {
+				t.Errorf("truncated %q, dropped %q, want %q, %q", report.Truncated, report.Dropped, tt.wantTruncated, tt.wantDropped)
+			}
+			if report.BudgetTokens != tt.budget || report.UsedTokens != estimateTokens(docContext) || report.UsedTokens > tt.budget {
+				t.Errorf("report = %+v, context of %d tokens", report, estimateTokens(docContext))
+			}
+			for _, doc := range included {
+				if reflect.DeepEqual(report.Truncated, []string{doc.ID}) {
+					if doc.Content == b.Content || !strings.HasPrefix(b.Content, doc.Content) {
+						t.Errorf("truncated content %q is not a prefix of the chunk", doc.Content)
+					}
+				}
+			}
+		})
+	}
+
+	// The caller's chunks are left alone
+	docs := []Document{a, b}
+	assembleContext(docs, forB(100))
+	if docs[1].Content != b.Content {
+		t.Error("assembleContext() modified the given chunk")
+	}
+}
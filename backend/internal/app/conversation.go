@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Number of previous messages sent to the model with a new question
+const maxHistoryMessages = 20
+
+// Helper to keep the last maxHistoryMessages messages of a history
+func trimHistory(msgs []Message) []Message {
+	if len(msgs) > maxHistoryMessages {
+		msgs = msgs[len(msgs)-maxHistoryMessages:]
+	}
+	return msgs
+}
+
+// Helper to check a history supplied by the client, which may only hold
+// user and assistant turns, and trim it like the stored one
+func clientHistory(msgs []Message) ([]Message, error) {
+	for _, msg := range msgs {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return nil, fmt.Errorf("invalid message role %q (expected user or assistant)", msg.Role)
+		}
+	}
+	return trimHistory(msgs), nil
+}
+
+// Helper to generate a random conversation ID
+func newConversationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// condenseQuery rewrites a follow-up question into a standalone question
+// using the conversation history, so that retrieval finds the right chunks
+// for questions like "and what about February?"
+func (a *App) condenseQuery(ctx context.Context, history []Message, query string) (string, error) {
+	if len(history) == 0 {
+		return query, nil
+	}
+
+	var sb strings.Builder
+	for _, msg := range history {
+		fmt.Fprintf(&sb, "%s: %s\n", msg.Role, msg.Content)
+	}
+
+	prompt := fmt.Sprintf(`Given the following conversation and a follow-up question, rewrite the follow-up question to be a standalone question that can be understood without the conversation. Keep the language of the follow-up question. Reply with the standalone question only.
+
+Conversation:
+%s
+Follow-up question: %s
+
+Standalone question:`, sb.String(), query)
+
+	answer, err := completeChat(ctx, a.llm, []Message{{Role: "user", Content: prompt}}, ChatOptions{Temperature: 0.1})
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return query, nil
+	}
+	return answer, nil
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Helper to build a conversation of n alternating user and assistant turns
+func testHistory(n int) []Message {
+	msgs := make([]Message, n)
+	for i := range msgs {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		msgs[i] = Message{Role: role, Content: fmt.Sprintf("message %d", i)}
+	}
+	return msgs
+}
+
+func TestClientHistory(t *testing.T) {
+	tests := []struct {
+		name      string
+		msgs      []Message
+		wantLen   int
+		wantFirst string
+		wantErr   bool
+	}{
+		{"empty", nil, 0, "", false},
+		{"short", testHistory(3), 3, "message 0", false},
+		{"at the cap", testHistory(maxHistoryMessages), maxHistoryMessages, "message 0", false},
+		{"over the cap", testHistory(maxHistoryMessages + 5), maxHistoryMessages, "message 5", false},
+		{"system message", []Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Hi"}}, 0, "", true},
+		{"empty role", []Message{{Content: "Hi"}}, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clientHistory(tt.msgs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clientHistory() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(got) != tt.wantLen {
+				t.Fatalf("clientHistory() kept %d messages, want %d", len(got), tt.wantLen)
+			}
+			if tt.wantLen > 0 && got[0].Content != tt.wantFirst {
+				t.Errorf("first message kept = %q, want %q", got[0].Content, tt.wantFirst)
+			}
+			if tt.wantLen > 0 && got[len(got)-1] != tt.msgs[len(tt.msgs)-1] {
+				t.Errorf("last message = %+v, want the latest one", got[len(got)-1])
+			}
+		})
+	}
+}
+
+func TestCondenseQuery(t *testing.T) {
+	ctx := context.Background()
+	history := []Message{{Role: "user", Content: "How much did we sell in January?"}, {Role: "assistant", Content: "120 units."}}
+	tests := []struct {
+		name    string
+		history []Message
+		reply   func([]Message) ([]string, error)
+		start   error
+		want    string
+		wantErr bool
+		calls   int
+	}{
+		{"no history", nil, replyWith("ignored"), nil, "and February?", false, 0},
+		{"condensed", history, replyWith("  How much did we sell ", "in February?\n"), nil, "How much did we sell in February?", false, 1},
+		{"empty answer", history, replyWith(" \n"), nil, "and February?", false, 1},
+		{"model unreachable", history, nil, errors.New("refused"), "", true, 1},
+		{"stream fails", history, func([]Message) ([]string, error) {
+			return []string{"How much"}, errors.New("connection reset")
+		}, nil, "", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &fakeChatProvider{reply: tt.reply, start: tt.start}
+			app := &App{llm: llm}
+			got, err := app.condenseQuery(ctx, tt.history, "and February?")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("condenseQuery() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+			if len(llm.requests) != tt.calls {
+				t.Fatalf("model called %d times, want %d", len(llm.requests), tt.calls)
+			}
+			if tt.calls == 0 {
+				return
+			}
+			prompt := llm.requests[0]
+			if len(prompt) != 1 || !strings.Contains(prompt[0].Content, "user: How much did we sell in January?\nassistant: 120 units.\n") ||
+				!strings.Contains(prompt[0].Content, "Follow-up question: and February?") {
+				t.Errorf("prompt = %+v", prompt)
+			}
+			if llm.options[0].Temperature != 0.1 {
+				t.Errorf("temperature = %v, want 0.1", llm.options[0].Temperature)
+			}
+		})
+	}
+}
+
+// Helper to tell the condense request from the answer request
+func isCondensePrompt(messages []Message) bool {
+	return len(messages) == 1 && strings.Contains(messages[0].Content, "Standalone question:")
+}
+
+func TestPrepareRAGCondenseFallback(t *testing.T) {
+	app, llm := newTestApp(t, testDocs)
+	ws := app.workspaces[0]
+	history := []Message{{Role: "user", Content: "Tell me about cacti."}, {Role: "assistant", Content: "They store water."}}
+
+	// A condensed question is used for retrieval only
+	llm.reply = replyWith("Where does the zebra live?")
+	rag := app.prepareRAG(context.Background(), ws, "and that animal?", history, RetrievalLexical, nil)
+	if rag.SearchQuery != "Where does the zebra live?" || len(rag.Sources) == 0 || rag.Sources[0].Path != "animals.txt" {
+		t.Errorf("search query %q found %+v", rag.SearchQuery, rag.Sources)
+	}
+	if n := len(rag.Messages); n != 3 || !strings.Contains(rag.Messages[2].Content, "User Question: and that animal?") {
+		t.Errorf("messages = %+v, want the history and the original question", rag.Messages)
+	}
+
+	// A failing model leaves the question as it is
+	llm.reply = func(messages []Message) ([]string, error) {
+		if isCondensePrompt(messages) {
+			return nil, errors.New("model down")
+		}
+		return []string{"Answer"}, nil
+	}
+	rag = app.prepareRAG(context.Background(), ws, "Where do cacti store water?", history, RetrievalLexical, nil)
+	if rag.SearchQuery != "Where do cacti store water?" || len(rag.Sources) == 0 || rag.Sources[0].Path != "plants.txt" {
+		t.Errorf("search query %q found %+v, want the original question", rag.SearchQuery, rag.Sources)
+	}
+}
+
+func TestChatHistoryCap(t *testing.T) {
+	app, llm := newTestApp(t, testDocs)
+	llm.reply = func(messages []Message) ([]string, error) {
+		if isCondensePrompt(messages) {
+			return []string{"Where does the zebra live?"}, nil
+		}
+		return []string{"In Africa."}, nil
+	}
+	history, _ := json.Marshal(testHistory(maxHistoryMessages + 6))
+	body := `{"query":"and the zebra?","messages":` + string(history) + `}`
+
+	rec := serveTest(app.handleChat, http.MethodPost, "/chat", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	sent := llm.sent()
+	if len(sent) != 2 || !isCondensePrompt(sent[0]) {
+		t.Fatalf("sent %d requests, want the condense request and the question", len(sent))
+	}
+	if strings.Contains(sent[0][0].Content, "message 5\n") || !strings.Contains(sent[0][0].Content, "message 6\n") {
+		t.Error("condense prompt doesn't hold exactly the last 20 messages")
+	}
+	msgs := sent[1]
+	if len(msgs) != maxHistoryMessages+1 || msgs[0].Content != "message 6" {
+		t.Errorf("sent %d messages starting with %q, want the last %d and the question", len(msgs), msgs[0].Content, maxHistoryMessages)
+	}
+}
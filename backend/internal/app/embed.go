@@ -0,0 +1,379 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"minirag/internal/config"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// Embedder turns texts into embedding vectors, many texts per request
+type Embedder interface {
+	// Model returns the name of the embedding model
+	Model() string
+	// EmbedBatch returns one vector per text, in the same order
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder creates the embedder selected in the config
+func NewEmbedder(cfg *config.Config) (Embedder, error) {
+	switch cfg.EmbedProvider {
+	case ProviderOllama:
+		return &ollamaEmbedder{url: cfg.OllamaURL, model: cfg.OllamaEmbedModel}, nil
+	case ProviderOpenAI:
+		if cfg.OpenAIEmbedModel == "" {
+			return nil, fmt.Errorf("-openai-embed-model is required for the %s embedding provider", ProviderOpenAI)
+		}
+		return &openAIEmbedder{
+			url:    strings.TrimRight(cfg.OpenAIURL, "/"),
+			apiKey: cfg.OpenAIAPIKey,
+			model:  cfg.OpenAIEmbedModel,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q (expected %s or %s)", cfg.EmbedProvider, ProviderOllama, ProviderOpenAI)
+	}
+}
+
+// Helper to adapt an embedder to chromem, used to embed queries
+func embeddingFuncFor(e Embedder) chromem.EmbeddingFunc {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		vecs, err := e.EmbedBatch(ctx, []string{text})
+		if err != nil {
+			return nil, err
+		}
+		return normalizeEmbedding(vecs[0]), nil
+	}
+}
+
+// ollamaEmbedder uses Ollama's batch /api/embed endpoint
+type ollamaEmbedder struct {
+	url   string
+	model string
+}
+
+func (e *ollamaEmbedder) Model() string {
+	return e.model
+}
+
+func (e *ollamaEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var out struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	body := map[string]interface{}{"model": e.model, "input": texts}
+	if err := postJSON(ctx, e.url+"/api/embed", "", body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d texts", len(out.Embeddings), len(texts))
+	}
+	return out.Embeddings, nil
+}
+
+// openAIEmbedder uses the /embeddings endpoint of an OpenAI-compatible server
+type openAIEmbedder struct {
+	url    string // base URL including /v1
+	apiKey string
+	model  string
+}
+
+func (e *openAIEmbedder) Model() string {
+	return e.model
+}
+
+func (e *openAIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	body := map[string]interface{}{"model": e.model, "input": texts}
+	if err := postJSON(ctx, e.url+"/embeddings", e.apiKey, body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Data) != len(texts) {
+		return nil, fmt.Errorf("server returned %d embeddings for %d texts", len(out.Data), len(texts))
+	}
+
+	// The data may come in any order, each embedding belongs to the text
+	// at its index
+	vecs := make([][]float32, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(vecs) || vecs[d.Index] != nil || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("server returned an invalid embedding at index %d", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
+
+// Helper to POST a JSON body and decode the JSON response
+func postJSON(ctx context.Context, url, apiKey string, body, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned status %d: %s", url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// embeddingCache stores embeddings on disk keyed by a hash of the model
+// and the chunk text, so unchanged text is never embedded twice, not even
+// after -force-reindex. Entries no stored chunk uses any more are dropped
+// once every workspace has finished a full indexing pass.
+type embeddingCache struct {
+	path    string
+	mu      sync.RWMutex
+	vectors map[string][]float32
+	dirty   bool
+	// Keys added since the last prune, kept even if no chunk uses them yet
+	// because another workspace may still be storing them
+	added map[string]bool
+	// Keys of the chunks stored by each workspace
+	sources []*cacheSource
+}
+
+// cacheSource tracks the cache keys of the chunks a workspace stored, file
+// by file. It's guarded by the lock of its cache.
+type cacheSource struct {
+	cache *embeddingCache
+	files map[string][]string
+	// Set once a full indexing pass has finished. Until then, like during
+	// a rebuild, files still to be indexed again may need old entries.
+	complete bool
+}
+
+func newEmbeddingCache(path string) (*embeddingCache, error) {
+	c := &embeddingCache{path: path, vectors: make(map[string][]float32), added: make(map[string]bool)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := gob.NewDecoder(f).Decode(&c.vectors); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Helper to build the cache key of a text. The model is identified with
+// its provider, see embedModelID, since the same name may stand for
+// different models on different servers.
+func embeddingCacheKey(model, text string) string {
+	h := sha256.New()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *embeddingCache) get(key string) ([]float32, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.vectors[key]
+	return v, ok
+}
+
+func (c *embeddingCache) put(key string, v []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.vectors[key] = v
+	c.added[key] = true
+	c.dirty = true
+}
+
+// newSource registers a workspace whose chunks keep their entries
+func (c *embeddingCache) newSource() *cacheSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &cacheSource{cache: c, files: make(map[string][]string)}
+	c.sources = append(c.sources, s)
+	return s
+}
+
+// setFile records the keys of the chunks stored for a file
+func (s *cacheSource) setFile(relPath string, keys []string) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.files[relPath] = keys
+}
+
+// removeFile forgets the keys of a file whose chunks were deleted
+func (s *cacheSource) removeFile(relPath string) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	delete(s.files, relPath)
+}
+
+// reset forgets all keys when the index is rebuilt. Nothing is pruned until
+// the rebuild has finished, so an interrupted one keeps the old entries.
+func (s *cacheSource) reset() {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.files = make(map[string][]string)
+	s.complete = false
+}
+
+// markComplete records that a full indexing pass has finished
+func (s *cacheSource) markComplete() {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.complete = true
+}
+
+// prune drops the entries that are neither used by a stored chunk nor new.
+// It does nothing while a workspace hasn't finished a full pass yet.
+func (c *embeddingCache) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.sources) == 0 {
+		return
+	}
+	used := make(map[string]bool)
+	for _, s := range c.sources {
+		if !s.complete {
+			return
+		}
+		for _, keys := range s.files {
+			for _, key := range keys {
+				used[key] = true
+			}
+		}
+	}
+
+	for key := range c.vectors {
+		if !used[key] && !c.added[key] {
+			delete(c.vectors, key)
+			c.dirty = true
+		}
+	}
+	c.added = make(map[string]bool)
+}
+
+// Save writes the cache to disk if it changed
+func (c *embeddingCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	tmp := c.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(c.vectors); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// cachedEmbedder embeds texts in batches, serving repeated texts from the
+// cache
+type cachedEmbedder struct {
+	Embedder
+	provider  string
+	cache     *embeddingCache
+	batchSize int
+}
+
+func (e *cachedEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+	var missing []int
+	for i, text := range texts {
+		keys[i] = embeddingCacheKey(embedModelID(e.provider, e.Model()), text)
+		if v, ok := e.cache.get(keys[i]); ok {
+			vecs[i] = v
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	batchSize := e.batchSize
+	if batchSize <= 0 {
+		batchSize = 32
+	}
+	for start := 0; start < len(missing); start += batchSize {
+		end := start + batchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		batch := make([]string, 0, end-start)
+		for _, i := range missing[start:end] {
+			batch = append(batch, texts[i])
+		}
+		out, err := e.Embedder.EmbedBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range missing[start:end] {
+			vecs[i] = normalizeEmbedding(out[j])
+			e.cache.put(keys[i], vecs[i])
+		}
+	}
+	return vecs, nil
+}
+
+// Helper to scale a vector to unit length, as chromem expects
+func normalizeEmbedding(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	norm := math.Sqrt(sum)
+	if norm == 0 || math.Abs(norm-1) < 1e-5 {
+		return v
+	}
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
@@ -0,0 +1,452 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// fakeEmbedder embeds a text as the counts of the letters a to z in it plus
+// a constant, and records the texts it was asked to embed
+type fakeEmbedder struct {
+	mu    sync.Mutex
+	texts []string
+	// Fails a batch when set and returning an error
+	fail func(texts []string) error
+}
+
+func (e *fakeEmbedder) Model() string {
+	return "fake"
+}
+
+func (e *fakeEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.fail != nil {
+		if err := e.fail(texts); err != nil {
+			return nil, err
+		}
+	}
+	e.texts = append(e.texts, texts...)
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, 27)
+		v[26] = 1
+		for _, r := range strings.ToLower(text) {
+			if r >= 'a' && r <= 'z' {
+				v[r-'a']++
+			}
+		}
+		vecs[i] = v
+	}
+	return vecs, nil
+}
+
+// Helper to get the texts embedded so far and forget them
+func (e *fakeEmbedder) embedded() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	texts := e.texts
+	e.texts = nil
+	return texts
+}
+
+// setTestEmbedder makes the workspace embed with e, through its cache
+func setTestEmbedder(ws *workspace, e Embedder) {
+	ws.embedder = &cachedEmbedder{Embedder: e, provider: ws.embedProvider, cache: ws.embedCache, batchSize: 2}
+	ws.embeddingFunc = embeddingFuncFor(e)
+}
+
+// Helper to write files below dir, creating directories as needed
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCachedEmbedder(t *testing.T) {
+	cache, err := newEmbeddingCache(filepath.Join(t.TempDir(), "embeddings.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeEmbedder{}
+	e := &cachedEmbedder{Embedder: fake, provider: ProviderOllama, cache: cache, batchSize: 2}
+	ctx := context.Background()
+
+	first, err := e.EmbedBatch(ctx, []string{"alpha", "beta", "gamma"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.embedded(); strings.Join(got, ",") != "alpha,beta,gamma" {
+		t.Errorf("embedded %q on a cold cache", got)
+	}
+
+	// Only new texts reach the model, results keep the order of the texts
+	second, err := e.EmbedBatch(ctx, []string{"gamma", "delta", "alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.embedded(); strings.Join(got, ",") != "delta" {
+		t.Errorf("embedded %q, want only the miss", got)
+	}
+	if !equalVectors(second[0], first[2]) || !equalVectors(second[2], first[0]) {
+		t.Error("cached vectors returned out of order")
+	}
+	for _, v := range second {
+		if n := vectorNorm(v); n < 0.999 || n > 1.001 {
+			t.Errorf("vector norm = %f, want 1", n)
+		}
+	}
+
+	// The same text embedded by another model is a miss
+	other := &cachedEmbedder{Embedder: fake, provider: ProviderOpenAI, cache: cache}
+	if _, err := other.EmbedBatch(ctx, []string{"alpha"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.embedded(); len(got) != 1 {
+		t.Errorf("embedded %q for another provider, want a miss", got)
+	}
+
+	// Failures aren't cached
+	fake.fail = func([]string) error { return errors.New("model down") }
+	if _, err := e.EmbedBatch(ctx, []string{"epsilon"}); err == nil {
+		t.Error("EmbedBatch() succeeded with a failing model")
+	}
+	if _, ok := cache.get(embeddingCacheKey(embedModelID(ProviderOllama, "fake"), "epsilon")); ok {
+		t.Error("failed text was cached")
+	}
+}
+
+func TestEmbeddingCacheSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.gob")
+	cache, err := newEmbeddingCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.put("a", []float32{1, 0})
+	cache.put("b", []float32{0, 1})
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	loaded, err := newEmbeddingCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string][]float32{"a": {1, 0}, "b": {0, 1}} {
+		if v, ok := loaded.get(key); !ok || !equalVectors(v, want) {
+			t.Errorf("get(%q) = %v, %v, want %v", key, v, ok, want)
+		}
+	}
+
+	// Unchanged caches aren't written again
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("unchanged cache was written")
+	}
+
+	if err := os.WriteFile(path, []byte("not a gob"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newEmbeddingCache(path); err == nil {
+		t.Error("newEmbeddingCache() succeeded on a corrupt file")
+	}
+}
+
+func TestEmbeddingCachePrune(t *testing.T) {
+	cache, err := newEmbeddingCache(filepath.Join(t.TempDir(), "embeddings.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a1", "a2", "b1", "old"} {
+		cache.put(key, []float32{1})
+	}
+	a, b := cache.newSource(), cache.newSource()
+	a.setFile("one.md", []string{"a1"})
+	a.setFile("two.md", []string{"a2"})
+	b.setFile("one.md", []string{"b1"})
+
+	has := func(keys ...string) bool {
+		for _, key := range keys {
+			if _, ok := cache.get(key); !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	// New entries are kept until the first prune, and nothing is pruned
+	// before every workspace finished a pass
+	a.markComplete()
+	cache.prune()
+	if !has("a1", "a2", "b1", "old") {
+		t.Fatal("pruned before every workspace finished a pass")
+	}
+	b.markComplete()
+	cache.prune()
+	if !has("a1", "a2", "b1", "old") {
+		t.Fatal("pruned entries added since the last prune")
+	}
+	cache.prune()
+	if !has("a1", "a2", "b1") || has("old") {
+		t.Fatal("prune() didn't keep exactly the entries in use")
+	}
+
+	// Keys of removed files go, keys another workspace uses stay
+	a.removeFile("two.md")
+	b.setFile("two.md", []string{"a1"})
+	a.removeFile("one.md")
+	cache.prune()
+	if !has("a1", "b1") || has("a2") {
+		t.Error("prune() dropped an entry used by another workspace or kept an unused one")
+	}
+
+	// A rebuild keeps everything until it has finished
+	b.reset()
+	cache.prune()
+	if !has("a1", "b1") {
+		t.Error("pruned during a rebuild")
+	}
+}
+
+func TestInterruptedRebuildKeepsEmbeddings(t *testing.T) {
+	cfg := testConfig(t)
+	ctx := context.Background()
+	ws := newTestWorkspace(t, cfg, chromem.NewDB(), defaultWorkspaceName)
+	writeTestFiles(t, ws.roots[0].dir, map[string]string{"a.txt": "First file.", "b.txt": "Second file."})
+	fake := &fakeEmbedder{}
+	setTestEmbedder(ws, fake)
+	if err := ws.load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.indexDocuments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	keys := ws.chunkCacheKeys([]string{"First file.", "Second file."})
+
+	// A forced rebuild failing on a new file leaves the cache alone, the
+	// chunks of the other files may not have been stored again yet
+	cfg.ForceReindex = true
+	writeTestFiles(t, ws.roots[0].dir, map[string]string{"c.txt": "Third file."})
+	fake.fail = func(texts []string) error {
+		if texts[0] == "Third file." {
+			return errors.New("model down")
+		}
+		return nil
+	}
+	if err := ws.indexDocuments(ctx); err == nil {
+		t.Fatal("indexDocuments() succeeded with a failing model")
+	}
+	ws.embedCache.prune()
+	for _, key := range keys {
+		if _, ok := ws.embedCache.get(key); !ok {
+			t.Fatal("interrupted rebuild dropped cached embeddings")
+		}
+	}
+
+	// Finishing it only embeds the new file
+	fake.fail = nil
+	fake.embedded()
+	if err := ws.indexDocuments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.embedded(); strings.Join(got, ",") != "minirag,Third file." {
+		t.Errorf("rebuild embedded %q, want the probe and the new file", got)
+	}
+	reloaded, err := newEmbeddingCache(cfg.EmbedCacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.vectors) != len(keys)+1 {
+		t.Errorf("saved cache has %d entries, want %d", len(reloaded.vectors), len(keys)+1)
+	}
+}
+
+// Helpers to compare vectors
+func equalVectors(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func vectorNorm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+// Helper to run an OpenAI-compatible server answering /v1/embeddings with
+// body, passing the request to check
+func newTestOpenAIEmbedder(t *testing.T, status int, body string, check func(r *http.Request, req map[string]any)) *openAIEmbedder {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/embeddings" {
+			t.Errorf("request %s %s, want POST /v1/embeddings", r.Method, r.URL.Path)
+		}
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("request body: %v", err)
+		}
+		if check != nil {
+			check(r, req)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return &openAIEmbedder{url: srv.URL + "/v1", apiKey: "sk-test", model: "e5"}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	// The server answers out of order
+	body := `{"object": "list", "data": [
+		{"object": "embedding", "index": 2, "embedding": [0, 0, 1]},
+		{"object": "embedding", "index": 0, "embedding": [1, 0, 0]},
+		{"object": "embedding", "index": 1, "embedding": [0, 1, 0]}
+	], "model": "e5"}`
+	e := newTestOpenAIEmbedder(t, http.StatusOK, body, func(r *http.Request, req map[string]any) {
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		want := map[string]any{"model": "e5", "input": []any{"a", "b", "c"}}
+		if !reflect.DeepEqual(req, want) {
+			t.Errorf("request = %v, want %v", req, want)
+		}
+	})
+	vecs, err := e.EmbedBatch(context.Background(), []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float32{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	if !reflect.DeepEqual(vecs, want) {
+		t.Errorf("EmbedBatch() = %v, want %v", vecs, want)
+	}
+
+	// Without a key no Authorization header is sent
+	e = newTestOpenAIEmbedder(t, http.StatusOK, `{"data": [{"index": 0, "embedding": [1]}]}`, func(r *http.Request, req map[string]any) {
+		if got, ok := r.Header["Authorization"]; ok {
+			t.Errorf("Authorization = %q without a key", got)
+		}
+	})
+	e.apiKey = ""
+	if _, err := e.EmbedBatch(context.Background(), []string{"a"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenAIEmbedderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"status", http.StatusUnauthorized, `{"error": {"message": "Incorrect API key provided"}}` + "\n", `returned status 401: {"error": {"message": "Incorrect API key provided"}}`},
+		{"long error body", http.StatusInternalServerError, strings.Repeat("x", 5000), "status 500: " + strings.Repeat("x", 1024)},
+		{"too few", http.StatusOK, `{"data": [{"index": 0, "embedding": [1]}]}`, "returned 1 embeddings for 2 texts"},
+		{"duplicate index", http.StatusOK, `{"data": [{"index": 1, "embedding": [1]}, {"index": 1, "embedding": [2]}]}`, "invalid embedding at index 1"},
+		{"index out of range", http.StatusOK, `{"data": [{"index": 0, "embedding": [1]}, {"index": 2, "embedding": [2]}]}`, "invalid embedding at index 2"},
+		{"empty embedding", http.StatusOK, `{"data": [{"index": 0, "embedding": [1]}, {"index": 1, "embedding": []}]}`, "invalid embedding at index 1"},
+		{"invalid JSON", http.StatusOK, `{"data": [`, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestOpenAIEmbedder(t, tt.status, tt.body, nil)
+			_, err := e.EmbedBatch(context.Background(), []string{"a", "b"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("EmbedBatch() error = %v, want %q", err, tt.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), strings.Repeat("x", 1025)) {
+				t.Error("error body not truncated")
+			}
+		})
+	}
+}
+
+func TestNormalizeEmbedding(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []float32
+		want []float32
+	}{
+		{"scaled", []float32{3, 4}, []float32{0.6, 0.8}},
+		{"negative", []float32{0, -2, 0}, []float32{0, -1, 0}},
+		{"unit length", []float32{0.6, 0.8}, []float32{0.6, 0.8}},
+		{"zero", []float32{0, 0}, []float32{0, 0}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]float32(nil), tt.in...)
+			got := normalizeEmbedding(in)
+			if !equalVectors(got, tt.want) {
+				t.Errorf("normalizeEmbedding(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+			if len(got) > 0 && vectorNorm(got) != 0 && math.Abs(vectorNorm(got)-1) > 1e-5 {
+				t.Errorf("norm = %v, want 1", vectorNorm(got))
+			}
+			if !equalVectors(in, tt.in) {
+				t.Errorf("input changed to %v", in)
+			}
+		})
+	}
+}
+
+func TestNewEmbedder(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.EmbedProvider = ProviderOpenAI
+	cfg.OpenAIURL = "http://127.0.0.1:8080/v1/"
+	if _, err := NewEmbedder(cfg); err == nil {
+		t.Error("NewEmbedder() succeeded without an embedding model")
+	}
+	cfg.OpenAIEmbedModel = "e5"
+	e, err := NewEmbedder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oe, ok := e.(*openAIEmbedder); !ok || oe.url != "http://127.0.0.1:8080/v1" || e.Model() != "e5" {
+		t.Errorf("NewEmbedder() = %#v", e)
+	}
+	cfg.EmbedProvider = "cohere"
+	if _, err := NewEmbedder(cfg); err == nil || !strings.Contains(err.Error(), "unknown embedding provider") {
+		t.Errorf("NewEmbedder() error = %v", err)
+	}
+}
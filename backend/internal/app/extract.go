@@ -0,0 +1,306 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// extractedDoc is the plain text of a file together with the positions of
+// its pages, slides, sheets and headings, as rune offsets into Text
+type extractedDoc struct {
+	Text     string
+	Title    string       // set if the format has one
+	Author   string       // set if the format has one
+	Created  time.Time    // the document's own creation and
+	Updated  time.Time    // modification dates, zero if unknown
+	Pages    []docPage    // PDF only
+	Slides   []docPage    // presentations only
+	Sheets   []docPage    // spreadsheets only
+	Headings []docHeading // in document order
+}
+
+// docPage is the start of a numbered page, slide or sheet
+type docPage struct {
+	Offset int
+	Number int
+}
+
+type docHeading struct {
+	Offset int
+	Level  int
+	Title  string
+}
+
+// Helper to append a block of text, keeping track of its rune offset
+type docBuilder struct {
+	doc extractedDoc
+	sb  strings.Builder
+	n   int
+}
+
+func (b *docBuilder) offset() int {
+	if b.n > 0 {
+		return b.n + 2 // after the separator
+	}
+	return 0
+}
+
+func (b *docBuilder) write(text string) {
+	if b.n > 0 {
+		b.sb.WriteString("\n\n")
+		b.n += 2
+	}
+	b.sb.WriteString(text)
+	b.n += utf8.RuneCountInString(text)
+}
+
+// writeDoc appends the text of another document as a block, along with its
+// headings
+func (b *docBuilder) writeDoc(d *extractedDoc) {
+	if d.Text == "" {
+		return
+	}
+	base := b.offset()
+	for _, h := range d.Headings {
+		h.Offset += base
+		b.doc.Headings = append(b.doc.Headings, h)
+	}
+	b.write(d.Text)
+}
+
+func (b *docBuilder) result() *extractedDoc {
+	b.doc.Text = b.sb.String()
+	return &b.doc
+}
+
+// extractContent returns the plain text of a supported file. The boolean is
+// false for files that are skipped.
+func extractContent(path string, info os.FileInfo) (*extractedDoc, bool, error) {
+	if isPDFFile(path) {
+		doc, err := extractPDF(path, info)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	} else if isDocxFile(path) {
+		doc, err := extractDocx(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	} else if isDocFile(path) {
+		doc, err := extractDoc(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	} else if isHTMLFile(path) {
+		doc, err := extractHTML(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	} else if isXlsxFile(path) {
+		doc, err := extractXlsx(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	} else if isPptxFile(path) {
+		doc, err := extractPptx(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	} else if isODFFile(path) {
+		doc, err := extractODF(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	} else if isEPUBFile(path) {
+		doc, err := extractEPUB(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	} else if isFB2File(path) {
+		doc, err := extractFB2(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return doc, true, nil
+	}
+
+	// Read and index text file
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	doc := &extractedDoc{Text: string(b)}
+	if isMarkdownFile(path) {
+		doc.Headings = markdownHeadings(doc.Text)
+	}
+	return doc, true, nil
+}
+
+// Helper to find the ATX headings of a Markdown text, ignoring the ones in
+// fenced code blocks
+func markdownHeadings(text string) []docHeading {
+	var headings []docHeading
+	inFence := false
+	offset := 0
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if !inFence && markdownHeadingRe.MatchString(line) {
+			level := len(line) - len(strings.TrimLeft(line, "#"))
+			title := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+			headings = append(headings, docHeading{Offset: offset, Level: level, Title: title})
+		}
+		offset += utf8.RuneCountInString(line) + 1
+	}
+	return headings
+}
+
+// numberAt returns the number of the page, slide or sheet that offset lies
+// on, 0 if unknown
+func numberAt(marks []docPage, offset int) int {
+	number := 0
+	for _, p := range marks {
+		if p.Offset > offset {
+			break
+		}
+		number = p.Number
+	}
+	return number
+}
+
+// headingTrail returns the titles of the headings enclosing offset, from
+// the outermost one in
+func (d *extractedDoc) headingTrail(offset int) []string {
+	var trail []docHeading
+	for _, h := range d.Headings {
+		if h.Offset > offset {
+			break
+		}
+		for len(trail) > 0 && trail[len(trail)-1].Level >= h.Level {
+			trail = trail[:len(trail)-1]
+		}
+		trail = append(trail, h)
+	}
+
+	titles := make([]string, len(trail))
+	for i, h := range trail {
+		titles[i] = h.Title
+	}
+	return titles
+}
+
+// Versions of the extractors by file type, 0 when not listed. Bump one when
+// its output changes so that files extracted by an older version are
+// indexed again, without rebuilding the whole index.
+var extractorVersions = map[string]int{
+	"doc":  1, // table rows are told apart from empty cells
+	"docx": 2, // WordprocessingML walker with headings, lists and tables
+	"pdf":  4, // info strings of AES-encrypted files lose their padding
+}
+
+// Helper to get the version of the extractor used for a file
+func extractorVersion(path string) int {
+	return extractorVersions[fileType(path)]
+}
+
+// Helper to name the format of a file, as reported with its chunks
+func fileType(path string) string {
+	switch {
+	case isPDFFile(path):
+		return "pdf"
+	case isDocxFile(path):
+		return "docx"
+	case isDocFile(path):
+		return "doc"
+	case isMarkdownFile(path):
+		return "markdown"
+	case isHTMLFile(path):
+		return "html"
+	default:
+		return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+}
+
+// Helper to check if the file has a format we can index
+func isSupportedFile(path string) bool {
+	return isTextFile(path) || isPDFFile(path) || isDocxFile(path) || isDocFile(path) || isHTMLFile(path) ||
+		isXlsxFile(path) || isPptxFile(path) || isODFFile(path) || isEPUBFile(path) || isFB2File(path)
+}
+
+// Add helper for PDF file detection
+func isPDFFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".pdf"
+}
+
+func isTextFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	textExtensions := map[string]bool{
+		".txt": true,
+		".md":  true,
+		".rst": true,
+		".csv": true,
+		".log": true,
+	}
+	return textExtensions[ext]
+}
+
+func isMarkdownFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".md"
+}
+
+// Add helpers for DOCX and DOC
+func isDocxFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".docx"
+}
+
+func isDocFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".doc"
+}
+
+func isHTMLFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".xhtml":
+		return true
+	}
+	return false
+}
+
+func isXlsxFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".xlsx"
+}
+
+func isPptxFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".pptx"
+}
+
+// OpenDocument text, spreadsheet and presentation
+func isODFFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".odt", ".ods", ".odp":
+		return true
+	}
+	return false
+}
+
+// E-books
+func isEPUBFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".epub"
+}
+
+func isFB2File(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".fb2"
+}
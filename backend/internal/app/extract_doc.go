@@ -0,0 +1,448 @@
+package app
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Word 97-2003 documents keep their text in the WordDocument stream of a
+// compound file. Its position is described by the piece table in the table
+// stream, each piece being either 8-bit (cp1252) or UTF-16 text. See
+// [MS-DOC].
+
+// Values from the FIB, the header of the WordDocument stream
+const (
+	fibComplex      = 0x0004
+	fibEncrypted    = 0x0100
+	fibWhichTblStm  = 0x0200
+	wordIdent       = 0xA5EC
+	nFibWord97      = 0x00C1
+	fcClxIndex      = 33 // pair index of fcClx/lcbClx in FibRgFcLcb97
+	fcBtePapxIndex  = 13 // pair index of fcPlcfBtePapx/lcbPlcfBtePapx
+	ccpTextIndex    = 3  // index of ccpText in FibRgLw97
+	fcCompressedBit = 0x40000000
+)
+
+// extractDoc extracts the paragraphs of a legacy Word document
+func extractDoc(path string) (*extractedDoc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	cf, err := openCFB(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DOC file %s: %w", path, err)
+	}
+	raw, rowEnds, err := wordDocumentText(cf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DOC file %s: %w", path, err)
+	}
+
+	var b docBuilder
+	for _, p := range strings.Split(cleanWordText(raw, rowEnds), "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			b.write(p)
+		}
+	}
+	return b.result(), nil
+}
+
+// wordDocumentText returns the characters of the main document, without
+// footnotes, headers and other subdocuments, and the positions of the cell
+// marks among them that end a table row. The positions are nil when the
+// paragraph properties that tell them apart can't be read, as in Word 6/95
+// files.
+func wordDocumentText(cf *cfbFile) ([]rune, map[int]bool, error) {
+	wd, err := cf.stream("WordDocument")
+	if err != nil {
+		return nil, nil, err
+	}
+	le := binary.LittleEndian
+	if len(wd) < 0x60 || le.Uint16(wd) != wordIdent {
+		return nil, nil, fmt.Errorf("not a Word document")
+	}
+	nFib := le.Uint16(wd[2:])
+	flags := le.Uint16(wd[0x0A:])
+	if flags&fibEncrypted != 0 {
+		return nil, nil, fmt.Errorf("encrypted documents are not supported")
+	}
+
+	// Word 6 and 95 store the text as a single 8-bit run unless the file
+	// was fast-saved
+	if nFib < nFibWord97 {
+		if flags&fibComplex != 0 {
+			return nil, nil, fmt.Errorf("fast-saved Word 6/95 documents are not supported")
+		}
+		fcMin := int(le.Uint32(wd[0x18:]))
+		ccpText := int(le.Uint32(wd[0x34:]))
+		if fcMin < 0 || ccpText < 0 || fcMin+ccpText > len(wd) {
+			return nil, nil, fmt.Errorf("text is out of range")
+		}
+		return decodeCp1252(wd[fcMin : fcMin+ccpText]), nil, nil
+	}
+
+	// Walk the variable-length parts of the FIB to the values we need
+	off := 32
+	csw := int(le.Uint16(wd[off:]))
+	off += 2 + csw*2
+	if off+2 > len(wd) {
+		return nil, nil, fmt.Errorf("FIB is truncated")
+	}
+	cslw := int(le.Uint16(wd[off:]))
+	rgLw := off + 2
+	off = rgLw + cslw*4
+	if off+2 > len(wd) {
+		return nil, nil, fmt.Errorf("FIB is truncated")
+	}
+	cbRgFcLcb := int(le.Uint16(wd[off:]))
+	rgFcLcb := off + 2
+	if rgFcLcb+cbRgFcLcb*8 > len(wd) || cslw <= ccpTextIndex || cbRgFcLcb <= fcClxIndex {
+		return nil, nil, fmt.Errorf("FIB is truncated")
+	}
+	ccpText := int(le.Uint32(wd[rgLw+4*ccpTextIndex:]))
+	fcClx := int(le.Uint32(wd[rgFcLcb+8*fcClxIndex:]))
+	lcbClx := int(le.Uint32(wd[rgFcLcb+8*fcClxIndex+4:]))
+
+	tableName := "0Table"
+	if flags&fibWhichTblStm != 0 {
+		tableName = "1Table"
+	}
+	table, err := cf.stream(tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fcClx < 0 || lcbClx < 0 || fcClx+lcbClx > len(table) {
+		return nil, nil, fmt.Errorf("piece table is out of range")
+	}
+	plcPcd, err := findPlcPcd(table[fcClx : fcClx+lcbClx])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Cell marks ending a row are told apart from those of cells, empty
+	// ones included, by their paragraph properties. Without them
+	// cleanWordText falls back to guessing.
+	var rowEnds map[int]bool
+	var isRowEnd func(fc int) bool
+	if cbRgFcLcb > fcBtePapxIndex {
+		fcPapx := int(le.Uint32(wd[rgFcLcb+8*fcBtePapxIndex:]))
+		lcbPapx := int(le.Uint32(wd[rgFcLcb+8*fcBtePapxIndex+4:]))
+		data, _ := cf.stream("Data") // only needed for large properties
+		if runs, err := wordRowEndRuns(wd, table, data, fcPapx, lcbPapx); err == nil {
+			rowEnds = make(map[int]bool)
+			isRowEnd = func(fc int) bool {
+				i := sort.Search(len(runs), func(i int) bool { return runs[i].end > fc })
+				return i < len(runs) && runs[i].start <= fc
+			}
+		}
+	}
+
+	// The piece table maps ranges of character positions to file offsets
+	n := (len(plcPcd) - 4) / 12
+	var text []rune
+	for i := 0; i < n && len(text) < ccpText; i++ {
+		cpStart := int(le.Uint32(plcPcd[4*i:]))
+		cpEnd := int(le.Uint32(plcPcd[4*(i+1):]))
+		if cpEnd > ccpText {
+			cpEnd = ccpText
+		}
+		count := cpEnd - cpStart
+		if count <= 0 {
+			continue
+		}
+		fc := le.Uint32(plcPcd[4*(n+1)+8*i+2:])
+		if fc&fcCompressedBit != 0 {
+			start := int(fc&^fcCompressedBit) / 2
+			if start+count > len(wd) {
+				return nil, nil, fmt.Errorf("text piece %d is out of range", i)
+			}
+			for j, c := range wd[start : start+count] {
+				if c == 0x07 && isRowEnd != nil && isRowEnd(start+j) {
+					rowEnds[len(text)+j] = true
+				}
+			}
+			text = append(text, decodeCp1252(wd[start:start+count])...)
+		} else {
+			start := int(fc)
+			if start+2*count > len(wd) {
+				return nil, nil, fmt.Errorf("text piece %d is out of range", i)
+			}
+			for j := 0; j < count; j++ {
+				r := rune(le.Uint16(wd[start+2*j:]))
+				if utf16.IsSurrogate(r) {
+					if j+1 < count {
+						if pair := utf16.DecodeRune(r, rune(le.Uint16(wd[start+2*j+2:]))); pair != utf8.RuneError {
+							text = append(text, pair)
+							j++
+							continue
+						}
+					}
+					r = utf8.RuneError
+				}
+				if r == 0x07 && isRowEnd != nil && isRowEnd(start+2*j) {
+					rowEnds[len(text)] = true
+				}
+				text = append(text, r)
+			}
+		}
+	}
+	return text, rowEnds, nil
+}
+
+// fcRange is a range of offsets in the WordDocument stream
+type fcRange struct {
+	start, end int
+}
+
+// wordRowEndRuns returns the ranges of the WordDocument stream holding
+// paragraphs that end a table row, in order. Paragraph properties are kept
+// in 512-byte pages of the stream (PapxFkp) listed by the PlcBtePapx in the
+// table stream.
+func wordRowEndRuns(wd, table, data []byte, fcPlcf, lcbPlcf int) ([]fcRange, error) {
+	le := binary.LittleEndian
+	if fcPlcf < 0 || lcbPlcf < 4 || fcPlcf+lcbPlcf > len(table) || (lcbPlcf-4)%8 != 0 {
+		return nil, fmt.Errorf("paragraph properties are out of range")
+	}
+	plc := table[fcPlcf : fcPlcf+lcbPlcf]
+	n := (lcbPlcf - 4) / 8
+
+	var runs []fcRange
+	for i := 0; i < n; i++ {
+		pn := int(le.Uint32(plc[4*(n+1)+4*i:]) & 0x3FFFFF)
+		if (pn+1)*512 > len(wd) {
+			return nil, fmt.Errorf("paragraph properties page %d is out of range", pn)
+		}
+		page := wd[pn*512 : (pn+1)*512]
+		crun := int(page[511])
+		if 4*(crun+1)+13*crun > 511 {
+			return nil, fmt.Errorf("paragraph properties page %d is invalid", pn)
+		}
+		for j := 0; j < crun; j++ {
+			// Runs without properties have an offset of 0
+			off := 2 * int(page[4*(crun+1)+13*j])
+			if off == 0 {
+				continue
+			}
+			grpprl, ok := papxGrpprl(page, off)
+			if !ok {
+				return nil, fmt.Errorf("paragraph properties page %d is invalid", pn)
+			}
+			if wordRowEnd(grpprl, data) {
+				runs = append(runs, fcRange{int(le.Uint32(page[4*j:])), int(le.Uint32(page[4*(j+1):]))})
+			}
+		}
+	}
+	return runs, nil
+}
+
+// Helper to get the property modifiers of a PapxInFkp at off in its page,
+// without the style index before them
+func papxGrpprl(page []byte, off int) ([]byte, bool) {
+	if off+1 >= 511 {
+		return nil, false
+	}
+	start, size := off+1, 2*int(page[off])-1
+	if page[off] == 0 {
+		start, size = off+2, 2*int(page[off+1])
+	}
+	if size < 2 || start+size > 511 {
+		return nil, false
+	}
+	return page[start+2 : start+size], true
+}
+
+// Property modifiers (sprms) read from paragraph properties
+const (
+	sprmPFTtp     = 0x2417 // the paragraph ends a table row
+	sprmPHugePapx = 0x6646 // the properties are in the data stream
+	sprmPChgTabs  = 0xC615
+	sprmTDefTable = 0xD608
+)
+
+// wordRowEnd tells whether paragraph properties mark the end of a table
+// row. Properties too large for their page are stored in the data stream,
+// which is only looked at when data is set.
+func wordRowEnd(grpprl, data []byte) bool {
+	le := binary.LittleEndian
+	for i := 0; i+2 <= len(grpprl); {
+		sprm := le.Uint16(grpprl[i:])
+		i += 2
+		size := sprmOperandSize(sprm, grpprl[i:])
+		if size <= 0 || i+size > len(grpprl) {
+			return false
+		}
+		operand := grpprl[i : i+size]
+		switch sprm {
+		case sprmPFTtp:
+			if operand[0] != 0 {
+				return true
+			}
+		case sprmPHugePapx:
+			off := int(le.Uint32(operand))
+			if data != nil && off >= 0 && off+2 <= len(data) {
+				if cb := int(le.Uint16(data[off:])); off+2+cb <= len(data) && wordRowEnd(data[off+2:off+2+cb], nil) {
+					return true
+				}
+			}
+		}
+		i += size
+	}
+	return false
+}
+
+// Helper to get the size of the operand of a sprm from its spra bits, or
+// from the operand itself for variable-length ones. It returns -1 if the
+// operand is truncated.
+func sprmOperandSize(sprm uint16, operand []byte) int {
+	switch sprm >> 13 {
+	case 0, 1:
+		return 1
+	case 2, 4, 5:
+		return 2
+	case 3:
+		return 4
+	case 7:
+		return 3
+	}
+	if len(operand) < 1 {
+		return -1
+	}
+	switch {
+	case sprm == sprmTDefTable:
+		// The size takes two bytes and counts itself as one
+		if len(operand) < 2 {
+			return -1
+		}
+		return 1 + int(binary.LittleEndian.Uint16(operand))
+	case sprm == sprmPChgTabs && operand[0] == 255:
+		// Tabs deleted with their close positions, then tabs added
+		if len(operand) < 2 {
+			return -1
+		}
+		dels := 2 + 4*int(operand[1])
+		if len(operand) <= dels {
+			return -1
+		}
+		return dels + 1 + 3*int(operand[dels])
+	}
+	return 1 + int(operand[0])
+}
+
+// Helper to find the piece table in the Clx, skipping the property
+// modifiers stored before it
+func findPlcPcd(clx []byte) ([]byte, error) {
+	le := binary.LittleEndian
+	for i := 0; i < len(clx); {
+		switch clx[i] {
+		case 0x01: // Prc
+			if i+3 > len(clx) {
+				return nil, fmt.Errorf("piece table is truncated")
+			}
+			i += 3 + int(le.Uint16(clx[i+1:]))
+		case 0x02: // Pcdt
+			if i+5 > len(clx) {
+				return nil, fmt.Errorf("piece table is truncated")
+			}
+			lcb := int(le.Uint32(clx[i+1:]))
+			if lcb < 4 || i+5+lcb > len(clx) || (lcb-4)%12 != 0 {
+				return nil, fmt.Errorf("piece table is truncated")
+			}
+			return clx[i+5 : i+5+lcb], nil
+		default:
+			return nil, fmt.Errorf("invalid piece table entry %#x", clx[i])
+		}
+	}
+	return nil, fmt.Errorf("piece table not found")
+}
+
+// Characters of the 0x80-0x9F range of cp1252, the rest matches Latin-1
+var cp1252High = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+func decodeCp1252(b []byte) []rune {
+	out := make([]rune, len(b))
+	for i, c := range b {
+		if c >= 0x80 && c < 0xA0 {
+			out[i] = cp1252High[c-0x80]
+		} else {
+			out[i] = rune(c)
+		}
+	}
+	return out
+}
+
+// cleanWordText turns the characters of a Word document into plain text.
+// Paragraph, line and page breaks become newlines and table cells are
+// separated by tabs with a newline after each row, at the cell marks listed
+// in rowEnds. Without them a cell mark right after another is taken for the
+// end of the row, which misreads empty cells. Of fields only the result is
+// kept, not the field code, and anchors of pictures, footnotes and other
+// objects are dropped.
+func cleanWordText(raw []rune, rowEnds map[int]bool) string {
+	var sb strings.Builder
+	// One entry per open field, true while in its code part
+	var fields []bool
+	inCode := func() bool {
+		for _, code := range fields {
+			if code {
+				return true
+			}
+		}
+		return false
+	}
+
+	cellEnded := false
+	for i, r := range raw {
+		switch r {
+		case 0x13: // field begin
+			fields = append(fields, true)
+		case 0x14: // field separator
+			if len(fields) > 0 {
+				fields[len(fields)-1] = false
+			}
+		case 0x15: // field end
+			if len(fields) > 0 {
+				fields = fields[:len(fields)-1]
+			}
+		default:
+			if inCode() {
+				break
+			}
+			switch {
+			case r == '\r' || r == 0x0B || r == 0x0C:
+				sb.WriteByte('\n')
+			case r == 0x07 && rowEnds != nil:
+				if rowEnds[i] {
+					sb.WriteByte('\n')
+				} else {
+					sb.WriteByte('\t')
+				}
+			case r == 0x07:
+				// Guess that a cell mark right after the one of the last
+				// cell ends the row
+				if cellEnded {
+					sb.WriteByte('\n')
+				} else {
+					sb.WriteByte('\t')
+				}
+				cellEnded = !cellEnded
+				continue
+			case r == 0x1E: // non-breaking hyphen
+				sb.WriteByte('-')
+			case r == 0xA0:
+				sb.WriteByte(' ')
+			case r == '\t' || r >= 0x20:
+				sb.WriteRune(r)
+			}
+		}
+		cellEnded = false
+	}
+	return sb.String()
+}
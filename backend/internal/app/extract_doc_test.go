@@ -0,0 +1,351 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// A piece of the text of a test document, stored at offset in the
+// WordDocument stream either as cp1252 or as UTF-16
+type testPiece struct {
+	text       string
+	offset     int
+	compressed bool
+}
+
+// buildWord97 builds a Word 97 document whose piece table lists the pieces
+// in order. The pieces may be stored anywhere after the FIB, as in a
+// fast-saved file, and characters past ccpText belong to subdocuments. The
+// characters at the positions in rowEnds get the paragraph properties of a
+// table row end.
+func buildWord97(flags uint16, pieces []testPiece, ccpText int, rowEnds ...int) []byte {
+	le := binary.LittleEndian
+	wd := make([]byte, 1024)
+	le.PutUint16(wd, wordIdent)
+	le.PutUint16(wd[2:], nFibWord97)
+	le.PutUint16(wd[0x0A:], flags|fibWhichTblStm)
+
+	// FibBase is followed by rgW, rgLw and rgFcLcb, each after its count
+	off := 32
+	le.PutUint16(wd[off:], 14)
+	off += 2 + 14*2
+	le.PutUint16(wd[off:], 22)
+	rgLw := off + 2
+	le.PutUint32(wd[rgLw+4*ccpTextIndex:], uint32(ccpText))
+	off = rgLw + 22*4
+	le.PutUint16(wd[off:], 93)
+	rgFcLcb := off + 2
+
+	// A property modifier before the piece table, as Word writes
+	clx := []byte{0x01, 0x02, 0x00, 0xAA, 0xBB}
+	var cps, pcds []byte
+	var marks []fcRange // of the row ends
+	cp := 0
+	for _, p := range pieces {
+		cps = le.AppendUint32(cps, uint32(cp))
+		var fc uint32
+		width, count := 1, len(encodeCp1252(p.text))
+		if p.compressed {
+			fc = uint32(p.offset*2) | fcCompressedBit
+		} else {
+			fc = uint32(p.offset)
+			width, count = 2, len(utf16.Encode([]rune(p.text)))
+		}
+		for _, end := range rowEnds {
+			if end >= cp && end < cp+count {
+				start := p.offset + width*(end-cp)
+				marks = append(marks, fcRange{start, start + width})
+			}
+		}
+		cp += count
+		pcds = append(pcds, 0, 0)
+		pcds = le.AppendUint32(pcds, fc)
+		pcds = append(pcds, 0, 0)
+
+		var stored []byte
+		if p.compressed {
+			stored = encodeCp1252(p.text)
+		} else {
+			for _, u := range utf16.Encode([]rune(p.text)) {
+				stored = le.AppendUint16(stored, u)
+			}
+		}
+		if end := p.offset + len(stored); end > len(wd) {
+			wd = append(wd, make([]byte, end-len(wd))...)
+		}
+		copy(wd[p.offset:], stored)
+	}
+	cps = le.AppendUint32(cps, uint32(cp))
+	plcPcd := append(cps, pcds...)
+
+	// One page of paragraph properties, with runs ending at each row end
+	// and runs without properties in between. Row ends have table
+	// properties before sprmPFTtp, as Word writes them.
+	sort.Slice(marks, func(i, j int) bool { return marks[i].start < marks[j].start })
+	end := len(wd)
+	pn := (len(wd) + 511) / 512
+	wd = append(wd, make([]byte, (pn+1)*512-len(wd))...)
+	page := wd[pn*512:]
+	rgfc, ttp := []int{0}, []bool{}
+	for _, m := range marks {
+		if m.start > rgfc[len(rgfc)-1] {
+			rgfc, ttp = append(rgfc, m.start), append(ttp, false)
+		}
+		rgfc, ttp = append(rgfc, m.end), append(ttp, true)
+	}
+	if end > rgfc[len(rgfc)-1] {
+		rgfc, ttp = append(rgfc, end), append(ttp, false)
+	}
+	for i, fc := range rgfc {
+		le.PutUint32(page[4*i:], uint32(fc))
+	}
+	copy(page[494:], []byte{0, 7, 0, 0, 0x16, 0x24, 1, 0x08, 0xD6, 3, 0, 0, 0, 0x17, 0x24, 1})
+	for i := range ttp {
+		if ttp[i] {
+			page[4*len(rgfc)+13*i] = 494 / 2
+		}
+	}
+	page[511] = byte(len(ttp))
+	clx = append(clx, 0x02)
+	clx = le.AppendUint32(clx, uint32(len(plcPcd)))
+	clx = append(clx, plcPcd...)
+
+	table := append(make([]byte, 16), clx...)
+	le.PutUint32(wd[rgFcLcb+8*fcClxIndex:], 16)
+	le.PutUint32(wd[rgFcLcb+8*fcClxIndex+4:], uint32(len(clx)))
+	le.PutUint32(wd[rgFcLcb+8*fcBtePapxIndex:], uint32(len(table)))
+	le.PutUint32(wd[rgFcLcb+8*fcBtePapxIndex+4:], 12)
+	table = le.AppendUint32(table, 0)
+	table = le.AppendUint32(table, uint32(end))
+	table = le.AppendUint32(table, uint32(pn))
+
+	return buildCFB(testStream{"WordDocument", wd}, testStream{"1Table", table})
+}
+
+// Helper to encode test text as cp1252, the text only uses characters of it
+func encodeCp1252(s string) []byte {
+	var out []byte
+	for _, r := range s {
+		c := byte(r)
+		for i, h := range cp1252High {
+			if h == r {
+				c = byte(0x80 + i)
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func TestWordDocumentText(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   uint16
+		pieces  []testPiece
+		ccpText int
+		rowEnds []int // character positions, of UTF-16 units
+		want    string
+		// Rune indexes, a surrogate pair is one rune
+		wantRowEnds []int
+		wantErr     string
+	}{
+		{
+			name:    "single piece",
+			pieces:  []testPiece{{"Hello world.\r", 1024, true}},
+			ccpText: 13,
+			want:    "Hello world.\r",
+		},
+		{
+			name:  "fast-saved",
+			flags: fibComplex,
+			pieces: []testPiece{
+				{"Hello world.\r", 1200, true},
+				{"Слово\r", 1024, false},
+				{"“Hi” – €5\r", 1100, true},
+				{"Footnote\r", 1300, true},
+			},
+			ccpText: 13 + 6 + 10,
+			want:    "Hello world.\rСлово\r“Hi” – €5\r",
+		},
+		{
+			name: "table rows",
+			pieces: []testPiece{
+				{"a\x07\x07b\x07\x07", 1024, true},
+				{"😀\x07\x07\r", 1100, false},
+			},
+			ccpText:     6 + 5,
+			rowEnds:     []int{5, 9},
+			want:        "a\x07\x07b\x07\x07😀\x07\x07\r",
+			wantRowEnds: []int{5, 8},
+		},
+		{
+			name:    "piece past the stream",
+			pieces:  []testPiece{{"Hello", 1024, true}},
+			ccpText: 10,
+			want:    "Hello",
+		},
+		{
+			name:    "encrypted",
+			flags:   fibEncrypted,
+			pieces:  []testPiece{{"secret", 1024, true}},
+			ccpText: 6,
+			wantErr: "encrypted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf, err := openCFB(buildWord97(tt.flags, tt.pieces, tt.ccpText, tt.rowEnds...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, rowEnds, err := wordDocumentText(cf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("wordDocumentText() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("wordDocumentText() = %q, want %q", string(got), tt.want)
+			}
+			wantRowEnds := make(map[int]bool)
+			for _, i := range tt.wantRowEnds {
+				wantRowEnds[i] = true
+			}
+			if fmt.Sprint(rowEnds) != fmt.Sprint(wantRowEnds) {
+				t.Errorf("wordDocumentText() row ends = %v, want %v", rowEnds, wantRowEnds)
+			}
+		})
+	}
+}
+
+func TestWordDocumentTextPieceOutOfRange(t *testing.T) {
+	data := buildWord97(0, []testPiece{{"Hello", 1024, false}}, 5)
+	// Point the piece past the end of the WordDocument stream. Its file
+	// offset follows the property modifier, the Pcdt header, two character
+	// positions and the flags of the piece.
+	clx := bytes.Index(data, []byte{0x01, 0x02, 0x00, 0xAA, 0xBB})
+	binary.LittleEndian.PutUint32(data[clx+5+5+8+2:], 4000)
+	cf, err := openCFB(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := wordDocumentText(cf); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("wordDocumentText() error = %v, want out of range", err)
+	}
+}
+
+func TestWordDocumentTextWord95(t *testing.T) {
+	le := binary.LittleEndian
+	build := func(flags uint16) *cfbFile {
+		wd := make([]byte, 0x200)
+		le.PutUint16(wd, wordIdent)
+		le.PutUint16(wd[2:], 0x0065)
+		le.PutUint16(wd[0x0A:], flags)
+		le.PutUint32(wd[0x18:], 0x100)
+		le.PutUint32(wd[0x34:], 10)
+		copy(wd[0x100:], encodeCp1252("Café – ok\r"))
+		cf, err := openCFB(buildCFB(testStream{"WordDocument", wd}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cf
+	}
+
+	got, rowEnds, err := wordDocumentText(build(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Café – ok\r"; string(got) != want {
+		t.Errorf("wordDocumentText() = %q, want %q", string(got), want)
+	}
+	if rowEnds != nil {
+		t.Errorf("wordDocumentText() row ends = %v, want nil without paragraph properties", rowEnds)
+	}
+
+	if _, _, err := wordDocumentText(build(fibComplex)); err == nil || !strings.Contains(err.Error(), "fast-saved") {
+		t.Errorf("wordDocumentText() error = %v, want fast-saved error", err)
+	}
+}
+
+func TestCleanWordText(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		rowEnds map[int]bool
+		want    string
+	}{
+		{"paragraphs", "One\rTwo\vThree\fFour", nil, "One\nTwo\nThree\nFour"},
+		{"field result", "See \x13 HYPERLINK \"http://x\" \x14the site\x15.", nil, "See the site."},
+		{"field without result", "Page \x13 PAGE \x15.", nil, "Page ."},
+		{"nested fields", "\x13 IF \x13 DATE \x14today\x15 \x14yes\x15", nil, "yes"},
+		{"table row", "a\x07b\x07\x07next", map[int]bool{4: true}, "a\tb\t\nnext"},
+		{"empty cells", "a\x07\x07b\x07\x07\x07\x07c\x07\x07", map[int]bool{5: true, 10: true}, "a\t\tb\t\n\t\tc\t\n"},
+		{"row end guessed", "a\x07b\x07\x07next", nil, "a\tb\t\nnext"},
+		{"special characters", "non\x1Ebreaking space\x01\x08", nil, "non-breaking space"},
+	}
+
+	for _, tt := range tests {
+		if got := cleanWordText([]rune(tt.raw), tt.rowEnds); got != tt.want {
+			t.Errorf("%s: cleanWordText() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWordRowEnd(t *testing.T) {
+	// Properties of a row end moved to the data stream, after padding
+	data := append([]byte{0xFF, 0xFF}, 3, 0, 0x17, 0x24, 1)
+
+	tests := []struct {
+		name   string
+		grpprl []byte
+		want   bool
+	}{
+		{"row end", []byte{0x17, 0x24, 1}, true},
+		{"cleared", []byte{0x17, 0x24, 0}, false},
+		{"cell", []byte{0x16, 0x24, 1}, false},
+		{"after table definition", []byte{0x08, 0xD6, 4, 0, 9, 9, 9, 0x17, 0x24, 1}, true},
+		{"after two-byte operand", []byte{0x0F, 0x44, 1, 2, 0x17, 0x24, 1}, true},
+		{"after variable operand", []byte{0x0D, 0xC6, 2, 9, 9, 0x17, 0x24, 1}, true},
+		{"after complex tabs", []byte{0x15, 0xC6, 255, 1, 9, 9, 9, 9, 1, 9, 9, 9, 0x17, 0x24, 1}, true},
+		{"truncated operand", []byte{0x08, 0xD6, 40, 0, 0x17, 0x24, 1}, false},
+		{"in the data stream", []byte{0x46, 0x66, 2, 0, 0, 0}, true},
+		{"data stream out of range", []byte{0x46, 0x66, 200, 0, 0, 0}, false},
+	}
+	for _, tt := range tests {
+		if got := wordRowEnd(tt.grpprl, data); got != tt.want {
+			t.Errorf("%s: wordRowEnd(% x) = %v, want %v", tt.name, tt.grpprl, got, tt.want)
+		}
+	}
+}
+
+func TestExtractDoc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fast.doc")
+	data := buildWord97(fibComplex, []testPiece{
+		{"Title\r\r", 1100, true},
+		{"  Body text\r", 1024, false},
+		{"a\x07\x07b\x07\x07\x07c\x07\x07After\r", 1200, true},
+	}, 7+12+16, 7+12+5, 7+12+9)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := extractDoc(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Title\n\nBody text\n\na\t\tb\n\nc\n\nAfter"; doc.Text != want {
+		t.Errorf("extractDoc() text = %q, want %q", doc.Text, want)
+	}
+}
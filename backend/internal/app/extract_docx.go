@@ -0,0 +1,475 @@
+package app
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WordprocessingML keeps the body of a DOCX file in word/document.xml.
+// Styles, list numbering, footnotes, headers and footers are parts of their
+// own, found through the relationships of the main part.
+
+const (
+	nsWordML        = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	nsMarkupCompat  = "http://schemas.openxmlformats.org/markup-compatibility/2006"
+	docxMaxStyleRef = 10 // length of basedOn chains followed
+)
+
+var docxHeadingRe = regexp.MustCompile(`^(?i:heading)\s*([1-9])$`)
+
+// docxStyle is what we need to know about a paragraph style
+type docxStyle struct {
+	name       string
+	basedOn    string
+	outlineLvl int // 0-based, -1 if not set
+	numID      string
+	ilvl       int
+}
+
+// docxReader renders the parts of a DOCX file to a docBuilder
+type docxReader struct {
+	b      docBuilder
+	styles map[string]docxStyle
+	// List format by numId and level, "bullet" or a numbering format
+	listFormats map[string][]string
+	// Current number of the numbered list levels by numId
+	counters map[string][]int
+	// Text boxes met in the current paragraph, written after it
+	textBoxes []*xmlNode
+}
+
+// extractDocx converts a Word document to Markdown-like text: paragraphs as
+// blocks, headings with their level from the paragraph style, list items as
+// "- item" or "1. item" lines, tables as "| a | b |" rows and footnotes as
+// "[^1]: note" lines at the end. Headers and footers come first.
+func extractDocx(path string) (*extractedDoc, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DOCX file %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	r := &docxReader{counters: make(map[string][]int)}
+	r.b.doc.Title = ooxmlTitle(&zr.Reader)
+	if err := r.read(&zr.Reader); err != nil {
+		return nil, fmt.Errorf("failed to read DOCX file %s: %w", path, err)
+	}
+	return r.b.result(), nil
+}
+
+func (r *docxReader) read(zr *zip.Reader) error {
+	mainPart := ooxmlMainPart(zr, "word/document.xml")
+	doc, err := readZipXML(zr, mainPart)
+	if err != nil {
+		return err
+	}
+	rels, err := ooxmlRels(zr, mainPart)
+	if err != nil {
+		return err
+	}
+	// Styles and numbering only add structure, the text is readable without
+	if rel, ok := ooxmlRelOfType(rels, "styles"); ok {
+		if styles, err := readZipXML(zr, rel.Target); err == nil {
+			r.styles = docxStyles(styles)
+		}
+	}
+	if rel, ok := ooxmlRelOfType(rels, "numbering"); ok {
+		if numbering, err := readZipXML(zr, rel.Target); err == nil {
+			r.listFormats = docxListFormats(numbering)
+		}
+	}
+
+	// Headers and footers are usually shared by all sections, each distinct
+	// one is written once
+	var targets []ooxmlRel
+	for _, rel := range rels {
+		targets = append(targets, rel)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Target < targets[j].Target })
+	seen := make(map[string]bool)
+	for _, typ := range []string{"header", "footer"} {
+		for _, rel := range targets {
+			if path.Base(rel.Type) != typ {
+				continue
+			}
+			part, err := readZipXML(zr, rel.Target)
+			if err != nil {
+				return err
+			}
+			lines := r.lines(part)
+			text := strings.Join(lines, "\n")
+			if text == "" || seen[text] {
+				continue
+			}
+			seen[text] = true
+			label := "Header: "
+			if typ == "footer" {
+				label = "Footer: "
+			}
+			r.b.write(label + text)
+		}
+	}
+
+	body := doc.find(nsWordML, "body")
+	if body == nil {
+		return fmt.Errorf("missing document body")
+	}
+	r.blocks(body)
+
+	// Notes go under a heading of their own so that they aren't counted
+	// as part of the last section
+	var notes []string
+	for _, n := range []struct{ typ, prefix string }{{"footnotes", ""}, {"endnotes", "e"}} {
+		rel, ok := ooxmlRelOfType(rels, n.typ)
+		if !ok {
+			continue
+		}
+		part, err := readZipXML(zr, rel.Target)
+		if err != nil {
+			return err
+		}
+		for _, note := range part.findAll(nsWordML, strings.TrimSuffix(n.typ, "s")) {
+			// Separators and continuation notices aren't notes
+			if typ := note.attr(nsWordML, "type"); typ != "" && typ != "normal" {
+				continue
+			}
+			if text := strings.Join(r.lines(note), " "); text != "" {
+				notes = append(notes, fmt.Sprintf("[^%s%s]: %s", n.prefix, note.attr(nsWordML, "id"), text))
+			}
+		}
+	}
+	if len(notes) > 0 {
+		r.b.doc.Headings = append(r.b.doc.Headings, docHeading{Offset: r.b.offset(), Level: 1, Title: "Notes"})
+		r.b.write("# Notes")
+		r.b.write(strings.Join(notes, "\n"))
+	}
+	return nil
+}
+
+// blocks writes the paragraphs and tables below n
+func (r *docxReader) blocks(n *xmlNode) {
+	var list []string
+	flushList := func() {
+		if len(list) > 0 {
+			r.b.write(strings.Join(list, "\n"))
+			list = nil
+		}
+	}
+
+	for _, c := range n.Children {
+		switch {
+		case c.is(nsWordML, "p"):
+			text := r.paragraphText(c)
+			boxes := r.takeTextBoxes()
+			if text != "" {
+				if level := r.headingLevel(c); level > 0 {
+					flushList()
+					title := tableCell(text)
+					r.b.doc.Headings = append(r.b.doc.Headings, docHeading{Offset: r.b.offset(), Level: level, Title: title})
+					r.b.write(strings.Repeat("#", level) + " " + title)
+				} else if marker, ok := r.listMarker(c); ok {
+					// Consecutive list items make up one block
+					list = append(list, marker+tableCell(text))
+				} else {
+					flushList()
+					r.b.write(text)
+				}
+			}
+			for _, box := range boxes {
+				flushList()
+				r.blocks(box)
+			}
+		case c.is(nsWordML, "tbl"):
+			flushList()
+			if lines := r.tableLines(c); len(lines) > 0 {
+				r.b.write(strings.Join(lines, "\n"))
+			}
+		case c.is(nsWordML, "sectPr"):
+		default:
+			// Content controls, custom XML and the like wrap blocks
+			flushList()
+			r.blocks(c)
+		}
+	}
+	flushList()
+}
+
+// lines returns the paragraphs and table rows below n as lines, for parts
+// where headings and lists don't matter
+func (r *docxReader) lines(n *xmlNode) []string {
+	var lines []string
+	for _, c := range n.Children {
+		switch {
+		case c.is(nsWordML, "p"):
+			if text := collapseSpace(strings.ReplaceAll(r.paragraphText(c), "\n", " ")); text != "" {
+				lines = append(lines, text)
+			}
+			for _, box := range r.takeTextBoxes() {
+				lines = append(lines, r.lines(box)...)
+			}
+		case c.is(nsWordML, "tbl"):
+			lines = append(lines, r.tableLines(c)...)
+		default:
+			lines = append(lines, r.lines(c)...)
+		}
+	}
+	return lines
+}
+
+func (r *docxReader) takeTextBoxes() []*xmlNode {
+	boxes := r.textBoxes
+	r.textBoxes = nil
+	return boxes
+}
+
+// tableLines renders a table as "| a | b |" rows, with a separator after
+// the header row if the table has one
+func (r *docxReader) tableLines(tbl *xmlNode) []string {
+	var lines []string
+	for _, tr := range tbl.Children {
+		if !tr.is(nsWordML, "tr") {
+			continue
+		}
+		var cells []string
+		for _, tc := range tr.findAll(nsWordML, "tc") {
+			// Nested tables are flattened into the cell
+			var parts []string
+			for _, line := range r.lines(tc) {
+				parts = append(parts, strings.Trim(line, "| "))
+			}
+			cells = append(cells, tableCell(strings.Join(parts, " ")))
+		}
+		if strings.TrimSpace(strings.Join(cells, "")) == "" {
+			continue
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if len(lines) == 1 && tr.find(nsWordML, "tblHeader") != nil {
+			lines = append(lines, strings.Repeat("| --- ", len(cells))+"|")
+		}
+	}
+	return lines
+}
+
+// paragraphText returns the text of the runs of a paragraph. Deleted text
+// and field codes are left out, footnote references become "[^1]". Text
+// boxes are kept in r.textBoxes.
+func (r *docxReader) paragraphText(p *xmlNode) string {
+	var sb strings.Builder
+	var walk func(*xmlNode)
+	walk = func(n *xmlNode) {
+		for _, c := range n.Children {
+			if c.Name.Space == nsMarkupCompat && c.Name.Local == "AlternateContent" {
+				// The choices render the same content, the fallback repeats it
+				if choice := c.find(nsMarkupCompat, "Choice"); choice != nil {
+					walk(choice)
+				}
+				continue
+			}
+			if c.Name.Space != nsWordML {
+				walk(c)
+				continue
+			}
+			switch c.Name.Local {
+			case "t":
+				sb.WriteString(c.text())
+			case "tab", "ptab":
+				sb.WriteString("\t")
+			case "br", "cr":
+				sb.WriteString("\n")
+			case "noBreakHyphen":
+				sb.WriteString("-")
+			case "footnoteReference":
+				sb.WriteString("[^" + c.attr(nsWordML, "id") + "]")
+			case "endnoteReference":
+				sb.WriteString("[^e" + c.attr(nsWordML, "id") + "]")
+			case "txbxContent":
+				r.textBoxes = append(r.textBoxes, c)
+			case "del", "delText", "instrText", "pPr", "rPr", "moveFrom":
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(p)
+	return strings.TrimSpace(sb.String())
+}
+
+// headingLevel returns the heading level of a paragraph, 0 for body text.
+// It comes from the outline level of the paragraph or its style, or from
+// the name of the style for documents that don't set one.
+func (r *docxReader) headingLevel(p *xmlNode) int {
+	pPr := docxChild(p, "pPr")
+	if lvl := docxChild(pPr, "outlineLvl"); lvl != nil {
+		if n, err := strconv.Atoi(lvl.attr(nsWordML, "val")); err == nil && n < 9 {
+			return n + 1
+		}
+		return 0
+	}
+	id := ""
+	if ps := docxChild(pPr, "pStyle"); ps != nil {
+		id = ps.attr(nsWordML, "val")
+	}
+	if id == "" {
+		return 0
+	}
+	for i := 0; i < docxMaxStyleRef; i++ {
+		s, ok := r.styles[id]
+		if !ok {
+			// Without styles.xml the ID is all we have
+			return docxStyleLevel(id)
+		}
+		if s.outlineLvl >= 0 {
+			if s.outlineLvl < 9 {
+				return s.outlineLvl + 1
+			}
+			return 0
+		}
+		if level := docxStyleLevel(s.name); level > 0 {
+			return level
+		}
+		if s.basedOn == "" {
+			break
+		}
+		id = s.basedOn
+	}
+	return 0
+}
+
+// Helper to get the heading level implied by a style name
+func docxStyleLevel(name string) int {
+	if strings.EqualFold(name, "Title") {
+		return 1
+	}
+	if m := docxHeadingRe.FindStringSubmatch(name); m != nil {
+		level, _ := strconv.Atoi(m[1])
+		return level
+	}
+	return 0
+}
+
+// listMarker returns the marker of a list item, "- " or "1. " indented by
+// its level, and false for paragraphs that aren't list items
+func (r *docxReader) listMarker(p *xmlNode) (string, bool) {
+	numID, ilvl := "", 0
+	pPr := docxChild(p, "pPr")
+	if numPr := docxChild(pPr, "numPr"); numPr != nil {
+		if n := docxChild(numPr, "numId"); n != nil {
+			numID = n.attr(nsWordML, "val")
+		}
+		if n := docxChild(numPr, "ilvl"); n != nil {
+			ilvl, _ = strconv.Atoi(n.attr(nsWordML, "val"))
+		}
+	} else if ps := docxChild(pPr, "pStyle"); ps != nil {
+		s := r.styles[ps.attr(nsWordML, "val")]
+		numID, ilvl = s.numID, s.ilvl
+	}
+	// numId 0 removes the numbering of the style
+	if numID == "" || numID == "0" || ilvl < 0 || ilvl > 8 {
+		return "", false
+	}
+
+	indent := strings.Repeat("  ", ilvl)
+	format := "bullet"
+	if formats := r.listFormats[numID]; ilvl < len(formats) {
+		format = formats[ilvl]
+	}
+	if format == "none" {
+		return indent, true
+	}
+	if format == "bullet" {
+		return indent + "- ", true
+	}
+
+	// Counting restarts for deeper levels whenever a level goes on
+	counters := r.counters[numID]
+	for len(counters) <= ilvl {
+		counters = append(counters, 0)
+	}
+	counters[ilvl]++
+	for i := ilvl + 1; i < len(counters); i++ {
+		counters[i] = 0
+	}
+	r.counters[numID] = counters
+	return indent + strconv.Itoa(counters[ilvl]) + ". ", true
+}
+
+// docxStyles reads the paragraph styles of styles.xml by ID
+func docxStyles(root *xmlNode) map[string]docxStyle {
+	styles := make(map[string]docxStyle)
+	for _, st := range root.findAll(nsWordML, "style") {
+		if st.attr(nsWordML, "type") != "paragraph" {
+			continue
+		}
+		s := docxStyle{outlineLvl: -1}
+		if n := docxChild(st, "name"); n != nil {
+			s.name = n.attr(nsWordML, "val")
+		}
+		if n := docxChild(st, "basedOn"); n != nil {
+			s.basedOn = n.attr(nsWordML, "val")
+		}
+		pPr := docxChild(st, "pPr")
+		if n := docxChild(pPr, "outlineLvl"); n != nil {
+			if lvl, err := strconv.Atoi(n.attr(nsWordML, "val")); err == nil {
+				s.outlineLvl = lvl
+			}
+		}
+		if numPr := docxChild(pPr, "numPr"); numPr != nil {
+			if n := docxChild(numPr, "numId"); n != nil {
+				s.numID = n.attr(nsWordML, "val")
+			}
+			if n := docxChild(numPr, "ilvl"); n != nil {
+				s.ilvl, _ = strconv.Atoi(n.attr(nsWordML, "val"))
+			}
+		}
+		styles[st.attr(nsWordML, "styleId")] = s
+	}
+	return styles
+}
+
+// docxListFormats reads the number format of each level of each list in
+// numbering.xml
+func docxListFormats(root *xmlNode) map[string][]string {
+	abstract := make(map[string][]string)
+	for _, an := range root.findAll(nsWordML, "abstractNum") {
+		var formats []string
+		for _, lvl := range an.findAll(nsWordML, "lvl") {
+			i, err := strconv.Atoi(lvl.attr(nsWordML, "ilvl"))
+			if err != nil || i < 0 || i > 8 {
+				continue
+			}
+			for len(formats) <= i {
+				formats = append(formats, "bullet")
+			}
+			if f := docxChild(lvl, "numFmt"); f != nil {
+				formats[i] = f.attr(nsWordML, "val")
+			}
+		}
+		abstract[an.attr(nsWordML, "abstractNumId")] = formats
+	}
+
+	formats := make(map[string][]string)
+	for _, num := range root.findAll(nsWordML, "num") {
+		if a := docxChild(num, "abstractNumId"); a != nil {
+			formats[num.attr(nsWordML, "numId")] = abstract[a.attr(nsWordML, "val")]
+		}
+	}
+	return formats
+}
+
+// Helper to get a direct child element, nil if n is nil or has none
+func docxChild(n *xmlNode, local string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		if c.is(nsWordML, local) {
+			return c
+		}
+	}
+	return nil
+}
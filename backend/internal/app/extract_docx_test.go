@@ -0,0 +1,185 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+)
+
+const docxRelTypes = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+
+// writeTestDocx writes a DOCX file with the given body and the styles and
+// numbering below, plus any extra parts related to the main part
+func writeTestDocx(t *testing.T, body string, extra map[string]string) string {
+	t.Helper()
+	rels := `<Relationships xmlns="` + nsPackageRels + `">
+		<Relationship Id="rId1" Type="` + docxRelTypes + `styles" Target="styles.xml"/>
+		<Relationship Id="rId2" Type="` + docxRelTypes + `numbering" Target="numbering.xml"/>`
+	parts := map[string]string{
+		"word/document.xml": `<w:document xmlns:w="` + nsWordML + `" xmlns:mc="` + nsMarkupCompat + `"><w:body>` +
+			body + `<w:sectPr/></w:body></w:document>`,
+		"word/styles.xml": `<w:styles xmlns:w="` + nsWordML + `">
+			<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/></w:style>
+			<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/></w:style>
+			<w:style w:type="paragraph" w:styleId="Chapter"><w:name w:val="Chapter"/><w:basedOn w:val="Heading2"/></w:style>
+			<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/></w:style>
+			<w:style w:type="paragraph" w:styleId="ListNumber"><w:name w:val="List Number"/>
+				<w:pPr><w:numPr><w:numId w:val="1"/></w:numPr></w:pPr></w:style>
+		</w:styles>`,
+		"word/numbering.xml": `<w:numbering xmlns:w="` + nsWordML + `">
+			<w:abstractNum w:abstractNumId="0">
+				<w:lvl w:ilvl="0"><w:numFmt w:val="decimal"/></w:lvl>
+				<w:lvl w:ilvl="1"><w:numFmt w:val="lowerLetter"/></w:lvl>
+				<w:lvl w:ilvl="2"><w:numFmt w:val="bullet"/></w:lvl>
+			</w:abstractNum>
+			<w:abstractNum w:abstractNumId="1"><w:lvl w:ilvl="0"><w:numFmt w:val="bullet"/></w:lvl></w:abstractNum>
+			<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>
+			<w:num w:numId="2"><w:abstractNumId w:val="1"/></w:num>
+		</w:numbering>`,
+	}
+	i := 3
+	for name, content := range extra {
+		typ := name[len("word/"):]
+		typ = typ[:len(typ)-len("1.xml")]
+		rels += fmt.Sprintf(`<Relationship Id="rId%d" Type="%s%s" Target="%s"/>`, i, docxRelTypes, typ, name[len("word/"):])
+		parts[name] = content
+		i++
+	}
+	parts["word/_rels/document.xml.rels"] = rels + `</Relationships>`
+	return writeTestZip(t, "test.docx", parts)
+}
+
+// Helpers to write test paragraphs
+func docxPara(pPr, text string) string {
+	return `<w:p><w:pPr>` + pPr + `</w:pPr><w:r><w:t xml:space="preserve">` + text + `</w:t></w:r></w:p>`
+}
+
+func docxItem(numID, ilvl int, text string) string {
+	return docxPara(fmt.Sprintf(`<w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr>`, ilvl, numID), text)
+}
+
+func TestExtractDocx(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		extra map[string]string
+		want  string
+	}{
+		{
+			name: "nested numbering",
+			body: docxItem(1, 0, "First") +
+				docxItem(1, 1, "Sub a") +
+				docxItem(1, 2, "Point") +
+				docxItem(1, 1, "Sub b") +
+				docxItem(1, 0, "Second") +
+				docxItem(1, 1, "Sub again") +
+				docxPara(`<w:pStyle w:val="ListNumber"/>`, "Styled") +
+				docxItem(2, 0, "Bullet") +
+				docxPara(`<w:pStyle w:val="ListNumber"/><w:numPr><w:numId w:val="0"/></w:numPr>`, "Not a list"),
+			want: "1. First\n  1. Sub a\n    - Point\n  2. Sub b\n2. Second\n  1. Sub again\n3. Styled\n- Bullet\n\nNot a list",
+		},
+		{
+			name: "list split by a paragraph",
+			body: docxItem(1, 0, "One") + docxPara("", "Between") + docxItem(1, 0, "Two"),
+			want: "1. One\n\nBetween\n\n2. Two",
+		},
+		{
+			name: "headings",
+			body: docxPara(`<w:pStyle w:val="Heading1"/>`, "Top") +
+				docxPara(`<w:pStyle w:val="Chapter"/>`, "Based on heading 2") +
+				docxPara(`<w:outlineLvl w:val="2"/>`, "Outline level") +
+				docxPara(`<w:pStyle w:val="Title"/>`, "No style entry") +
+				docxPara(`<w:pStyle w:val="Quote"/>`, "Body text"),
+			want: "# Top\n\n## Based on heading 2\n\n### Outline level\n\n# No style entry\n\nBody text",
+		},
+		{
+			name: "runs",
+			body: `<w:p><w:r><w:t>kept</w:t></w:r><w:del><w:r><w:delText>gone</w:delText></w:r></w:del>` +
+				`<w:r><w:instrText> PAGE </w:instrText></w:r><w:r><w:tab/><w:t>tab</w:t><w:br/><w:t>non</w:t><w:noBreakHyphen/><w:t>breaking</w:t></w:r>` +
+				`<w:r><w:footnoteReference w:id="2"/></w:r></w:p>`,
+			extra: map[string]string{
+				"word/footnotes1.xml": `<w:footnotes xmlns:w="` + nsWordML + `">
+					<w:footnote w:type="separator" w:id="0"><w:p><w:r><w:t>---</w:t></w:r></w:p></w:footnote>
+					<w:footnote w:id="2"><w:p><w:r><w:t>A note.</w:t></w:r></w:p></w:footnote>
+				</w:footnotes>`,
+			},
+			want: "kept\ttab\nnon-breaking[^2]\n\n# Notes\n\n[^2]: A note.",
+		},
+		{
+			name: "table with header row",
+			body: `<w:tbl>
+				<w:tr><w:trPr><w:tblHeader/></w:trPr><w:tc><w:p><w:r><w:t>Item</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Qty</w:t></w:r></w:p></w:tc></w:tr>
+				<w:tr><w:tc><w:p><w:r><w:t>Bolt</w:t></w:r></w:p><w:p><w:r><w:t>M4</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>10</w:t></w:r></w:p></w:tc></w:tr>
+				<w:tr><w:tc><w:p/></w:tc><w:tc><w:p/></w:tc></w:tr>
+			</w:tbl>`,
+			want: "| Item | Qty |\n| --- | --- |\n| Bolt M4 | 10 |",
+		},
+		{
+			name: "text box and alternate content",
+			body: `<w:p><w:r><w:t>Before</w:t></w:r><w:r><mc:AlternateContent>
+				<mc:Choice><w:drawing><w:txbxContent><w:p><w:r><w:t>Boxed</w:t></w:r></w:p></w:txbxContent></w:drawing></mc:Choice>
+				<mc:Fallback><w:pict><w:txbxContent><w:p><w:r><w:t>Boxed</w:t></w:r></w:p></w:txbxContent></w:pict></mc:Fallback>
+			</mc:AlternateContent></w:r></w:p>`,
+			want: "Before\n\nBoxed",
+		},
+		{
+			name: "headers and footers",
+			body: docxPara("", "Body"),
+			extra: map[string]string{
+				"word/header1.xml": `<w:hdr xmlns:w="` + nsWordML + `"><w:p><w:r><w:t>ACME Corp</w:t></w:r></w:p></w:hdr>`,
+				"word/header2.xml": `<w:hdr xmlns:w="` + nsWordML + `"><w:p><w:r><w:t>ACME Corp</w:t></w:r></w:p></w:hdr>`,
+				"word/footer1.xml": `<w:ftr xmlns:w="` + nsWordML + `"><w:p><w:r><w:t>Confidential</w:t></w:r></w:p></w:ftr>`,
+			},
+			want: "Header: ACME Corp\n\nFooter: Confidential\n\nBody",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := extractDocx(writeTestDocx(t, tt.body, tt.extra))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Text != tt.want {
+				t.Errorf("extractDocx() text =\n%q\nwant\n%q", doc.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractDocxHeadings(t *testing.T) {
+	body := docxPara(`<w:pStyle w:val="Heading1"/>`, "Intro") + docxPara("", "Text") +
+		docxPara(`<w:pStyle w:val="Heading2"/>`, "Scope")
+	doc, err := extractDocx(writeTestDocx(t, body, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []docHeading{{Offset: 0, Level: 1, Title: "Intro"}, {Offset: 15, Level: 2, Title: "Scope"}}
+	if len(doc.Headings) != len(want) {
+		t.Fatalf("Headings = %+v, want %+v", doc.Headings, want)
+	}
+	for i := range want {
+		if doc.Headings[i] != want[i] {
+			t.Errorf("heading %d = %+v, want %+v", i, doc.Headings[i], want[i])
+		}
+	}
+}
+
+func TestDocxStyleLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"heading 1", 1},
+		{"Heading3", 3},
+		{"HEADING 9", 9},
+		{"Title", 1},
+		{"heading 10", 0},
+		{"Subheading 2", 0},
+		{"Normal", 0},
+	}
+	for _, tt := range tests {
+		if got := docxStyleLevel(tt.name); got != tt.want {
+			t.Errorf("docxStyleLevel(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
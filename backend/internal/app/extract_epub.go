@@ -0,0 +1,237 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// An EPUB is a zip file whose container.xml points to the package document
+// (OPF). Its manifest lists the files of the book and its spine the order
+// in which they're read. Chapter titles come from the table of contents,
+// the navigation document of EPUB 3 or the NCX of EPUB 2.
+
+const (
+	nsContainer = "urn:oasis:names:tc:opendocument:xmlns:container"
+	nsOPF       = "http://www.idpf.org/2007/opf"
+	nsNCX       = "http://www.daisy.org/z3986/2005/ncx/"
+)
+
+type epubItem struct {
+	href       string // path in the zip file
+	mediaType  string
+	properties string
+}
+
+// extractEPUB extracts the chapters of an e-book in reading order. Each
+// chapter is converted like an HTML page and starts with a heading named
+// after its entry in the table of contents, with the chapter's own
+// headings nested below.
+func extractEPUB(path string) (*extractedDoc, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPUB file %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	var b docBuilder
+	if err := writeEPUB(&zr.Reader, &b); err != nil {
+		return nil, fmt.Errorf("failed to read EPUB file %s: %w", path, err)
+	}
+	return b.result(), nil
+}
+
+func writeEPUB(zr *zip.Reader, b *docBuilder) error {
+	container, err := readZipXML(zr, "META-INF/container.xml")
+	if err != nil {
+		return err
+	}
+	rootfile := container.find(nsContainer, "rootfile")
+	if rootfile == nil {
+		return fmt.Errorf("no package document in container.xml")
+	}
+	opfPath := rootfile.attr("", "full-path")
+	opf, err := readZipXML(zr, opfPath)
+	if err != nil {
+		return err
+	}
+
+	if meta := opf.find(nsOPF, "metadata"); meta != nil {
+		if t := meta.find(nsDublinCore, "title"); t != nil {
+			b.doc.Title = tableCell(t.text())
+		}
+		if c := meta.find(nsDublinCore, "creator"); c != nil {
+			b.doc.Author = tableCell(c.text())
+		}
+		if d := meta.find(nsDublinCore, "date"); d != nil {
+			b.doc.Created, _ = parseISODate(d.text())
+		}
+		for _, m := range meta.findAll(nsOPF, "meta") {
+			if m.attr("", "property") == "dcterms:modified" {
+				b.doc.Updated, _ = parseISODate(m.text())
+			}
+		}
+	}
+
+	items := make(map[string]epubItem)
+	for _, it := range opf.findAll(nsOPF, "item") {
+		items[it.attr("", "id")] = epubItem{
+			href:       epubPath(opfPath, it.attr("", "href")),
+			mediaType:  it.attr("", "media-type"),
+			properties: it.attr("", "properties"),
+		}
+	}
+	spine := opf.find(nsOPF, "spine")
+	if spine == nil {
+		return fmt.Errorf("package document has no spine")
+	}
+
+	// Titles of the chapters by file, the table of contents is optional
+	titles := make(map[string]string)
+	for _, it := range items {
+		if strings.Contains(" "+it.properties+" ", " nav ") {
+			epubNavTitles(zr, it.href, titles)
+		}
+	}
+	if ncx, ok := items[spine.attr("", "toc")]; ok && len(titles) == 0 {
+		epubNCXTitles(zr, ncx.href, titles)
+	}
+
+	for _, ref := range spine.findAll(nsOPF, "itemref") {
+		it, ok := items[ref.attr("", "idref")]
+		if !ok || (it.mediaType != "application/xhtml+xml" && it.mediaType != "text/html") {
+			continue
+		}
+		data, err := readZipFile(zr, it.href)
+		if err != nil {
+			return err
+		}
+		root, err := html.Parse(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", it.href, err)
+		}
+		writeChapter(b, titles[it.href], renderHTML(root))
+	}
+	return nil
+}
+
+// writeChapter writes a chapter under a level 0 heading, so that the
+// chapter's own headings nest below it. Without a title from the table of
+// contents the chapter's first heading names it. A chapter that starts
+// with a heading of its title keeps that as the chapter heading.
+func writeChapter(b *docBuilder, title string, ch *extractedDoc) {
+	if ch.Text == "" {
+		return
+	}
+	startsWithHeading := len(ch.Headings) > 0 && ch.Headings[0].Offset == 0
+	if title == "" && startsWithHeading {
+		title = ch.Headings[0].Title
+	}
+	if title == "" {
+		b.writeDoc(ch)
+		return
+	}
+
+	b.doc.Headings = append(b.doc.Headings, docHeading{Offset: b.offset(), Level: 0, Title: title})
+	if startsWithHeading && strings.EqualFold(ch.Headings[0].Title, title) {
+		ch.Headings = ch.Headings[1:]
+	} else {
+		b.write("# " + title)
+	}
+	b.writeDoc(ch)
+}
+
+// Helper to resolve a link in a file of the book to the path of its target
+// in the zip file, without the fragment
+func epubPath(base, href string) string {
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	if strings.HasPrefix(href, "/") {
+		return strings.TrimPrefix(href, "/")
+	}
+	return path.Join(path.Dir(base), href)
+}
+
+// epubNavTitles reads the chapter titles of an EPUB 3 navigation document.
+// The first entry pointing into a file names it.
+func epubNavTitles(zr *zip.Reader, navPath string, titles map[string]string) {
+	data, err := readZipFile(zr, navPath)
+	if err != nil {
+		return
+	}
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	navs := findElements(root, atom.Nav)
+	var toc *html.Node
+	for _, nav := range navs {
+		for _, a := range nav.Attr {
+			if a.Key == "epub:type" && strings.Contains(" "+a.Val+" ", " toc ") {
+				toc = nav
+			}
+		}
+	}
+	if toc == nil && len(navs) > 0 {
+		toc = navs[0]
+	}
+	if toc == nil {
+		return
+	}
+	for _, a := range findElements(toc, atom.A) {
+		for _, attr := range a.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+			target := epubPath(navPath, attr.Val)
+			if text := collapseSpace(htmlText(a, false)); text != "" && titles[target] == "" {
+				titles[target] = strings.ReplaceAll(text, "\n", " ")
+			}
+		}
+	}
+}
+
+// epubNCXTitles reads the chapter titles of an EPUB 2 NCX file
+func epubNCXTitles(zr *zip.Reader, ncxPath string, titles map[string]string) {
+	root, err := readZipXML(zr, ncxPath)
+	if err != nil {
+		return
+	}
+	var walk func(*xmlNode)
+	walk = func(n *xmlNode) {
+		for _, c := range n.Children {
+			if c.is(nsNCX, "navPoint") {
+				label, content := c.find(nsNCX, "text"), c.find(nsNCX, "content")
+				if label != nil && content != nil {
+					target := epubPath(ncxPath, content.attr("", "src"))
+					if text := tableCell(label.text()); text != "" && titles[target] == "" {
+						titles[target] = text
+					}
+				}
+			}
+			walk(c)
+		}
+	}
+	walk(root)
+}
+
+// parseISODate parses the dates of e-book metadata, which may be given down
+// to the second or only as a year
+func parseISODate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
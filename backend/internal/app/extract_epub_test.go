@@ -0,0 +1,181 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// Helper to write an EPUB with the given package document and files, all
+// in the OEBPS directory
+func writeTestEPUB(t *testing.T, opf string, files map[string]string) string {
+	t.Helper()
+	parts := map[string]string{
+		"mimetype": "application/epub+zip",
+		"META-INF/container.xml": `<container xmlns="` + nsContainer + `" version="1.0"><rootfiles>
+			<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+		</rootfiles></container>`,
+		"OEBPS/content.opf": `<package xmlns="` + nsOPF + `" xmlns:dc="` + nsDublinCore + `" version="3.0">` + opf + `</package>`,
+	}
+	for name, content := range files {
+		parts["OEBPS/"+name] = content
+	}
+	return writeTestZip(t, "book.epub", parts)
+}
+
+func xhtmlPage(body string) string {
+	return `<?xml version="1.0" encoding="utf-8"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>x</title></head><body>` + body + `</body></html>`
+}
+
+func TestExtractEPUB(t *testing.T) {
+	manifest := `<manifest>
+		<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+		<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+		<item id="c1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+		<item id="c2" href="text/c2.xhtml" media-type="application/xhtml+xml"/>
+		<item id="c3" href="text/c3.xhtml" media-type="application/xhtml+xml"/>
+		<item id="img" href="cover.jpg" media-type="image/jpeg"/>
+	</manifest>`
+	spine := `<spine toc="ncx"><itemref idref="img"/><itemref idref="c1"/><itemref idref="c2"/><itemref idref="c3"/><itemref idref="missing"/></spine>`
+	chapters := map[string]string{
+		"text/chapter 1.xhtml": xhtmlPage(`<h1>The Start</h1><p>It begins.</p><h2>A scene</h2><p>More.</p>`),
+		"text/c2.xhtml":        xhtmlPage(`<p>No heading here.</p>`),
+		"text/c3.xhtml":        xhtmlPage(`<h2>Untitled in the contents</h2><p>End.</p>`),
+	}
+
+	tests := []struct {
+		name  string
+		toc   map[string]string
+		want  string
+		trail []string // headings enclosing "More."
+	}{
+		{
+			name: "navigation document",
+			toc: map[string]string{
+				"nav.xhtml": xhtmlPage(`<nav epub:type="landmarks"><ol><li><a href="text/c2.xhtml">Wrong</a></li></ol></nav>
+					<nav epub:type="toc"><ol>
+						<li><a href="text/chapter%201.xhtml">The  Start</a></li>
+						<li><a href="text/chapter%201.xhtml#scene">Scene link</a></li>
+						<li><a href="text/c2.xhtml">Interlude</a></li>
+					</ol></nav>`),
+			},
+			want: "# The Start\n\nIt begins.\n\n## A scene\n\nMore.\n\n# Interlude\n\nNo heading here.\n\n" +
+				"## Untitled in the contents\n\nEnd.",
+			trail: []string{"The Start", "A scene"},
+		},
+		{
+			name: "NCX",
+			toc: map[string]string{
+				"toc.ncx": `<ncx xmlns="` + nsNCX + `"><navMap>
+					<navPoint><navLabel><text>Chapter One</text></navLabel><content src="text/chapter%201.xhtml"/>
+						<navPoint><navLabel><text>Nested</text></navLabel><content src="text/c2.xhtml"/></navPoint>
+					</navPoint>
+				</navMap></ncx>`,
+			},
+			want: "# Chapter One\n\n# The Start\n\nIt begins.\n\n## A scene\n\nMore.\n\n# Nested\n\nNo heading here.\n\n" +
+				"## Untitled in the contents\n\nEnd.",
+			trail: []string{"Chapter One", "The Start", "A scene"},
+		},
+		{
+			name:  "no table of contents",
+			want:  "# The Start\n\nIt begins.\n\n## A scene\n\nMore.\n\nNo heading here.\n\n## Untitled in the contents\n\nEnd.",
+			trail: []string{"The Start", "A scene"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string)
+			for name, content := range chapters {
+				files[name] = content
+			}
+			for name, content := range tt.toc {
+				files[name] = content
+			}
+			opf := `<metadata><dc:title>A  Book</dc:title><dc:creator>Ann Author</dc:creator><dc:date>2019-05</dc:date>
+				<meta property="dcterms:modified">2024-02-03T10:00:00Z</meta></metadata>` + manifest + spine
+
+			doc, err := extractEPUB(writeTestEPUB(t, opf, files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Text != tt.want {
+				t.Errorf("extractEPUB() text =\n%q\nwant\n%q", doc.Text, tt.want)
+			}
+			if doc.Title != "A Book" || doc.Author != "Ann Author" {
+				t.Errorf("extractEPUB() title = %q, author = %q", doc.Title, doc.Author)
+			}
+			if !doc.Created.Equal(time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)) || !doc.Updated.Equal(time.Date(2024, 2, 3, 10, 0, 0, 0, time.UTC)) {
+				t.Errorf("extractEPUB() created = %v, updated = %v", doc.Created, doc.Updated)
+			}
+
+			offset := utf8.RuneCountInString(doc.Text[:strings.Index(doc.Text, "More.")])
+			if got := doc.headingTrail(offset); !reflect.DeepEqual(got, tt.trail) {
+				t.Errorf("headingTrail() = %q, want %q", got, tt.trail)
+			}
+		})
+	}
+}
+
+func TestExtractEPUBErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts map[string]string
+	}{
+		{"no container", map[string]string{"mimetype": "application/epub+zip"}},
+		{"no rootfile", map[string]string{"META-INF/container.xml": `<container xmlns="` + nsContainer + `"/>`}},
+		{"no spine", map[string]string{
+			"META-INF/container.xml": `<container xmlns="` + nsContainer + `"><rootfiles><rootfile full-path="content.opf"/></rootfiles></container>`,
+			"content.opf":            `<package xmlns="` + nsOPF + `"><manifest/></package>`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := extractEPUB(writeTestZip(t, "bad.epub", tt.parts)); err == nil {
+				t.Error("extractEPUB() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestEPUBPath(t *testing.T) {
+	tests := []struct {
+		base, href, want string
+	}{
+		{"OEBPS/content.opf", "text/c1.xhtml", "OEBPS/text/c1.xhtml"},
+		{"OEBPS/text/nav.xhtml", "../text/c1.xhtml#part", "OEBPS/text/c1.xhtml"},
+		{"OEBPS/text/nav.xhtml", "c%201.xhtml", "OEBPS/text/c 1.xhtml"},
+		{"content.opf", "c1.xhtml", "c1.xhtml"},
+		{"OEBPS/content.opf", "/images/a.png", "images/a.png"},
+	}
+	for _, tt := range tests {
+		if got := epubPath(tt.base, tt.href); got != tt.want {
+			t.Errorf("epubPath(%q, %q) = %q, want %q", tt.base, tt.href, got, tt.want)
+		}
+	}
+}
+
+func TestParseISODate(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-02-03T10:00:00Z", time.Date(2024, 2, 3, 10, 0, 0, 0, time.UTC), true},
+		{"2024-02-03T10:00:00+02:00", time.Date(2024, 2, 3, 8, 0, 0, 0, time.UTC), true},
+		{"2024-02-03T10:00:00", time.Date(2024, 2, 3, 10, 0, 0, 0, time.UTC), true},
+		{" 2024-02-03 ", time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC), true},
+		{"2024-02", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), true},
+		{"1869", time.Date(1869, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"03.02.2024", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseISODate(tt.s)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseISODate(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
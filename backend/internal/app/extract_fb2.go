@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FictionBook 2 is a single XML file with the book's description and one
+// or more bodies of nested sections. Images are embedded as base64 in
+// <binary> elements and skipped.
+
+const nsFB2 = "http://www.gribuser.ru/xml/fictionbook/2.0"
+
+// extractFB2 extracts a FictionBook, writing section titles as headings
+// nested by the depth of their section. Poems keep their line breaks and
+// quotes and epigraphs are marked with "> ".
+func extractFB2(path string) (*extractedDoc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FB2 file %s: %w", path, err)
+	}
+	book := root.find(nsFB2, "FictionBook")
+	if book == nil {
+		return nil, fmt.Errorf("failed to read FB2 file %s: not a FictionBook", path)
+	}
+
+	var b docBuilder
+	if info := book.find(nsFB2, "title-info"); info != nil {
+		if t := info.find(nsFB2, "book-title"); t != nil {
+			b.doc.Title = tableCell(t.text())
+		}
+		if a := info.find(nsFB2, "author"); a != nil {
+			var names []string
+			for _, part := range []string{"first-name", "middle-name", "last-name"} {
+				if n := a.find(nsFB2, part); n != nil {
+					names = append(names, n.text())
+				}
+			}
+			if len(names) == 0 {
+				if n := a.find(nsFB2, "nickname"); n != nil {
+					names = append(names, n.text())
+				}
+			}
+			b.doc.Author = tableCell(strings.Join(names, " "))
+		}
+		if d := info.find(nsFB2, "date"); d != nil {
+			date := d.attr("", "value")
+			if date == "" {
+				date = d.text()
+			}
+			b.doc.Created, _ = parseISODate(date)
+		}
+	}
+
+	for _, body := range book.Children {
+		if body.is(nsFB2, "body") {
+			writeFB2Section(&b, body, 0)
+		}
+	}
+	return b.result(), nil
+}
+
+// writeFB2Section writes the blocks of a body or section. Titles of top
+// level sections and of the body are headings of level 1.
+func writeFB2Section(b *docBuilder, n *xmlNode, depth int) {
+	for _, c := range n.Children {
+		if c.Name.Space != nsFB2 {
+			continue
+		}
+		switch c.Name.Local {
+		case "title":
+			title := strings.Join(fb2Lines(c), " ")
+			if title == "" {
+				continue
+			}
+			level := max(depth, 1)
+			b.doc.Headings = append(b.doc.Headings, docHeading{Offset: b.offset(), Level: level, Title: title})
+			b.write(strings.Repeat("#", level) + " " + title)
+		case "section":
+			writeFB2Section(b, c, depth+1)
+		case "p", "subtitle", "text-author":
+			if text := fb2Text(c); text != "" {
+				b.write(text)
+			}
+		case "poem":
+			// Stanzas are blocks, verses lines
+			for _, part := range c.Children {
+				if lines := fb2Lines(part); len(lines) > 0 {
+					b.write(strings.Join(lines, "\n"))
+				}
+			}
+		case "cite", "epigraph":
+			lines := fb2Lines(c)
+			for i, line := range lines {
+				lines[i] = "> " + line
+			}
+			if len(lines) > 0 {
+				b.write(strings.Join(lines, "\n"))
+			}
+		case "table":
+			var rows []string
+			for _, tr := range c.findAll(nsFB2, "tr") {
+				var cells []string
+				for _, td := range tr.Children {
+					if td.is(nsFB2, "td") || td.is(nsFB2, "th") {
+						cells = append(cells, tableCell(td.text()))
+					}
+				}
+				if strings.TrimSpace(strings.Join(cells, "")) != "" {
+					rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+				}
+			}
+			if len(rows) > 0 {
+				b.write(strings.Join(rows, "\n"))
+			}
+		}
+	}
+}
+
+// Helper to get the paragraphs and verses below n as lines
+func fb2Lines(n *xmlNode) []string {
+	var lines []string
+	for _, c := range n.Children {
+		if c.Name.Space != nsFB2 {
+			continue
+		}
+		switch c.Name.Local {
+		case "p", "v", "subtitle", "text-author":
+			if text := fb2Text(c); text != "" {
+				lines = append(lines, text)
+			}
+		default:
+			lines = append(lines, fb2Lines(c)...)
+		}
+	}
+	return lines
+}
+
+// Helper to get the text of a paragraph on a single line, with its links
+// and emphasis as plain text
+func fb2Text(p *xmlNode) string {
+	return collapseSpace(strings.ReplaceAll(p.text(), "\n", " "))
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractFB2(t *testing.T) {
+	tests := []struct {
+		name     string
+		book     string
+		want     string
+		headings []docHeading
+	}{
+		{
+			name: "nested sections",
+			book: `<body><title><p>The Book</p></title>
+				<section><title><p>Part One</p><p>Beginnings</p></title>
+					<epigraph><p>Quoted line</p><text-author>Someone</text-author></epigraph>
+					<p>First <emphasis>paragraph</emphasis>
+					wrapped.</p>
+					<section><title><p>Chapter 1</p></title><p>Text.</p><empty-line/><subtitle>* * *</subtitle></section>
+				</section>
+				<section><title><p>Part Two</p></title><p>More.</p></section>
+			</body>
+			<body name="notes"><section><title><p>1</p></title><p>A note.</p></section></body>
+			<binary id="cover.jpg" content-type="image/jpeg">AAAA</binary>`,
+			want: "# The Book\n\n# Part One Beginnings\n\n> Quoted line\n> Someone\n\nFirst paragraph wrapped.\n\n" +
+				"## Chapter 1\n\nText.\n\n* * *\n\n# Part Two\n\nMore.\n\n# 1\n\nA note.",
+			headings: []docHeading{
+				{Offset: 0, Level: 1, Title: "The Book"},
+				{Offset: 12, Level: 1, Title: "Part One Beginnings"},
+				{Offset: 86, Level: 2, Title: "Chapter 1"},
+				{Offset: 114, Level: 1, Title: "Part Two"},
+				{Offset: 133, Level: 1, Title: "1"},
+			},
+		},
+		{
+			name: "poem and table",
+			book: `<body><section>
+				<poem><title><p>Song</p></title>
+					<stanza><v>Line one</v><v>Line two</v></stanza>
+					<stanza><v>Line three</v></stanza>
+				</poem>
+				<cite><p>Cited</p></cite>
+				<table><tr><th>Name</th><th>Age</th></tr><tr><td>Ann</td><td>3|4</td></tr><tr><td/></tr></table>
+			</section></body>`,
+			want: "Song\n\nLine one\nLine two\n\nLine three\n\n> Cited\n\n| Name | Age |\n| Ann | 3\\|4 |",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "book.fb2")
+			book := `<?xml version="1.0" encoding="utf-8"?>
+				<FictionBook xmlns="` + nsFB2 + `" xmlns:l="http://www.w3.org/1999/xlink">
+				<description><title-info>
+					<author><first-name>Lev</first-name><middle-name>N.</middle-name><last-name>Tolstoy</last-name></author>
+					<book-title>War  and Peace</book-title>
+					<date value="1869-01-01">1869</date>
+				</title-info></description>` + tt.book + `</FictionBook>`
+			if err := os.WriteFile(path, []byte(book), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			doc, err := extractFB2(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Text != tt.want {
+				t.Errorf("extractFB2() text =\n%q\nwant\n%q", doc.Text, tt.want)
+			}
+			if doc.Title != "War and Peace" || doc.Author != "Lev N. Tolstoy" {
+				t.Errorf("extractFB2() title = %q, author = %q", doc.Title, doc.Author)
+			}
+			if !doc.Created.Equal(time.Date(1869, 1, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("extractFB2() created = %v", doc.Created)
+			}
+			if tt.headings != nil {
+				if len(doc.Headings) != len(tt.headings) {
+					t.Fatalf("Headings = %+v, want %+v", doc.Headings, tt.headings)
+				}
+				for i := range tt.headings {
+					if doc.Headings[i] != tt.headings[i] {
+						t.Errorf("heading %d = %+v, want %+v", i, doc.Headings[i], tt.headings[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestExtractFB2Cp1251(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.fb2")
+	// "Привет" in windows-1251
+	book := "<?xml version=\"1.0\" encoding=\"windows-1251\"?><FictionBook xmlns=\"" + nsFB2 + "\">" +
+		"<body><section><p>\xcf\xf0\xe8\xe2\xe5\xf2</p></section></body></FictionBook>"
+	if err := os.WriteFile(path, []byte(book), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := extractFB2(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Text != "Привет" {
+		t.Errorf("extractFB2() text = %q, want %q", doc.Text, "Привет")
+	}
+}
+
+func TestExtractFB2NotABook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.fb2")
+	if err := os.WriteFile(path, []byte(`<html><body/></html>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extractFB2(path); err == nil {
+		t.Error("extractFB2() succeeded, want an error")
+	}
+}
@@ -0,0 +1,343 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Elements that never hold document content
+var htmlSkipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Form: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Button: true,
+	atom.Select: true, atom.Textarea: true, atom.Input: true, atom.Head: true,
+}
+
+// ARIA roles of site navigation and other page furniture
+var htmlSkippedRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true,
+	"search": true, "complementary": true, "menu": true, "menubar": true,
+}
+
+// Elements that start a new block of text
+var htmlBlocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Main: true, atom.Header: true, atom.Body: true, atom.Html: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Address: true,
+	atom.Details: true, atom.Summary: true, atom.Dl: true, atom.Dt: true,
+	atom.Dd: true, atom.Center: true, atom.Caption: true, atom.Li: true,
+}
+
+// extractHTML converts an HTML or XHTML page to Markdown-like text, keeping
+// headings, lists, tables and code blocks and dropping scripts, styles and
+// navigation. When the page marks its content with <main> or a single
+// <article>, only that is kept.
+func extractHTML(path string) (*extractedDoc, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	// Pages that aren't UTF-8 are most likely Windows-1252
+	if !utf8.Valid(b) {
+		b = []byte(string(decodeCp1252(b)))
+	}
+	root, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML file %s: %w", path, err)
+	}
+	return renderHTML(root), nil
+}
+
+// renderHTML converts a parsed page, see extractHTML
+func renderHTML(root *html.Node) *extractedDoc {
+	r := &htmlRenderer{}
+	if title := findElement(root, atom.Title); title != nil {
+		r.b.doc.Title = collapseSpace(htmlText(title, false))
+	}
+
+	content := findElement(root, atom.Main)
+	if content == nil {
+		if articles := findElements(root, atom.Article); len(articles) == 1 {
+			content = articles[0]
+		}
+	}
+	if content != nil {
+		r.inContent++
+	} else {
+		content = root
+	}
+	r.render(content)
+	r.flush()
+	return r.b.result()
+}
+
+// htmlRenderer writes the blocks of an HTML tree to a docBuilder, gathering
+// inline text until the next block starts
+type htmlRenderer struct {
+	b      docBuilder
+	inline strings.Builder
+	// Depth of <main> and <article> elements, whose <header> is content
+	inContent int
+}
+
+func (r *htmlRenderer) flush() {
+	text := collapseSpace(r.inline.String())
+	r.inline.Reset()
+	if text != "" {
+		r.b.write(text)
+	}
+}
+
+func (r *htmlRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		// Only <br> breaks lines outside of <pre>
+		r.inline.WriteString(strings.ReplaceAll(n.Data, "\n", " "))
+		return
+	case html.DocumentNode:
+		r.renderChildren(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if r.skipped(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.flush()
+		level := int(n.Data[1] - '0')
+		if title := collapseSpace(htmlText(n, false)); title != "" {
+			r.b.doc.Headings = append(r.b.doc.Headings, docHeading{Offset: r.b.offset(), Level: level, Title: title})
+			r.b.write(strings.Repeat("#", level) + " " + title)
+		}
+	case atom.Ul, atom.Ol:
+		r.flush()
+		if lines := r.listLines(n, 0); len(lines) > 0 {
+			r.b.write(strings.Join(lines, "\n"))
+		}
+	case atom.Table:
+		r.flush()
+		if lines := r.tableLines(n); len(lines) > 0 {
+			r.b.write(strings.Join(lines, "\n"))
+		}
+	case atom.Pre:
+		r.flush()
+		if code := strings.Trim(htmlText(n, true), "\n"); strings.TrimSpace(code) != "" {
+			r.b.write("```\n" + code + "\n```")
+		}
+	case atom.Blockquote:
+		r.flush()
+		var lines []string
+		for _, line := range strings.Split(htmlText(n, false), "\n") {
+			if line = collapseSpace(line); line != "" {
+				lines = append(lines, "> "+line)
+			}
+		}
+		if len(lines) > 0 {
+			r.b.write(strings.Join(lines, "\n"))
+		}
+	case atom.Br:
+		r.inline.WriteString("\n")
+	case atom.Hr:
+		r.flush()
+	default:
+		if !htmlBlocks[n.DataAtom] {
+			r.renderChildren(n)
+			return
+		}
+		if n.DataAtom == atom.Main || n.DataAtom == atom.Article {
+			r.inContent++
+			defer func() { r.inContent-- }()
+		}
+		r.flush()
+		r.renderChildren(n)
+		r.flush()
+	}
+}
+
+func (r *htmlRenderer) renderChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
+
+// Helper to tell whether an element is boilerplate or hidden
+func (r *htmlRenderer) skipped(n *html.Node) bool {
+	if htmlSkipped[n.DataAtom] {
+		return true
+	}
+	// A page header is boilerplate, the header of an article is not
+	if n.DataAtom == atom.Header && r.inContent == 0 {
+		return true
+	}
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if a.Val == "true" {
+				return true
+			}
+		case "role":
+			if htmlSkippedRoles[strings.ToLower(a.Val)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listLines renders the items of a list as "- item" or "1. item" lines,
+// indenting nested lists
+func (r *htmlRenderer) listLines(list *html.Node, depth int) []string {
+	var lines []string
+	indent := strings.Repeat("  ", depth)
+	i := 0
+	for li := list.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li || r.skipped(li) {
+			continue
+		}
+		i++
+		marker := "-"
+		if list.DataAtom == atom.Ol {
+			marker = strconv.Itoa(i) + "."
+		}
+
+		// Text of the item itself, nested lists follow as lines of their own
+		var text strings.Builder
+		var nested []string
+		for c := li.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.DataAtom == atom.Ul || c.DataAtom == atom.Ol) {
+				if !r.skipped(c) {
+					nested = append(nested, r.listLines(c, depth+1)...)
+				}
+				continue
+			}
+			text.WriteString(r.nodeText(c))
+			text.WriteString(" ")
+		}
+		if item := collapseSpace(text.String()); item != "" {
+			lines = append(lines, indent+marker+" "+item)
+		}
+		lines = append(lines, nested...)
+	}
+	return lines
+}
+
+// tableLines renders a table as "| a | b |" rows, with a separator after
+// a header row
+func (r *htmlRenderer) tableLines(table *html.Node) []string {
+	var lines []string
+	for _, tr := range findElements(table, atom.Tr) {
+		var cells []string
+		header := true
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || (c.DataAtom != atom.Td && c.DataAtom != atom.Th) {
+				continue
+			}
+			if c.DataAtom == atom.Td {
+				header = false
+			}
+			cell := collapseSpace(strings.ReplaceAll(r.nodeText(c), "\n", " "))
+			cells = append(cells, strings.ReplaceAll(cell, "|", "\\|"))
+		}
+		if len(cells) == 0 || strings.TrimSpace(strings.Join(cells, "")) == "" {
+			continue
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if header && len(lines) == 1 {
+			lines = append(lines, strings.Repeat("| --- ", len(cells))+"|")
+		}
+	}
+	return lines
+}
+
+// Helper to get the text of a node, leaving out skipped elements
+func (r *htmlRenderer) nodeText(n *html.Node) string {
+	if n.Type == html.ElementNode && r.skipped(n) {
+		return ""
+	}
+	return htmlText(n, false)
+}
+
+// htmlText returns the text below n. Line breaks become newlines; with pre
+// set whitespace is kept as is, otherwise block elements are separated by
+// spaces.
+func htmlText(n *html.Node, pre bool) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			if pre {
+				sb.WriteString(n.Data)
+			} else {
+				sb.WriteString(strings.ReplaceAll(n.Data, "\n", " "))
+			}
+			return
+		case html.ElementNode:
+			if n.DataAtom == atom.Script || n.DataAtom == atom.Style || n.DataAtom == atom.Template {
+				return
+			}
+			if n.DataAtom == atom.Br {
+				sb.WriteString("\n")
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if !pre && n.Type == html.ElementNode && htmlBlocks[n.DataAtom] {
+			sb.WriteString(" ")
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// Helper to find the first element of a kind in document order
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Helper to find all elements of a kind, not looking inside matches
+func findElements(n *html.Node, a atom.Atom) []*html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return []*html.Node{n}
+	}
+	var found []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		found = append(found, findElements(c, a)...)
+	}
+	return found
+}
+
+// Helper to collapse runs of spaces and tabs within each line and drop
+// empty lines
+func collapseSpace(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "main without page header",
+			page: `<body><header><a href="/">Site</a> Menu</header>
+				<main><header><h1>Release notes</h1><p>By the team</p></header>
+				<p>Version 2 is out.</p></main>
+				<footer>© Site</footer></body>`,
+			want: "# Release notes\n\nBy the team\n\nVersion 2 is out.",
+		},
+		{
+			name: "page header without main",
+			page: `<body><header>Site</header><div role="navigation">Home</div>
+				<h2>Intro</h2><p>Text  with
+				spaces.</p><nav>Links</nav></body>`,
+			want: "## Intro\n\nText with spaces.",
+		},
+		{
+			name: "single article",
+			page: `<body><div>Sidebar</div><article><header><h1>Post</h1></header><p>Body</p></article></body>`,
+			want: "# Post\n\nBody",
+		},
+		{
+			name: "several articles keep the page",
+			page: `<body><p>Feed</p><article>One</article><article>Two</article></body>`,
+			want: "Feed\n\nOne\n\nTwo",
+		},
+		{
+			name: "hidden elements",
+			page: `<body><p hidden>Secret</p><p aria-hidden="true">Icon</p><script>x()</script><p>Shown</p></body>`,
+			want: "Shown",
+		},
+		{
+			name: "lists",
+			page: `<ul><li>One<ol><li>First</li><li>Second</li></ol></li><li>Two</li></ul>`,
+			want: "- One\n  1. First\n  2. Second\n- Two",
+		},
+		{
+			name: "table with header row",
+			page: `<table><tr><th>Name</th><th>Qty</th></tr><tr><td>a|b</td><td>2</td></tr></table>`,
+			want: "| Name | Qty |\n| --- | --- |\n| a\\|b | 2 |",
+		},
+		{
+			name: "code and quotes",
+			page: "<pre>if x {\n    y()\n}</pre><blockquote>Quoted<br>twice</blockquote>",
+			want: "```\nif x {\n    y()\n}\n```\n\n> Quoted\n> twice",
+		},
+		{
+			name: "line breaks",
+			page: `<p>Line one<br>Line two</p>`,
+			want: "Line one\nLine two",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := html.Parse(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := renderHTML(root).Text; got != tt.want {
+				t.Errorf("renderHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderHTMLHeadings(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(`<title> The  Page </title><h1>A</h1><p>x</p><h3>B</h3>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := renderHTML(root)
+	if doc.Title != "The Page" {
+		t.Errorf("Title = %q, want %q", doc.Title, "The Page")
+	}
+	want := []docHeading{{Offset: 0, Level: 1, Title: "A"}, {Offset: 8, Level: 3, Title: "B"}}
+	if len(doc.Headings) != len(want) {
+		t.Fatalf("Headings = %+v, want %+v", doc.Headings, want)
+	}
+	for i := range want {
+		if doc.Headings[i] != want[i] {
+			t.Errorf("heading %d = %+v, want %+v", i, doc.Headings[i], want[i])
+		}
+	}
+}
+
+func TestExtractHTMLCp1252(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.html")
+	if err := os.WriteFile(path, []byte("<p>\x93Caf\xe9\x94 \x96 \x80 5</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := extractHTML(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "“Café” – € 5"; doc.Text != want {
+		t.Errorf("extractHTML() = %q, want %q", doc.Text, want)
+	}
+}
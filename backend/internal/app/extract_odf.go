@@ -0,0 +1,255 @@
+package app
+
+import (
+	"archive/zip"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// OpenDocument files keep their whole body in content.xml and the document
+// properties in meta.xml. Text documents, spreadsheets and presentations
+// share the markup for paragraphs, lists and tables.
+
+const (
+	nsODFOffice       = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	nsODFText         = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+	nsODFTable        = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	nsODFDraw         = "urn:oasis:names:tc:opendocument:xmlns:drawing:1.0"
+	nsODFPresentation = "urn:oasis:names:tc:opendocument:xmlns:presentation:1.0"
+)
+
+// Rows and cells repeated more often are cut off. Spreadsheets pad their
+// used area with long runs of empty ones.
+const odfMaxRepeat = 1000
+
+// extractODF extracts an OpenDocument text, spreadsheet or presentation.
+// Text documents keep their headings, spreadsheets are written sheet by
+// sheet and presentations slide by slide, like their OOXML counterparts.
+func extractODF(path string) (*extractedDoc, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OpenDocument file %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	content, err := readZipXML(&zr.Reader, "content.xml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenDocument file %s: %w", path, err)
+	}
+	body := content.find(nsODFOffice, "body")
+	if body == nil {
+		return nil, fmt.Errorf("failed to read OpenDocument file %s: missing document body", path)
+	}
+
+	var b docBuilder
+	if meta, err := readZipXML(&zr.Reader, "meta.xml"); err == nil {
+		if t := meta.find(nsDublinCore, "title"); t != nil {
+			b.doc.Title = tableCell(t.text())
+		}
+	}
+	for _, c := range body.Children {
+		switch {
+		case c.is(nsODFOffice, "text"):
+			writeODFText(&b, c)
+		case c.is(nsODFOffice, "spreadsheet"):
+			for i, table := range c.findAll(nsODFTable, "table") {
+				writeSheet(&b, i+1, table.attr(nsODFTable, "name"), odfTableRows(table))
+			}
+		case c.is(nsODFOffice, "presentation"), c.is(nsODFOffice, "drawing"):
+			writeODFSlides(&b, c)
+		}
+	}
+	return b.result(), nil
+}
+
+// writeODFText writes the blocks of a text document, recording headings
+// with their outline level
+func writeODFText(b *docBuilder, n *xmlNode) {
+	for _, c := range n.Children {
+		switch {
+		case c.is(nsODFText, "h"):
+			title := tableCell(odfText(c))
+			if title == "" {
+				continue
+			}
+			level, _ := strconv.Atoi(c.attr(nsODFText, "outline-level"))
+			if level < 1 {
+				level = 1
+			}
+			b.doc.Headings = append(b.doc.Headings, docHeading{Offset: b.offset(), Level: level, Title: title})
+			b.write(strings.Repeat("#", level) + " " + title)
+		case c.is(nsODFText, "p"):
+			if text := collapseSpace(odfText(c)); text != "" {
+				b.write(text)
+			}
+		case c.is(nsODFText, "list"):
+			if lines := odfListLines(c, 0); len(lines) > 0 {
+				b.write(strings.Join(lines, "\n"))
+			}
+		case c.is(nsODFTable, "table"):
+			if lines := odfTableRows(c); len(lines) > 0 {
+				b.write(strings.Join(lines, "\n"))
+			}
+		case c.is(nsODFText, "tracked-changes"), c.is(nsODFText, "table-of-content"):
+			// Deleted text and a copy of the headings
+		default:
+			writeODFText(b, c)
+		}
+	}
+}
+
+// writeODFSlides writes the pages of a presentation with their title,
+// the text of their frames and their speaker notes
+func writeODFSlides(b *docBuilder, pres *xmlNode) {
+	for i, page := range pres.findAll(nsODFDraw, "page") {
+		var title string
+		var lines, notes []string
+		for _, c := range page.Children {
+			if c.is(nsODFPresentation, "notes") {
+				for _, f := range c.Children {
+					if f.attr(nsODFPresentation, "class") == "notes" {
+						notes = append(notes, odfLines(f)...)
+					}
+				}
+				continue
+			}
+			switch c.attr(nsODFPresentation, "class") {
+			case "title":
+				if title == "" {
+					title = strings.Join(odfLines(c), " ")
+					continue
+				}
+			case "page-number", "date-time", "footer", "header":
+				continue
+			}
+			lines = append(lines, odfLines(c)...)
+		}
+		writeSlide(b, i+1, title, lines, notes)
+	}
+}
+
+// Helper to get the paragraphs, list items and table rows below n as lines
+func odfLines(n *xmlNode) []string {
+	var lines []string
+	for _, c := range n.Children {
+		switch {
+		case c.is(nsODFText, "p"), c.is(nsODFText, "h"):
+			if text := collapseSpace(odfText(c)); text != "" {
+				lines = append(lines, text)
+			}
+		case c.is(nsODFText, "list"):
+			lines = append(lines, odfListLines(c, 0)...)
+		case c.is(nsODFTable, "table"):
+			lines = append(lines, odfTableRows(c)...)
+		case c.is(nsODFOffice, "annotation"):
+		default:
+			lines = append(lines, odfLines(c)...)
+		}
+	}
+	return lines
+}
+
+// odfListLines renders the items of a list as "- item" lines, indenting
+// nested lists. Numbering comes from styles and isn't reproduced.
+func odfListLines(list *xmlNode, depth int) []string {
+	var lines []string
+	indent := strings.Repeat("  ", depth)
+	for _, item := range list.Children {
+		if !item.is(nsODFText, "list-item") && !item.is(nsODFText, "list-header") {
+			continue
+		}
+		marker := indent + "- "
+		for _, c := range item.Children {
+			if c.is(nsODFText, "list") {
+				lines = append(lines, odfListLines(c, depth+1)...)
+			} else if text := tableCell(odfText(c)); text != "" {
+				lines = append(lines, marker+text)
+				marker = indent + "  "
+			}
+		}
+	}
+	return lines
+}
+
+// odfTableRows renders the non-empty rows of a table as "| a | b |" lines.
+// Empty cells are only kept in front of a value.
+func odfTableRows(table *xmlNode) []string {
+	var lines []string
+	for _, row := range table.findAll(nsODFTable, "table-row") {
+		var cells []string
+		empty := 0
+		for _, c := range row.Children {
+			if !c.is(nsODFTable, "table-cell") && !c.is(nsODFTable, "covered-table-cell") {
+				continue
+			}
+			n := odfRepeat(c, "number-columns-repeated")
+			var paragraphs []string
+			for _, p := range c.findAll(nsODFText, "p") {
+				paragraphs = append(paragraphs, odfText(p))
+			}
+			text := tableCell(strings.Join(paragraphs, " "))
+			if text == "" {
+				empty += n
+				continue
+			}
+			if len(cells)+empty+n > xlsxMaxColumns {
+				break
+			}
+			for ; empty > 0; empty-- {
+				cells = append(cells, "")
+			}
+			for i := 0; i < n; i++ {
+				cells = append(cells, text)
+			}
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		line := "| " + strings.Join(cells, " | ") + " |"
+		for i := odfRepeat(row, "number-rows-repeated"); i > 0; i-- {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Helper to read a repeat count of a row or cell
+func odfRepeat(n *xmlNode, attr string) int {
+	count, err := strconv.Atoi(n.attr(nsODFTable, attr))
+	if err != nil || count < 1 {
+		return 1
+	}
+	return min(count, odfMaxRepeat)
+}
+
+// odfText returns the text of a paragraph or heading. Spaces, tabs and line
+// breaks are elements of their own, newlines in the markup are not line
+// breaks. Footnotes and comments are left out.
+func odfText(n *xmlNode) string {
+	var sb strings.Builder
+	var walk func(*xmlNode)
+	walk = func(n *xmlNode) {
+		for _, c := range n.Children {
+			switch {
+			case c.Name.Local == "":
+				sb.WriteString(strings.ReplaceAll(c.Text, "\n", " "))
+			case c.is(nsODFText, "s"):
+				count, err := strconv.Atoi(c.attr(nsODFText, "c"))
+				if err != nil || count < 1 {
+					count = 1
+				}
+				sb.WriteString(strings.Repeat(" ", min(count, odfMaxRepeat)))
+			case c.is(nsODFText, "tab"):
+				sb.WriteString("\t")
+			case c.is(nsODFText, "line-break"):
+				sb.WriteString("\n")
+			case c.is(nsODFText, "note"), c.is(nsODFOffice, "annotation"):
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return sb.String()
+}
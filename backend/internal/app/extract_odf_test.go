@@ -0,0 +1,173 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const odfNamespaces = `xmlns:office="` + nsODFOffice + `" xmlns:text="` + nsODFText +
+	`" xmlns:table="` + nsODFTable + `" xmlns:draw="` + nsODFDraw +
+	`" xmlns:presentation="` + nsODFPresentation + `"`
+
+func TestODFTableRows(t *testing.T) {
+	cell := func(text string, repeat int) string {
+		attr := ""
+		if repeat > 0 {
+			attr = fmt.Sprintf(` table:number-columns-repeated="%d"`, repeat)
+		}
+		if text == "" {
+			return `<table:table-cell` + attr + `/>`
+		}
+		return `<table:table-cell` + attr + `><text:p>` + text + `</text:p></table:table-cell>`
+	}
+
+	tests := []struct {
+		name string
+		rows string
+		want []string
+	}{
+		{
+			name: "padding after the last value",
+			rows: `<table:table-row>` + cell("a", 0) + cell("b", 0) + cell("", 16382) + `</table:table-row>`,
+			want: []string{"| a | b |"},
+		},
+		{
+			name: "empty cells between values",
+			rows: `<table:table-row>` + cell("a", 0) + cell("", 3) + cell("b", 0) + `</table:table-row>`,
+			want: []string{"| a |  |  |  | b |"},
+		},
+		{
+			name: "repeated value",
+			rows: `<table:table-row>` + cell("x", 3) + `</table:table-row>`,
+			want: []string{"| x | x | x |"},
+		},
+		{
+			name: "empty rows padding the sheet",
+			rows: `<table:table-row>` + cell("a", 0) + `</table:table-row>` +
+				`<table:table-row table:number-rows-repeated="1048575">` + cell("", 1024) + `</table:table-row>`,
+			want: []string{"| a |"},
+		},
+		{
+			name: "repeated row",
+			rows: `<table:table-row table:number-rows-repeated="2">` + cell("same", 0) + `</table:table-row>`,
+			want: []string{"| same |", "| same |"},
+		},
+		{
+			name: "huge repeat is capped",
+			rows: `<table:table-row>` + cell("", 0) + cell("v", 100000) + `</table:table-row>`,
+			want: []string{"|  | " + strings.Repeat("v | ", odfMaxRepeat-1) + "v |"},
+		},
+		{
+			name: "covered cells and paragraphs",
+			rows: `<table:table-row><table:table-cell><text:p>one</text:p><text:p>two</text:p></table:table-cell>` +
+				`<table:covered-table-cell/>` + cell("a|b", 0) + `</table:table-row>`,
+			want: []string{"| one two |  | a\\|b |"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := parseTestXML(t, `<table:table `+odfNamespaces+`>`+tt.rows+`</table:table>`)
+			got := odfTableRows(table)
+			if len(got) != len(tt.want) {
+				t.Fatalf("odfTableRows() = %q, want %q", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("row %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestODFText(t *testing.T) {
+	tests := []struct {
+		markup string
+		want   string
+	}{
+		{`<text:p>a<text:s text:c="3"/>b<text:s/>c</text:p>`, "a   b c"},
+		{`<text:p>col<text:tab/>col</text:p>`, "col\tcol"},
+		{`<text:p>line<text:line-break/>next</text:p>`, "line\nnext"},
+		{"<text:p>wrapped\nmarkup</text:p>", "wrapped markup"},
+		{`<text:p>text<text:note><text:note-body><text:p>footnote</text:p></text:note-body></text:note> <text:span>styled</text:span></text:p>`, "text styled"},
+		{`<text:p>x<office:annotation><text:p>comment</text:p></office:annotation></text:p>`, "x"},
+	}
+	for _, tt := range tests {
+		p := parseTestXML(t, `<office:text `+odfNamespaces+`>`+tt.markup+`</office:text>`)
+		if got := odfText(p.Children[0]); got != tt.want {
+			t.Errorf("odfText(%s) = %q, want %q", tt.markup, got, tt.want)
+		}
+	}
+}
+
+func TestODFListLines(t *testing.T) {
+	list := parseTestXML(t, `<text:list `+odfNamespaces+`>
+		<text:list-item><text:p>One</text:p><text:p>continued</text:p>
+			<text:list><text:list-item><text:p>Nested</text:p></text:list-item></text:list>
+		</text:list-item>
+		<text:list-item><text:p>Two</text:p></text:list-item>
+	</text:list>`)
+	want := []string{"- One", "  continued", "  - Nested", "- Two"}
+	got := odfListLines(list, 0)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("odfListLines() = %q, want %q", got, want)
+	}
+}
+
+func TestExtractODF(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "text",
+			body: `<office:text>
+				<text:table-of-content><text:p>Intro .... 1</text:p></text:table-of-content>
+				<text:h text:outline-level="1">Intro</text:h>
+				<text:p>Hello.</text:p>
+				<text:tracked-changes><text:p>deleted</text:p></text:tracked-changes>
+				<text:section><text:h text:outline-level="2">Details</text:h><text:p>More.</text:p></text:section>
+			</office:text>`,
+			want: "# Intro\n\nHello.\n\n## Details\n\nMore.",
+		},
+		{
+			name: "spreadsheet",
+			body: `<office:spreadsheet><table:table table:name="Data">
+				<table:table-row><table:table-cell><text:p>a</text:p></table:table-cell><table:table-cell table:number-columns-repeated="1023"/></table:table-row>
+			</table:table></office:spreadsheet>`,
+			want: "# Data\n\n| a |",
+		},
+		{
+			name: "presentation",
+			body: `<office:presentation><draw:page>
+				<draw:frame presentation:class="title"><draw:text-box><text:p>Welcome</text:p></draw:text-box></draw:frame>
+				<draw:frame presentation:class="outline"><draw:text-box><text:list><text:list-item><text:p>Point</text:p></text:list-item></text:list></draw:text-box></draw:frame>
+				<draw:frame presentation:class="page-number"><draw:text-box><text:p>1</text:p></draw:text-box></draw:frame>
+				<presentation:notes><draw:frame presentation:class="notes"><draw:text-box><text:p>Say hi</text:p></draw:text-box></draw:frame></presentation:notes>
+			</draw:page></office:presentation>`,
+			want: "# Welcome\n\n- Point\n\nNotes: Say hi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestZip(t, "doc.odt", map[string]string{
+				"content.xml": `<office:document-content ` + odfNamespaces + `><office:body>` + tt.body + `</office:body></office:document-content>`,
+				"meta.xml":    `<office:document-meta ` + odfNamespaces + ` xmlns:dc="` + nsDublinCore + `"><office:meta><dc:title>Doc</dc:title></office:meta></office:document-meta>`,
+			})
+			doc, err := extractODF(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Text != tt.want {
+				t.Errorf("extractODF() text = %q, want %q", doc.Text, tt.want)
+			}
+			if doc.Title != "Doc" {
+				t.Errorf("extractODF() title = %q, want %q", doc.Title, "Doc")
+			}
+		})
+	}
+}
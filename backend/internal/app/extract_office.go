@@ -0,0 +1,411 @@
+package app
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Office Open XML packages are zip files of XML parts tied together by
+// relationship parts. See [ECMA-376].
+
+const (
+	nsSpreadsheetML  = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsPresentationML = "http://schemas.openxmlformats.org/presentationml/2006/main"
+	nsDrawingML      = "http://schemas.openxmlformats.org/drawingml/2006/main"
+	nsOfficeRels     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	nsPackageRels    = "http://schemas.openxmlformats.org/package/2006/relationships"
+	nsDublinCore     = "http://purl.org/dc/elements/1.1/"
+)
+
+// The widest sheet Excel allows, cells further right are ignored
+const xlsxMaxColumns = 16384
+
+type ooxmlRel struct {
+	Type   string
+	Target string // path of the part in the package
+}
+
+// ooxmlRels returns the relationships of a part by ID. Parts without
+// relationships have none, external targets are left out.
+func ooxmlRels(zr *zip.Reader, part string) (map[string]ooxmlRel, error) {
+	relsPart := path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+	if _, err := fs.Stat(zr, relsPart); err != nil {
+		return map[string]ooxmlRel{}, nil
+	}
+	root, err := readZipXML(zr, relsPart)
+	if err != nil {
+		return nil, err
+	}
+	rels := make(map[string]ooxmlRel)
+	for _, r := range root.findAll(nsPackageRels, "Relationship") {
+		if r.attr("", "TargetMode") == "External" {
+			continue
+		}
+		target := r.attr("", "Target")
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(path.Dir(part), target)
+		}
+		rels[r.attr("", "Id")] = ooxmlRel{Type: r.attr("", "Type"), Target: target}
+	}
+	return rels, nil
+}
+
+// Helper to find the first relationship of a type, compared by the last
+// element of the type URI
+func ooxmlRelOfType(rels map[string]ooxmlRel, typ string) (ooxmlRel, bool) {
+	for _, r := range rels {
+		if path.Base(r.Type) == typ {
+			return r, true
+		}
+	}
+	return ooxmlRel{}, false
+}
+
+// Helper to find the main part of a package, falling back to the usual name
+func ooxmlMainPart(zr *zip.Reader, fallback string) string {
+	rels, err := ooxmlRels(zr, "")
+	if err == nil {
+		if r, ok := ooxmlRelOfType(rels, "officeDocument"); ok {
+			return r.Target
+		}
+	}
+	return fallback
+}
+
+// Helper to get the title from the core properties, "" if there is none
+func ooxmlTitle(zr *zip.Reader) string {
+	core, err := readZipXML(zr, "docProps/core.xml")
+	if err != nil {
+		return ""
+	}
+	if t := core.find(nsDublinCore, "title"); t != nil {
+		return collapseSpace(strings.ReplaceAll(t.text(), "\n", " "))
+	}
+	return ""
+}
+
+// extractXlsx extracts an Excel workbook sheet by sheet, each row as a
+// "| a | b |" line with empty cells kept in place
+func extractXlsx(path string) (*extractedDoc, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSX file %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	var b docBuilder
+	b.doc.Title = ooxmlTitle(&zr.Reader)
+	if err := writeXlsx(&zr.Reader, &b); err != nil {
+		return nil, fmt.Errorf("failed to read XLSX file %s: %w", path, err)
+	}
+	return b.result(), nil
+}
+
+func writeXlsx(zr *zip.Reader, b *docBuilder) error {
+	wbPart := ooxmlMainPart(zr, "xl/workbook.xml")
+	wb, err := readZipXML(zr, wbPart)
+	if err != nil {
+		return err
+	}
+	rels, err := ooxmlRels(zr, wbPart)
+	if err != nil {
+		return err
+	}
+	var shared []string
+	if r, ok := ooxmlRelOfType(rels, "sharedStrings"); ok {
+		sst, err := readZipXML(zr, r.Target)
+		if err != nil {
+			return err
+		}
+		for _, si := range sst.findAll(nsSpreadsheetML, "si") {
+			shared = append(shared, xlsxString(si))
+		}
+	}
+
+	for i, sheet := range wb.findAll(nsSpreadsheetML, "sheet") {
+		if state := sheet.attr("", "state"); state == "hidden" || state == "veryHidden" {
+			continue
+		}
+		// Chart sheets have no cells
+		rel, ok := rels[sheet.attr(nsOfficeRels, "id")]
+		if !ok || path.Base(rel.Type) != "worksheet" {
+			continue
+		}
+		ws, err := readZipXML(zr, rel.Target)
+		if err != nil {
+			return err
+		}
+		writeSheet(b, i+1, sheet.attr("", "name"), xlsxRows(ws, shared))
+	}
+	return nil
+}
+
+// Helper to write the rows of a sheet under a heading with its name
+func writeSheet(b *docBuilder, number int, name string, rows []string) {
+	if len(rows) == 0 {
+		return
+	}
+	if name = tableCell(name); name == "" {
+		name = fmt.Sprintf("Sheet %d", number)
+	}
+	b.doc.Sheets = append(b.doc.Sheets, docPage{Offset: b.offset(), Number: number})
+	b.doc.Headings = append(b.doc.Headings, docHeading{Offset: b.offset(), Level: 1, Title: name})
+	b.write("# " + name)
+	b.write(strings.Join(rows, "\n"))
+}
+
+// xlsxRows renders the non-empty rows of a worksheet
+func xlsxRows(ws *xmlNode, shared []string) []string {
+	var lines []string
+	for _, row := range ws.findAll(nsSpreadsheetML, "row") {
+		var cells []string
+		for _, c := range row.Children {
+			if !c.is(nsSpreadsheetML, "c") {
+				continue
+			}
+			col := len(cells)
+			if n, ok := xlsxColumn(c.attr("", "r")); ok && n >= col {
+				col = n
+			}
+			if col >= xlsxMaxColumns {
+				break
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+			cells = append(cells, tableCell(xlsxCellValue(c, shared)))
+		}
+		for len(cells) > 0 && cells[len(cells)-1] == "" {
+			cells = cells[:len(cells)-1]
+		}
+		if len(cells) > 0 {
+			lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		}
+	}
+	return lines
+}
+
+// Helper to get the displayed value of a cell. Numbers are shortened to 15
+// significant digits, as Excel shows them; dates stay serial numbers.
+func xlsxCellValue(c *xmlNode, shared []string) string {
+	var v string
+	if n := c.find(nsSpreadsheetML, "v"); n != nil {
+		v = strings.TrimSpace(n.text())
+	}
+	switch c.attr("", "t") {
+	case "s":
+		if i, err := strconv.Atoi(v); err == nil && i >= 0 && i < len(shared) {
+			return shared[i]
+		}
+		return ""
+	case "inlineStr":
+		if is := c.find(nsSpreadsheetML, "is"); is != nil {
+			return xlsxString(is)
+		}
+		return ""
+	case "b":
+		if v == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "", "n":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return strconv.FormatFloat(f, 'g', 15, 64)
+		}
+	}
+	return v
+}
+
+// Helper to get the text of a shared or inline string, which is either a
+// single <t> or a list of rich text runs. Phonetic hints are left out.
+func xlsxString(si *xmlNode) string {
+	var sb strings.Builder
+	for _, c := range si.Children {
+		if c.is(nsSpreadsheetML, "t") {
+			sb.WriteString(c.text())
+		} else if c.is(nsSpreadsheetML, "r") {
+			if t := c.find(nsSpreadsheetML, "t"); t != nil {
+				sb.WriteString(t.text())
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Helper to get the zero-based column of a cell reference like "AB12"
+func xlsxColumn(ref string) (int, bool) {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+		if col > xlsxMaxColumns {
+			return xlsxMaxColumns, true
+		}
+	}
+	if i == 0 {
+		return 0, false
+	}
+	return col - 1, true
+}
+
+// Helper to fit text into a table cell on a single line
+func tableCell(s string) string {
+	s = collapseSpace(strings.ReplaceAll(s, "\n", " "))
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+// extractPptx extracts a PowerPoint presentation slide by slide. Each slide
+// starts with its title as a heading, followed by the text of its shapes
+// and tables and its speaker notes.
+func extractPptx(path string) (*extractedDoc, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PPTX file %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	var b docBuilder
+	b.doc.Title = ooxmlTitle(&zr.Reader)
+	if err := writePptx(&zr.Reader, &b); err != nil {
+		return nil, fmt.Errorf("failed to read PPTX file %s: %w", path, err)
+	}
+	return b.result(), nil
+}
+
+func writePptx(zr *zip.Reader, b *docBuilder) error {
+	presPart := ooxmlMainPart(zr, "ppt/presentation.xml")
+	pres, err := readZipXML(zr, presPart)
+	if err != nil {
+		return err
+	}
+	rels, err := ooxmlRels(zr, presPart)
+	if err != nil {
+		return err
+	}
+
+	for i, id := range pres.findAll(nsPresentationML, "sldId") {
+		rel, ok := rels[id.attr(nsOfficeRels, "id")]
+		if !ok {
+			continue
+		}
+		sld, err := readZipXML(zr, rel.Target)
+		if err != nil {
+			return err
+		}
+		var slide slideText
+		slide.collect(sld, false)
+
+		var notes slideText
+		slideRels, err := ooxmlRels(zr, rel.Target)
+		if err != nil {
+			return err
+		}
+		if r, ok := ooxmlRelOfType(slideRels, "notesSlide"); ok {
+			n, err := readZipXML(zr, r.Target)
+			if err != nil {
+				return err
+			}
+			notes.collect(n, true)
+		}
+		writeSlide(b, i+1, slide.title, slide.lines, notes.lines)
+	}
+	return nil
+}
+
+// Helper to write a slide of a presentation. Slides without a title are
+// named by their number so that their text doesn't end up under the
+// heading of the previous one.
+func writeSlide(b *docBuilder, number int, title string, lines, notes []string) {
+	if title == "" && len(lines) == 0 && len(notes) == 0 {
+		return
+	}
+	if title == "" {
+		title = fmt.Sprintf("Slide %d", number)
+	}
+	b.doc.Slides = append(b.doc.Slides, docPage{Offset: b.offset(), Number: number})
+	b.doc.Headings = append(b.doc.Headings, docHeading{Offset: b.offset(), Level: 1, Title: title})
+	b.write("# " + title)
+	if len(lines) > 0 {
+		b.write(strings.Join(lines, "\n"))
+	}
+	if len(notes) > 0 {
+		b.write("Notes: " + strings.Join(notes, "\n"))
+	}
+}
+
+// slideText gathers the title and the lines of text of a slide
+type slideText struct {
+	title string
+	lines []string
+}
+
+// collect walks the shapes below n in document order. With notes set only
+// the notes placeholder of a notes slide is read.
+func (s *slideText) collect(n *xmlNode, notes bool) {
+	for _, c := range n.Children {
+		switch {
+		case c.is(nsPresentationML, "sp"):
+			phType, isPh := "", false
+			if ph := c.find(nsPresentationML, "ph"); ph != nil {
+				phType, isPh = ph.attr("", "type"), true
+			}
+			if notes && (!isPh || phType != "body") {
+				continue
+			}
+			// Slide numbers, dates and footers repeat on every slide
+			if phType == "sldNum" || phType == "dt" || phType == "ftr" {
+				continue
+			}
+			lines := drawingParagraphs(c)
+			if (phType == "title" || phType == "ctrTitle") && s.title == "" {
+				s.title = strings.Join(lines, " ")
+				continue
+			}
+			s.lines = append(s.lines, lines...)
+		case c.is(nsDrawingML, "tbl"):
+			for _, tr := range c.findAll(nsDrawingML, "tr") {
+				var cells []string
+				for _, tc := range tr.findAll(nsDrawingML, "tc") {
+					cells = append(cells, tableCell(strings.Join(drawingParagraphs(tc), " ")))
+				}
+				if strings.TrimSpace(strings.Join(cells, "")) != "" {
+					s.lines = append(s.lines, "| "+strings.Join(cells, " | ")+" |")
+				}
+			}
+		default:
+			s.collect(c, notes)
+		}
+	}
+}
+
+// Helper to get the non-empty paragraphs of the text bodies below n
+func drawingParagraphs(n *xmlNode) []string {
+	var lines []string
+	for _, p := range n.findAll(nsDrawingML, "p") {
+		var sb strings.Builder
+		var walk func(*xmlNode)
+		walk = func(n *xmlNode) {
+			for _, c := range n.Children {
+				switch {
+				case c.is(nsDrawingML, "t"):
+					sb.WriteString(c.text())
+				case c.is(nsDrawingML, "br"):
+					sb.WriteString("\n")
+				default:
+					walk(c)
+				}
+			}
+		}
+		walk(p)
+		if text := collapseSpace(sb.String()); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return lines
+}
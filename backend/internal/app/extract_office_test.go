@@ -0,0 +1,183 @@
+package app
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestZip writes a zip file with the given parts to a temporary
+// directory and returns its path
+func writeTestZip(t *testing.T, name string, parts map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Helper to parse a test snippet and return its first element
+func parseTestXML(t *testing.T, s string) *xmlNode {
+	t.Helper()
+	root, err := parseXML([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range root.Children {
+		if c.Name.Local != "" {
+			return c
+		}
+	}
+	t.Fatal("no element in test XML")
+	return nil
+}
+
+func TestXlsxColumn(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+		ok   bool
+	}{
+		{"A1", 0, true},
+		{"Z9", 25, true},
+		{"AA1", 26, true},
+		{"AZ3", 51, true},
+		{"XFD1", 16383, true},
+		{"ZZZZ1", xlsxMaxColumns, true},
+		{"12", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := xlsxColumn(tt.ref)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("xlsxColumn(%q) = %d, %v, want %d, %v", tt.ref, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestXlsxRows(t *testing.T) {
+	shared := []string{"Name", "a | b"}
+	ws := parseTestXML(t, `<worksheet xmlns="`+nsSpreadsheetML+`"><sheetData>
+		<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+		<row r="2"><c r="B2"><v>0.30000000000000004</v></c><c r="C2" t="b"><v>1</v></c><c r="D2"/></row>
+		<row r="3"><c r="A3" t="inlineStr"><is><r><t>rich </t></r><r><t>text</t></r></is></c></row>
+		<row r="4"><c r="A4"/></row>
+		<row r="5"><c t="str"><v>formula</v></c><c><v>1E3</v></c><c r="E5" t="s"><v>9</v></c></row>
+	</sheetData></worksheet>`)
+
+	want := []string{
+		"| Name |  | a \\| b |",
+		"|  | 0.3 | TRUE |",
+		"| rich text |",
+		"| formula | 1000 |",
+	}
+	got := xlsxRows(ws, shared)
+	if len(got) != len(want) {
+		t.Fatalf("xlsxRows() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExtractXlsx(t *testing.T) {
+	path := writeTestZip(t, "book.xlsx", map[string]string{
+		"_rels/.rels": `<Relationships xmlns="` + nsPackageRels + `">
+			<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+		</Relationships>`,
+		"docProps/core.xml": `<cp:coreProperties xmlns:cp="x" xmlns:dc="` + nsDublinCore + `"><dc:title>Stock</dc:title></cp:coreProperties>`,
+		"xl/workbook.xml": `<workbook xmlns="` + nsSpreadsheetML + `" xmlns:r="` + nsOfficeRels + `"><sheets>
+			<sheet name="Items" r:id="rId1"/>
+			<sheet name="Secret" state="hidden" r:id="rId2"/>
+			<sheet name="" r:id="rId3"/>
+		</sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="` + nsPackageRels + `">
+			<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+			<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+			<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet3.xml"/>
+			<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+		</Relationships>`,
+		"xl/sharedStrings.xml":     `<sst xmlns="` + nsSpreadsheetML + `"><si><t>Widget</t></si><si><t>Gadget</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="` + nsSpreadsheetML + `"><sheetData><row><c t="s"><v>0</v></c><c><v>4</v></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="` + nsSpreadsheetML + `"><sheetData><row><c><v>1</v></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet3.xml": `<worksheet xmlns="` + nsSpreadsheetML + `"><sheetData><row><c t="s"><v>1</v></c></row></sheetData></worksheet>`,
+	})
+
+	doc, err := extractXlsx(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Items\n\n| Widget | 4 |\n\n# Sheet 3\n\n| Gadget |"; doc.Text != want {
+		t.Errorf("extractXlsx() text = %q, want %q", doc.Text, want)
+	}
+	if doc.Title != "Stock" {
+		t.Errorf("extractXlsx() title = %q, want %q", doc.Title, "Stock")
+	}
+	if len(doc.Sheets) != 2 || doc.Sheets[1].Number != 3 {
+		t.Errorf("extractXlsx() sheets = %+v, want sheets 1 and 3", doc.Sheets)
+	}
+}
+
+func TestExtractPptx(t *testing.T) {
+	const ns = `xmlns:p="` + nsPresentationML + `" xmlns:a="` + nsDrawingML + `" xmlns:r="` + nsOfficeRels + `"`
+	shape := func(ph, text string) string {
+		s := `<p:sp>`
+		if ph != "" {
+			s += `<p:nvSpPr><p:nvPr><p:ph type="` + ph + `"/></p:nvPr></p:nvSpPr>`
+		}
+		return s + `<p:txBody><a:p><a:r><a:t>` + text + `</a:t></a:r></a:p></p:txBody></p:sp>`
+	}
+	path := writeTestZip(t, "deck.pptx", map[string]string{
+		"ppt/presentation.xml": `<p:presentation ` + ns + `><p:sldIdLst>
+			<p:sldId id="256" r:id="rId2"/><p:sldId id="257" r:id="rId3"/>
+		</p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships xmlns="` + nsPackageRels + `">
+			<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide1.xml"/>
+			<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide2.xml"/>
+		</Relationships>`,
+		"ppt/slides/slide1.xml": `<p:sld ` + ns + `><p:cSld><p:spTree>` +
+			shape("title", "Roadmap") + shape("", "Ship it") + shape("sldNum", "1") +
+			`<p:graphicFrame><a:graphic><a:graphicData><a:tbl>
+				<a:tr><a:tc><a:txBody><a:p><a:r><a:t>Q1</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:p><a:r><a:t>Beta</a:t></a:r></a:p></a:txBody></a:tc></a:tr>
+			</a:tbl></a:graphicData></a:graphic></p:graphicFrame>` +
+			`</p:spTree></p:cSld></p:sld>`,
+		"ppt/slides/_rels/slide1.xml.rels": `<Relationships xmlns="` + nsPackageRels + `">
+			<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide" Target="../notesSlides/notesSlide1.xml"/>
+		</Relationships>`,
+		"ppt/notesSlides/notesSlide1.xml": `<p:notes ` + ns + `><p:cSld><p:spTree>` +
+			shape("sldImg", "image") + shape("body", "Mention the date") +
+			`</p:spTree></p:cSld></p:notes>`,
+		"ppt/slides/slide2.xml": `<p:sld ` + ns + `><p:cSld><p:spTree>` + shape("", "Questions?") + `</p:spTree></p:cSld></p:sld>`,
+	})
+
+	doc, err := extractPptx(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Roadmap\n\nShip it\n| Q1 | Beta |\n\nNotes: Mention the date\n\n# Slide 2\n\nQuestions?"
+	if doc.Text != want {
+		t.Errorf("extractPptx() text = %q, want %q", doc.Text, want)
+	}
+	if len(doc.Slides) != 2 || len(doc.Headings) != 2 {
+		t.Errorf("extractPptx() slides = %+v, headings = %+v", doc.Slides, doc.Headings)
+	}
+}
@@ -0,0 +1,347 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// extractPDF extracts the text of a PDF page by page. Text is put in rows by
+// position, rows that are further apart than usual start a new paragraph
+// and words hyphenated at the end of a row are joined again. Title, author
+// and dates come from the document info dictionary.
+//
+// Files encrypted with an empty user password, which only restricts
+// printing or copying, are decrypted if they use RC4 or 128-bit AES. Other
+// files fail with an error, AES-256 isn't supported by the reader.
+func extractPDF(path string, info os.FileInfo) (doc *extractedDoc, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	// The reader panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("failed to read PDF file %s: %v", path, r)
+		}
+	}()
+	pdfReader, err := pdf.NewReader(f, info.Size())
+	if err == pdf.ErrInvalidPassword {
+		return nil, fmt.Errorf("PDF file %s is password protected", path)
+	} else if err != nil && pdfUsesAES256(err) {
+		return nil, fmt.Errorf("PDF file %s is encrypted with AES-256, which is not supported", path)
+	} else if err != nil && strings.Contains(err.Error(), "unsupported PDF: encryption") {
+		return nil, fmt.Errorf("PDF file %s uses unsupported encryption: %w", path, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read PDF file %s: %w", path, err)
+	}
+
+	var b docBuilder
+	pdfInfo(pdfReader, &b.doc)
+	numPages := pdfReader.NumPage()
+	var pages []pdfPage
+	var failed []int
+	var lastErr error
+	for i := 1; i <= numPages; i++ {
+		page := pdfReader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := pdfPageText(page)
+		if err != nil {
+			failed = append(failed, i)
+			lastErr = err
+			continue
+		}
+		if text != "" {
+			pages = append(pages, pdfPage{number: i, text: text})
+		}
+	}
+
+	// A word hyphenated at the end of a page continues on the next one
+	for i := 1; i < len(pages); i++ {
+		if pages[i].number == pages[i-1].number+1 {
+			pages[i-1].text, pages[i].text = joinHyphenatedPages(pages[i-1].text, pages[i].text)
+		}
+	}
+	for _, p := range pages {
+		if p.text == "" {
+			continue
+		}
+		b.doc.Pages = append(b.doc.Pages, docPage{Offset: b.offset(), Number: p.number})
+		b.write(p.text)
+	}
+
+	if len(failed) > 0 {
+		if len(b.doc.Pages) == 0 {
+			return nil, fmt.Errorf("failed to extract text of PDF file %s: %w", path, lastErr)
+		}
+		log.Printf("Warning: failed to extract text of pages %v of %s: %v", failed, path, lastErr)
+	}
+	return b.result(), nil
+}
+
+// Helper to recognize the reader's errors for AES-256 encryption, version 5
+// with revision 5 or 6 from Acrobat 9 and PDF 2.0. The reader checks the key
+// length before the version.
+func pdfUsesAES256(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "256-bit encryption key") || strings.Contains(msg, "encryption version V=5")
+}
+
+type pdfPage struct {
+	number int
+	text   string
+}
+
+// joinHyphenatedPages moves the rest of a word hyphenated at the end of a
+// page up from the start of the next page, like dehyphenate does for rows
+func joinHyphenatedPages(prev, next string) (string, string) {
+	if !strings.HasSuffix(prev, "-") {
+		return prev, next
+	}
+	head, last := "", prev
+	if i := strings.LastIndex(prev, "\n"); i >= 0 {
+		head, last = prev[:i+1], prev[i+1:]
+	}
+	first, tail := next, ""
+	if i := strings.Index(next, "\n"); i >= 0 {
+		first, tail = next[:i], next[i:]
+	}
+
+	lines := dehyphenate([]string{last, first})
+	if lines[0] == last {
+		return prev, next
+	}
+	if len(lines) == 2 {
+		return head + lines[0], lines[1] + tail
+	}
+	return head + lines[0], strings.TrimLeft(tail, "\n")
+}
+
+// pdfPageText returns the text of a page, falling back to the plain text
+// in content stream order if the layout can't be read
+func pdfPageText(page pdf.Page) (string, error) {
+	content, err := pdfContent(page)
+	if err == nil {
+		return pdfLayoutText(content.Text), nil
+	}
+	text, plainErr := page.GetPlainText(nil)
+	if plainErr != nil {
+		return "", plainErr
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// Helper to get the positioned text of a page, turning panics of the
+// reader into errors
+func pdfContent(page pdf.Page) (content pdf.Content, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return page.Content(), nil
+}
+
+// pdfRow is a line of text on a page
+type pdfRow struct {
+	y     float64 // baseline
+	size  float64 // largest font size
+	glyph []pdf.Text
+}
+
+// pdfLayoutText puts the pieces of text of a page in rows, top to bottom
+// and left to right, and the rows in paragraphs
+func pdfLayoutText(texts []pdf.Text) string {
+	sort.SliceStable(texts, func(i, j int) bool {
+		if texts[i].Y != texts[j].Y {
+			return texts[i].Y > texts[j].Y
+		}
+		return texts[i].X < texts[j].X
+	})
+
+	// Pieces whose baselines are within half a font size form a row, which
+	// keeps sub- and superscripts in their line
+	var rows []*pdfRow
+	for _, t := range texts {
+		if t.S == "" {
+			continue
+		}
+		var row *pdfRow
+		if len(rows) > 0 {
+			row = rows[len(rows)-1]
+			if row.y-t.Y > math.Max(math.Max(row.size, t.FontSize), 2)/2 {
+				row = nil
+			}
+		}
+		if row == nil {
+			row = &pdfRow{y: t.Y}
+			rows = append(rows, row)
+		}
+		row.size = math.Max(row.size, t.FontSize)
+		row.glyph = append(row.glyph, t)
+	}
+
+	var lines []string
+	var gaps []float64
+	for i, row := range rows {
+		lines = append(lines, row.text())
+		if i > 0 {
+			gaps = append(gaps, rows[i-1].y-row.y)
+		}
+	}
+
+	// A paragraph ends where the gap to the next row is clearly wider than
+	// the usual line spacing or the font size changes, as after a heading
+	usual := 0.0
+	if len(gaps) > 0 {
+		sorted := append([]float64(nil), gaps...)
+		sort.Float64s(sorted)
+		usual = sorted[(len(sorted)-1)/2]
+	}
+	var paragraphs [][]string
+	var current []string
+	for i, line := range lines {
+		if i > 0 && len(current) > 0 && (gaps[i-1] > usual*1.5 || pdfSizeChanged(rows[i-1].size, rows[i].size)) {
+			paragraphs = append(paragraphs, current)
+			current = nil
+		}
+		if line != "" {
+			current = append(current, line)
+		}
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, current)
+	}
+
+	blocks := make([]string, len(paragraphs))
+	for i, p := range paragraphs {
+		blocks[i] = strings.Join(dehyphenate(p), "\n")
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// Helper to tell whether two rows are set in clearly different font sizes
+func pdfSizeChanged(a, b float64) bool {
+	if a <= 0 || b <= 0 {
+		return false
+	}
+	return math.Max(a, b)/math.Min(a, b) > 1.2
+}
+
+// text joins the pieces of a row, adding a space where the gap between two
+// pieces is wider than a narrow space
+func (r *pdfRow) text() string {
+	sort.SliceStable(r.glyph, func(i, j int) bool { return r.glyph[i].X < r.glyph[j].X })
+	var sb strings.Builder
+	end := 0.0
+	for i, t := range r.glyph {
+		if i > 0 && t.X-end > math.Max(t.FontSize, 1)*0.15 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(t.S)
+		end = math.Max(end, t.X+t.W)
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// dehyphenate joins words split by a hyphen at the end of a line, moving
+// the rest of the word up to the first line
+func dehyphenate(lines []string) []string {
+	for i := 0; i+1 < len(lines); i++ {
+		line := lines[i]
+		if !strings.HasSuffix(line, "-") || strings.HasSuffix(line, "--") {
+			continue
+		}
+		before, _ := utf8.DecodeLastRuneInString(line[:len(line)-1])
+		after, _ := utf8.DecodeRuneInString(lines[i+1])
+		if !unicode.IsLetter(before) || !unicode.IsLower(after) {
+			continue
+		}
+		rest := lines[i+1]
+		word, remainder, _ := strings.Cut(rest, " ")
+		lines[i] = line[:len(line)-1] + word
+		lines[i+1] = remainder
+	}
+
+	kept := lines[:0]
+	for _, line := range lines {
+		if line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// pdfInfo copies title, author and dates from the document info dictionary.
+// They're optional, a broken dictionary is ignored.
+func pdfInfo(r *pdf.Reader, doc *extractedDoc) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("Warning: failed to read PDF info dictionary: %v", rec)
+		}
+	}()
+	info := r.Trailer().Key("Info")
+	if info.IsNull() {
+		return
+	}
+	doc.Title = tableCell(pdfInfoText(info, "Title"))
+	doc.Author = tableCell(pdfInfoText(info, "Author"))
+	doc.Created, _ = parsePDFDate(pdfInfoText(info, "CreationDate"))
+	doc.Updated, _ = parsePDFDate(pdfInfoText(info, "ModDate"))
+}
+
+// Helper to read a text entry of the info dictionary. The reader leaves the
+// padding on strings decrypted with AES, which ends them in control bytes.
+func pdfInfoText(info pdf.Value, key string) string {
+	return strings.TrimRightFunc(info.Key(key).Text(), unicode.IsControl)
+}
+
+// parsePDFDate parses a date like "D:20240115093000+01'00'". Everything
+// after the year is optional, times without an offset are taken as UTC.
+func parsePDFDate(s string) (time.Time, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	n := 0
+	for n < len(s) && n < 14 && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n < 4 || n%2 != 0 {
+		return time.Time{}, false
+	}
+	// Missing month and day default to 1, missing time to midnight
+	digits := s[:n] + "0101000000"[n-4:]
+
+	loc := time.UTC
+	if tz := s[n:]; len(tz) >= 3 && (tz[0] == '+' || tz[0] == '-') {
+		hours, err := strconv.Atoi(tz[1:3])
+		if err != nil {
+			return time.Time{}, false
+		}
+		minutes := 0
+		if len(tz) >= 6 && tz[3] == '\'' {
+			minutes, _ = strconv.Atoi(tz[4:6])
+		}
+		offset := hours*3600 + minutes*60
+		if tz[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	t, err := time.ParseInLocation("20060102150405", digits, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
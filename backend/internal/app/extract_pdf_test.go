@@ -0,0 +1,415 @@
+package app
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// writeTestPDF writes a PDF file with a page for each list of lines, set in
+// a monospaced 12 point font 14 points apart
+func writeTestPDF(t *testing.T, info string, pages ...[]string) string {
+	t.Helper()
+	return writeTestPDFObjects(t, testPDFObjects(info, pages), "")
+}
+
+// testPDFObjects returns the objects of the PDF written by writeTestPDF,
+// numbered from 1: the catalog, the page tree, the font, the info
+// dictionary and a content stream and page object for each page
+func testPDFObjects(info string, pages [][]string) []string {
+	widths := strings.TrimSpace(strings.Repeat("600 ", 95))
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // the page tree, once the pages are known
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding /FirstChar 32 /LastChar 126 /Widths [" + widths + "] >>",
+		"<< " + info + " >>",
+	}
+	var kids []string
+	for _, lines := range pages {
+		var content strings.Builder
+		content.WriteString("BT /F1 12 Tf 72 720 Td 14 TL\n")
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", line)
+		}
+		content.WriteString("ET")
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", len(objects)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+	return objects
+}
+
+// writeTestPDFObjects writes a PDF file with the objects and the given
+// entries added to the trailer
+func writeTestPDFObjects(t *testing.T, objects []string, trailer string) string {
+	t.Helper()
+	var out strings.Builder
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R %s>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+
+	path := filepath.Join(t.TempDir(), "test.pdf")
+	if err := os.WriteFile(path, []byte(out.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var pdfStringRe = regexp.MustCompile(`\(((?:[^()\\]|\\.)*)\)`)
+
+// encryptTestPDF encrypts the strings and streams of the objects with the
+// standard security handler and an empty user password, the way files that
+// only restrict printing or copying are, using 128-bit RC4 or AES. It adds
+// the encryption dictionary and returns the entries for the trailer.
+func encryptTestPDF(objects []string, useAES bool) ([]string, string) {
+	pad := []byte{
+		0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+		0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+	}
+	id := []byte("0123456789abcdef")
+	owner := bytes.Repeat([]byte{0x5a}, 32) // the owner password isn't checked when reading
+	perms := int32(-3904)                   // no printing or copying
+	p := uint32(perms)
+
+	// File key, algorithm 2 of PDF 32000-1 §7.6.3.3
+	h := md5.New()
+	h.Write(pad)
+	h.Write(owner)
+	h.Write([]byte{byte(p), byte(p >> 8), byte(p >> 16), byte(p >> 24)})
+	h.Write(id)
+	key := h.Sum(nil)
+	for i := 0; i < 50; i++ {
+		sum := md5.Sum(key)
+		key = sum[:]
+	}
+
+	// User password entry, algorithm 5
+	sum := md5.Sum(append(append([]byte(nil), pad...), id...))
+	user := sum[:]
+	for i := 0; i <= 19; i++ {
+		k := make([]byte, len(key))
+		for j := range key {
+			k[j] = key[j] ^ byte(i)
+		}
+		c, _ := rc4.NewCipher(k)
+		c.XORKeyStream(user, user)
+	}
+	user = append(user, make([]byte, 16)...)
+
+	encrypt := func(num int, data []byte) []byte {
+		h := md5.New()
+		h.Write(key)
+		h.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), 0, 0})
+		if useAES {
+			h.Write([]byte("sAlT"))
+		}
+		objKey := h.Sum(nil)
+		if !useAES {
+			out := make([]byte, len(data))
+			c, _ := rc4.NewCipher(objKey)
+			c.XORKeyStream(out, data)
+			return out
+		}
+		n := aes.BlockSize - len(data)%aes.BlockSize
+		data = append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+		block, _ := aes.NewCipher(objKey)
+		out := make([]byte, aes.BlockSize+len(data))
+		copy(out, id) // any IV will do
+		cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], data)
+		return out
+	}
+
+	encrypted := make([]string, len(objects))
+	for i, obj := range objects {
+		dict, stream, isStream := strings.Cut(obj, "\nstream\n")
+		dict = pdfStringRe.ReplaceAllStringFunc(dict, func(s string) string {
+			return fmt.Sprintf("<%x>", encrypt(i+1, []byte(s[1:len(s)-1])))
+		})
+		if isStream {
+			data := encrypt(i+1, []byte(strings.TrimSuffix(stream, "\nendstream")))
+			dict = regexp.MustCompile(`/Length \d+`).ReplaceAllString(dict, fmt.Sprintf("/Length %d", len(data)))
+			encrypted[i] = dict + "\nstream\n" + string(data) + "\nendstream"
+		} else {
+			encrypted[i] = dict
+		}
+	}
+
+	filter := "/V 2 /R 3"
+	if useAES {
+		filter = "/V 4 /R 4 /CF << /StdCF << /CFM /AESV2 /AuthEvent /DocOpen /Length 16 >> >> /StmF /StdCF /StrF /StdCF"
+	}
+	encrypted = append(encrypted, fmt.Sprintf("<< /Filter /Standard %s /Length 128 /O <%x> /U <%x> /P %d >>", filter, owner, user, perms))
+	return encrypted, fmt.Sprintf("/Encrypt %d 0 R /ID [<%x> <%x>] ", len(encrypted), id, id)
+}
+
+func TestExtractPDFPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		pages     [][]string
+		want      string
+		wantPages []int
+	}{
+		{
+			name:      "hyphenated across a page break",
+			pages:     [][]string{{"The committee met to", "discuss the bud-"}, {"get for next year.", "It was approved."}},
+			want:      "The committee met to\ndiscuss the budget\n\nfor next year.\nIt was approved.",
+			wantPages: []int{1, 2},
+		},
+		{
+			name:      "page holding only the rest of the word",
+			pages:     [][]string{{"A long exam-"}, {"ple"}, {"Next page"}},
+			want:      "A long example\n\nNext page",
+			wantPages: []int{1, 3},
+		},
+		{
+			name:      "capitalized word after a page break",
+			pages:     [][]string{{"Ends with Jean-"}, {"Luc Picard"}},
+			want:      "Ends with Jean-\n\nLuc Picard",
+			wantPages: []int{1, 2},
+		},
+		{
+			name:      "hyphenated within a page",
+			pages:     [][]string{{"well-known hy-", "phenation"}},
+			want:      "well-known hyphenation",
+			wantPages: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestPDF(t, "/Title (Test)", tt.pages...)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := extractPDF(path, info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Text != tt.want {
+				t.Errorf("extractPDF() text = %q, want %q", doc.Text, tt.want)
+			}
+			var pages []int
+			for _, p := range doc.Pages {
+				pages = append(pages, p.Number)
+			}
+			if fmt.Sprint(pages) != fmt.Sprint(tt.wantPages) {
+				t.Errorf("extractPDF() pages = %v, want %v", pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestExtractPDFInfo(t *testing.T) {
+	path := writeTestPDF(t, "/Title (Annual  Report) /Author (Jane Doe) /CreationDate (D:20240115093000+01'00')", []string{"Text"})
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := extractPDF(path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "Annual Report" || doc.Author != "Jane Doe" {
+		t.Errorf("extractPDF() title = %q, author = %q", doc.Title, doc.Author)
+	}
+	if want := time.Date(2024, 1, 15, 8, 30, 0, 0, time.UTC); !doc.Created.Equal(want) {
+		t.Errorf("extractPDF() created = %v, want %v", doc.Created, want)
+	}
+}
+
+func TestExtractPDFEncrypted(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		useAES bool
+	}{{"RC4", false}, {"AES-128", true}} {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, trailer := encryptTestPDF(testPDFObjects("/Title (Locked  Report)", [][]string{{"Secret text", "on two lines"}}), tt.useAES)
+			path := writeTestPDFObjects(t, objects, trailer)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := extractPDF(path, info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "Secret text\non two lines"; doc.Text != want {
+				t.Errorf("extractPDF() text = %q, want %q", doc.Text, want)
+			}
+			if doc.Title != "Locked Report" {
+				t.Errorf("extractPDF() title = %q, want %q", doc.Title, "Locked Report")
+			}
+		})
+	}
+}
+
+func TestExtractPDFUnsupportedEncryption(t *testing.T) {
+	tests := []struct {
+		name    string
+		encrypt string
+		want    string
+	}{
+		{"AES-256", "/Filter /Standard /V 5 /R 6 /Length 256", "AES-256"},
+		{"AES-256 without a key length", "/Filter /Standard /V 5 /R 5", "AES-256"},
+		{"public key", "/Filter /Adobe.PubSec /V 4", "unsupported encryption"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append(testPDFObjects("", [][]string{{"text"}}), "<< "+tt.encrypt+" >>")
+			trailer := fmt.Sprintf("/Encrypt %d 0 R /ID [<00> <00>] ", len(objects))
+			path := writeTestPDFObjects(t, objects, trailer)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = extractPDF(path, info)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("extractPDF() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinHyphenatedPages(t *testing.T) {
+	tests := []struct {
+		prev, next         string
+		wantPrev, wantNext string
+	}{
+		{"a\nbud-", "get now\nmore", "a\nbudget", "now\nmore"},
+		{"bud-", "get\n\nmore", "budget", "more"},
+		{"bud-", "get", "budget", ""},
+		{"no hyphen", "next", "no hyphen", "next"},
+		{"dash --", "next", "dash --", "next"},
+		{"Jean-", "Luc", "Jean-", "Luc"},
+		{"page 12-", "13", "page 12-", "13"},
+		{"", "next", "", "next"},
+	}
+	for _, tt := range tests {
+		prev, next := joinHyphenatedPages(tt.prev, tt.next)
+		if prev != tt.wantPrev || next != tt.wantNext {
+			t.Errorf("joinHyphenatedPages(%q, %q) = %q, %q, want %q, %q", tt.prev, tt.next, prev, next, tt.wantPrev, tt.wantNext)
+		}
+	}
+}
+
+func TestDehyphenate(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  []string
+	}{
+		{[]string{"the bud-", "get was"}, []string{"the budget", "was"}},
+		{[]string{"the bud-", "get"}, []string{"the budget"}},
+		{[]string{"Мос-", "ковский вокзал"}, []string{"Московский", "вокзал"}},
+		{[]string{"Jean-", "Luc"}, []string{"Jean-", "Luc"}},
+		{[]string{"range 10-", "20"}, []string{"range 10-", "20"}},
+		{[]string{"em dash --", "next"}, []string{"em dash --", "next"}},
+		{[]string{"a-", "b-", "c"}, []string{"ab-", "c"}},
+	}
+	for _, tt := range tests {
+		got := dehyphenate(append([]string(nil), tt.lines...))
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("dehyphenate(%q) = %q, want %q", tt.lines, got, tt.want)
+		}
+	}
+}
+
+func TestPDFLayoutText(t *testing.T) {
+	// Helper to place a word, 6 points per character at 12 points
+	word := func(x, y float64, s string) pdf.Text {
+		return pdf.Text{X: x, Y: y, W: 6 * float64(len(s)), FontSize: 12, S: s}
+	}
+	tests := []struct {
+		name  string
+		texts []pdf.Text
+		want  string
+	}{
+		{
+			name:  "rows top to bottom, words left to right",
+			texts: []pdf.Text{word(130, 700, "world"), word(72, 714, "First"), word(72, 700, "hello"), word(108, 714, "row")},
+			want:  "First row\nhello world",
+		},
+		{
+			name:  "pieces without a gap are one word",
+			texts: []pdf.Text{word(72, 700, "ab"), word(84, 700, "cd")},
+			want:  "abcd",
+		},
+		{
+			name:  "superscript stays in its row",
+			texts: []pdf.Text{word(72, 700, "E=mc"), {X: 96, Y: 704, W: 4, FontSize: 8, S: "2"}},
+			want:  "E=mc2",
+		},
+		{
+			name: "wide gap starts a paragraph",
+			texts: []pdf.Text{
+				word(72, 714, "one"), word(72, 700, "two"), word(72, 686, "three"),
+				word(72, 650, "four"), word(72, 636, "five"),
+			},
+			want: "one\ntwo\nthree\n\nfour\nfive",
+		},
+		{
+			name:  "heading in a larger font",
+			texts: []pdf.Text{{X: 72, Y: 720, W: 80, FontSize: 20, S: "Title"}, word(72, 700, "body"), word(72, 686, "text")},
+			want:  "Title\n\nbody\ntext",
+		},
+		{
+			name:  "hyphenated row",
+			texts: []pdf.Text{word(72, 714, "bud-"), word(72, 700, "get")},
+			want:  "budget",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfLayoutText(tt.texts); got != tt.want {
+				t.Errorf("pdfLayoutText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePDFDate(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Time
+		ok   bool
+	}{
+		{"D:20240115093000+01'00'", time.Date(2024, 1, 15, 8, 30, 0, 0, time.UTC), true},
+		{"D:20240115093000-05'30'", time.Date(2024, 1, 15, 15, 0, 0, 0, time.UTC), true},
+		{"D:20240115093000Z", time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC), true},
+		{"20240115", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), true},
+		{"D:2024", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"D:202401", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"D:20241", time.Time{}, false},
+		{"D:20241315", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parsePDFDate(tt.s)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parsePDFDate(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/philippgille/chromem-go"
+)
+
+func TestMarkdownHeadings(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []docHeading
+	}{
+		{"levels", "# Guide\nIntro\n## Install\n### On Linux\n", []docHeading{
+			{Offset: 0, Level: 1, Title: "Guide"},
+			{Offset: 14, Level: 2, Title: "Install"},
+			{Offset: 25, Level: 3, Title: "On Linux"},
+		}},
+		{"closing hashes", "## Title ##\n#  Spaced  #", []docHeading{
+			{Offset: 0, Level: 2, Title: "Title"},
+			{Offset: 12, Level: 1, Title: "Spaced"},
+		}},
+		{"not headings", "#hashtag\n####### seven\n  # indented\ntext # inline", nil},
+		{"fenced code", "# Real\n```sh\n# comment\n```\n~~~\n## also code\n~~~\n## After", []docHeading{
+			{Offset: 0, Level: 1, Title: "Real"},
+			{Offset: 48, Level: 2, Title: "After"},
+		}},
+		{"rune offsets", "Über Größe\n# Überblick\r\nText", []docHeading{
+			{Offset: 11, Level: 1, Title: "Überblick"},
+		}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownHeadings(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("markdownHeadings(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeadingTrail(t *testing.T) {
+	text := "# Guide\nIntro\n## Install\nSteps\n#### Deep\nMore\n### Linux\napt\n## Usage\nRun\n# Reference\nAPI"
+	doc := &extractedDoc{Text: text, Headings: markdownHeadings(text)}
+	tests := []struct {
+		at   string
+		want []string
+	}{
+		{"Intro", []string{"Guide"}},
+		{"Steps", []string{"Guide", "Install"}},
+		{"More", []string{"Guide", "Install", "Deep"}},
+		{"apt", []string{"Guide", "Install", "Linux"}},
+		{"Run", []string{"Guide", "Usage"}},
+		{"API", []string{"Reference"}},
+	}
+	for _, tt := range tests {
+		offset := len([]rune(text[:strings.Index(text, tt.at)]))
+		if got := doc.headingTrail(offset); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("headingTrail() at %q = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+	if got := (&extractedDoc{Text: "Plain"}).headingTrail(3); len(got) != 0 {
+		t.Errorf("headingTrail() without headings = %q", got)
+	}
+}
+
+func TestMarkdownChunkHeadings(t *testing.T) {
+	cfg := testConfig(t)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"guide.md":  "# Guide\n\nIntro.\n\n## Install\n\n" + testParagraphs(1),
+		"notes.txt": "# Not a heading in plain text",
+	})
+	ws := newIndexedWorkspace(t, cfg, chromem.NewDB(), dir, &fakeEmbedder{})
+	coll := ws.db.GetCollection(ws.name, ws.embeddingFunc)
+
+	chunks := ws.metadata.Files["guide.md"].Chunks
+	if chunks < 2 {
+		t.Fatalf("guide.md has %d chunks, want several", chunks)
+	}
+	for i, want := range map[int]string{0: "Guide", chunks - 1: "Guide > Install"} {
+		doc, err := coll.GetByID(context.Background(), chunkID("guide.md", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Metadata[metaHeading] != want || doc.Metadata[metaFileType] != "markdown" {
+			t.Errorf("chunk %d metadata = %v, want heading %q", i, doc.Metadata, want)
+		}
+	}
+	doc, err := coll.GetByID(context.Background(), chunkID("notes.txt", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Metadata[metaHeading]; ok {
+		t.Errorf("plain text chunk has a heading: %v", doc.Metadata)
+	}
+}
+
+// Helper to set the version of an extractor for the duration of a test
+func setExtractorVersion(t *testing.T, fileType string, version int) {
+	old, ok := extractorVersions[fileType]
+	extractorVersions[fileType] = version
+	t.Cleanup(func() {
+		if ok {
+			extractorVersions[fileType] = old
+		} else {
+			delete(extractorVersions, fileType)
+		}
+	})
+}
+
+func TestExtractorVersionReindex(t *testing.T) {
+	cfg := testConfig(t)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"a.txt": "Text.", "b.md": "# Markdown", "broken.pdf": "not a pdf"})
+	ws := newIndexedWorkspace(t, cfg, chromem.NewDB(), dir, &fakeEmbedder{})
+	if fi := ws.metadata.Files["a.txt"]; fi.Extractor != 0 {
+		t.Fatalf("a.txt recorded with extractor %d", fi.Extractor)
+	}
+
+	// Only files of the upgraded types are extracted again, failed ones
+	// are retried
+	setExtractorVersion(t, "txt", 1)
+	setExtractorVersion(t, "pdf", extractorVersion("x.pdf")+1)
+	if err := ws.indexDocuments(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := ws.progress.Status(); s.FilesDiscovered != 2 || s.FilesDone != 1 || s.FilesFailed != 1 {
+		t.Errorf("status = %+v, want a.txt and broken.pdf extracted again", s)
+	}
+	if fi := ws.metadata.Files["a.txt"]; fi.Extractor != 1 {
+		t.Errorf("a.txt recorded with extractor %d, want 1", fi.Extractor)
+	}
+	if f := ws.metadata.Failed["broken.pdf"]; f.Extractor != extractorVersion("x.pdf") {
+		t.Errorf("broken.pdf recorded with extractor %d", f.Extractor)
+	}
+
+	// Nothing changed since
+	if err := ws.indexDocuments(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := ws.progress.Status(); s.FilesDiscovered != 0 {
+		t.Errorf("status = %+v, want nothing to do", s)
+	}
+}
+
+func TestSchemaVersionReindex(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int
+		autoReindex bool
+		wantErr     string
+	}{
+		{"older format", metadataSchemaVersion - 1, true, ""},
+		{"older format without auto reindex", metadataSchemaVersion - 1, false, "index format"},
+		{"newer format", metadataSchemaVersion + 1, true, "newer version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{"a.txt": "Text.", "b.md": "# Markdown"})
+			fake := &fakeEmbedder{}
+			ws := newIndexedWorkspace(t, cfg, chromem.NewDB(), dir, fake)
+			ws.metadata.SchemaVersion = tt.version
+			if err := ws.saveMetadata(); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg.AutoReindex = tt.autoReindex
+			restarted := newTestWorkspace(t, cfg, chromem.NewDB(), defaultWorkspaceName, dir)
+			setTestEmbedder(restarted, fake)
+			err := restarted.load(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !restarted.rebuilding.Load() {
+				t.Error("old index not marked for a rebuild")
+			}
+
+			// The rebuild extracts every file again
+			if err := restarted.indexDocuments(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if s := restarted.progress.Status(); s.FilesDone != 2 {
+				t.Errorf("status = %+v, want both files indexed again", s)
+			}
+			if restarted.rebuilding.Load() || restarted.metadata.SchemaVersion != metadataSchemaVersion {
+				t.Errorf("after the rebuild: rebuilding %v, format %d", restarted.rebuilding.Load(), restarted.metadata.SchemaVersion)
+			}
+			checkIndexConsistency(t, restarted)
+			if _, err := os.Stat(filepath.Join(cfg.DataDir, "metadata.json")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetrievalFilter restricts retrieval to some of the indexed files. All set
+// conditions have to match. Paths are as indexed in the workspace, relative
+// to its directory or prefixed with the directory's name if it has several,
+// and use forward slashes; dates are RFC 3339 timestamps or YYYY-MM-DD.
+type RetrievalFilter struct {
+	PathPrefix     string   `json:"path_prefix,omitempty"`
+	Extensions     []string `json:"extensions,omitempty"`
+	ModifiedAfter  string   `json:"modified_after,omitempty"`
+	ModifiedBefore string   `json:"modified_before,omitempty"`
+	Files          []string `json:"files,omitempty"`
+}
+
+// fileFilter is a validated RetrievalFilter
+type fileFilter struct {
+	prefix     string
+	extensions map[string]bool
+	after      time.Time
+	before     time.Time
+	files      map[string]bool
+}
+
+// Helper to validate a filter from a request. A nil or empty filter gives
+// nil, which matches every file.
+func compileFilter(f *RetrievalFilter) (*fileFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	ff := &fileFilter{}
+	empty := true
+	if p := strings.Trim(f.PathPrefix, "/"); p != "" {
+		ff.prefix = filepath.Clean(filepath.FromSlash(p))
+		if ff.prefix == ".." || strings.HasPrefix(ff.prefix, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("path_prefix must be inside the workspace")
+		}
+		empty = false
+	}
+	if len(f.Extensions) > 0 {
+		ff.extensions = make(map[string]bool)
+		for _, ext := range f.Extensions {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			ff.extensions[ext] = true
+		}
+		empty = false
+	}
+	if f.ModifiedAfter != "" {
+		t, err := parseFilterDate(f.ModifiedAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modified_after: %w", err)
+		}
+		ff.after = t
+		empty = false
+	}
+	if f.ModifiedBefore != "" {
+		t, err := parseFilterDate(f.ModifiedBefore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modified_before: %w", err)
+		}
+		ff.before = t
+		empty = false
+	}
+	if len(f.Files) > 0 {
+		ff.files = make(map[string]bool)
+		for _, p := range f.Files {
+			ff.files[filepath.Clean(filepath.FromSlash(strings.TrimPrefix(p, "/")))] = true
+		}
+		empty = false
+	}
+
+	if empty {
+		return nil, nil
+	}
+	return ff, nil
+}
+
+// Helper to parse a date of a filter, either a full timestamp or a day
+func parseFilterDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func (f *fileFilter) match(relPath string, info FileInfo) bool {
+	if f.prefix != "" && !isUnderPath(relPath, f.prefix) {
+		return false
+	}
+	if f.extensions != nil && !f.extensions[strings.ToLower(filepath.Ext(relPath))] {
+		return false
+	}
+	if !f.after.IsZero() && info.LastModified.Before(f.after) {
+		return false
+	}
+	if !f.before.IsZero() && !info.LastModified.Before(f.before) {
+		return false
+	}
+	if f.files != nil && !f.files[relPath] {
+		return false
+	}
+	return true
+}
+
+// matchingFiles returns the indexed files the filter matches and their
+// total number of chunks
+func (ws *workspace) matchingFiles(f *fileFilter) (map[string]bool, int) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	files := make(map[string]bool)
+	chunks := 0
+	for relPath, info := range ws.metadata.Files {
+		if f.match(relPath, info) {
+			files[relPath] = true
+			chunks += info.Chunks
+		}
+	}
+	return files, chunks
+}
+
+// Helper to get the file a chunk belongs to from its ID
+func chunkFile(id string) string {
+	if i := strings.LastIndex(id, "#chunk-"); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  *RetrievalFilter
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "nil", filter: nil, wantNil: true},
+		{name: "empty", filter: &RetrievalFilter{}, wantNil: true},
+		{name: "slash only", filter: &RetrievalFilter{PathPrefix: "/"}, wantNil: true},
+		{name: "prefix", filter: &RetrievalFilter{PathPrefix: "/contracts/2024/"}},
+		{name: "prefix cleaned inside", filter: &RetrievalFilter{PathPrefix: "a/b/.."}},
+		{name: "parent", filter: &RetrievalFilter{PathPrefix: ".."}, wantErr: true},
+		{name: "outside", filter: &RetrievalFilter{PathPrefix: "../x"}, wantErr: true},
+		{name: "outside after cleaning", filter: &RetrievalFilter{PathPrefix: "a/../.."}, wantErr: true},
+		{name: "outside deeper", filter: &RetrievalFilter{PathPrefix: "a/../../b"}, wantErr: true},
+		{name: "dotted name", filter: &RetrievalFilter{PathPrefix: "..notes"}},
+		{name: "day", filter: &RetrievalFilter{ModifiedAfter: "2024-01-31"}},
+		{name: "timestamp", filter: &RetrievalFilter{ModifiedBefore: "2024-01-31T12:00:00Z"}},
+		{name: "bad after", filter: &RetrievalFilter{ModifiedAfter: "31/01/2024"}, wantErr: true},
+		{name: "bad before", filter: &RetrievalFilter{ModifiedBefore: "yesterday"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ff, err := compileFilter(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compileFilter() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (ff == nil) != tt.wantNil {
+				t.Errorf("compileFilter() = %+v, want nil %v", ff, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestFileFilterMatch(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	file := func(modified string) FileInfo { return FileInfo{LastModified: day(modified)} }
+
+	tests := []struct {
+		name    string
+		filter  RetrievalFilter
+		relPath string
+		info    FileInfo
+		want    bool
+	}{
+		{"prefix", RetrievalFilter{PathPrefix: "contracts"}, "contracts/a.pdf", file("2024-01-01"), true},
+		{"prefix is the file", RetrievalFilter{PathPrefix: "contracts/a.pdf"}, "contracts/a.pdf", file("2024-01-01"), true},
+		{"prefix of a name only", RetrievalFilter{PathPrefix: "contract"}, "contracts/a.pdf", file("2024-01-01"), false},
+		{"cleaned prefix", RetrievalFilter{PathPrefix: "contracts/old/.."}, "contracts/a.pdf", file("2024-01-01"), true},
+		{"extension", RetrievalFilter{Extensions: []string{"PDF"}}, "a.Pdf", file("2024-01-01"), true},
+		{"other extension", RetrievalFilter{Extensions: []string{".md", "txt"}}, "a.pdf", file("2024-01-01"), false},
+		{"after", RetrievalFilter{ModifiedAfter: "2024-01-01"}, "a.md", file("2024-01-01"), true},
+		{"before after", RetrievalFilter{ModifiedAfter: "2024-01-02"}, "a.md", file("2024-01-01"), false},
+		{"before is exclusive", RetrievalFilter{ModifiedBefore: "2024-01-01"}, "a.md", file("2024-01-01"), false},
+		{"files", RetrievalFilter{Files: []string{"/docs/a.md"}}, filepath.FromSlash("docs/a.md"), file("2024-01-01"), true},
+		{"not in files", RetrievalFilter{Files: []string{"docs/a.md"}}, "a.md", file("2024-01-01"), false},
+		{
+			"all conditions",
+			RetrievalFilter{PathPrefix: "docs", Extensions: []string{"md"}, ModifiedAfter: "2023-06-01", ModifiedBefore: "2024-06-01"},
+			filepath.FromSlash("docs/guide/a.md"), file("2024-01-01"), true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ff, err := compileFilter(&tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ff.match(filepath.FromSlash(tt.relPath), tt.info); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.relPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkFile(t *testing.T) {
+	tests := []struct {
+		id, want string
+	}{
+		{chunkID("docs/a.md", 3), "docs/a.md"},
+		{chunkID("a#chunk-1.md", 0), "a#chunk-1.md"},
+		{"docs/a.md", "docs/a.md"},
+	}
+	for _, tt := range tests {
+		if got := chunkFile(tt.id); got != tt.want {
+			t.Errorf("chunkFile(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
@@ -2,195 +2,395 @@ package app
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"html"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
-	"runtime"
 	"strings"
 
-	"github.com/ledongthuc/pdf"
-	"github.com/nguyenthenguyen/docx"
 	"github.com/philippgille/chromem-go"
 )
 
-func (a *App) indexDocuments() error {
-	ctx := context.Background()
+// indexDocuments brings the index up to date with the workspace's
+// directories. When
+// ctx is cancelled the files indexed so far are persisted and the
+// cancellation error is returned.
+func (ws *workspace) indexDocuments(ctx context.Context) (err error) {
+	ws.indexMu.Lock()
+	defer ws.indexMu.Unlock()
+
+	ws.progress.start()
+	defer func() { ws.progress.finish(err) }()
 
 	// Get existing collection or create new one
-	coll := a.db.GetCollection("docs", a.embeddingFunc)
-	if coll == nil {
-		var err error
-		coll, err = a.db.CreateCollection("docs", map[string]string{}, a.embeddingFunc)
-		if err != nil {
-			return fmt.Errorf("failed to create collection: %w", err)
+	coll, err := ws.collection()
+	if err != nil {
+		return err
+	}
+
+	// Probe the model for the dimension of its vectors, uncached so that a
+	// model replaced under the same name is noticed
+	probe, err := ws.embeddingFunc(ctx, "minirag")
+	if err != nil {
+		return fmt.Errorf("failed to embed with %s: %w", ws.embedModelID(), err)
+	}
+	dim := len(probe)
+
+	force := ws.cfg.ForceReindex
+	if !force {
+		if force, err = ws.checkIndexSettings(dim); err != nil {
+			return err
+		}
+		if force {
+			ws.rebuilding.Store(true)
 		}
 	}
 
 	// If force-reindex is set, clear everything
-	if a.cfg.ForceReindex {
-		log.Printf("Force reindexing enabled, clearing existing metadata and collection")
-		a.metadata.Files = make(map[string]FileInfo)
+	if force {
+		log.Printf("Rebuilding index, clearing existing metadata and collection")
+		ws.mu.Lock()
+		ws.metadata.Files = make(map[string]FileInfo)
+		ws.metadata.Failed = make(map[string]FailedFile)
+		ws.mu.Unlock()
+		ws.lexical.Reset()
+		ws.cacheKeys.reset()
 		// Remove and recreate collection
-		a.db.DeleteCollection("docs")
-		coll, _ = a.db.CreateCollection("docs", map[string]string{}, a.embeddingFunc)
+		ws.db.DeleteCollection(ws.name)
+		coll, _ = ws.db.CreateCollection(ws.name, map[string]string{}, ws.embeddingFunc)
 	}
 
-	log.Printf("Current metadata contains %d files", len(a.metadata.Files))
-	log.Printf("Indexing documents in: %s", a.cfg.DocsDir)
+	ws.mu.Lock()
+	log.Printf("Current metadata of workspace %s contains %d files", ws.name, len(ws.metadata.Files))
+	ws.metadata.DataPath = ws.dataPath()
+	ws.metadata.SchemaVersion = metadataSchemaVersion
+	ws.metadata.EmbedModel = ws.embedModelID()
+	ws.metadata.EmbedDim = dim
+	ws.metadata.Chunker = ws.chunkerSig
+	ws.mu.Unlock()
 
-	a.metadata.DataPath = a.cfg.DocsDir
-	// Walk through docs directory
-	err := filepath.Walk(a.cfg.DocsDir, func(path string, info os.FileInfo, err error) error {
-		log.Printf("Walking path: %s", path)
-		if err != nil {
-			return err
+	for _, root := range ws.roots {
+		log.Printf("Indexing documents in: %s", root.dir)
+		if err := ws.syncTree(ctx, coll, root.dir, force); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Indexing aborted, saving progress")
+				if perr := ws.persistIndex(); perr != nil {
+					log.Printf("Failed to save index: %v", perr)
+				}
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to walk %s: %w", root.dir, err)
 		}
+	}
 
-		// Skip directories and non-text files
-		if info.IsDir() || !(isTextFile(path) || isPDFFile(path) || isDocxFile(path) || isDocFile(path)) {
-			log.Printf("Skipping non-text file: %s", path)
-			return nil
-		}
+	// Unused embeddings are dropped only after a full pass, an interrupted
+	// one may have yet to store the chunks that need them
+	ws.cacheKeys.markComplete()
+	ws.embedCache.prune()
 
-		// Check if file needs indexing
-		relPath, _ := filepath.Rel(a.cfg.DocsDir, path)
-		fileInfo, exists := a.metadata.Files[relPath]
-		if !a.cfg.ForceReindex && exists && fileInfo.LastModified.Equal(info.ModTime()) && fileInfo.Size == info.Size() {
-			log.Printf("Skipping unchanged file: %s", relPath)
-			return nil
-		}
-		log.Printf("Indexing file: %s", relPath)
-
-		var content string
-		if isPDFFile(path) {
-			// Extract text from PDF
-			f, rErr := os.Open(path)
-			if rErr != nil {
-				return fmt.Errorf("failed to open PDF file %s: %w", path, rErr)
-			}
-			defer f.Close()
-			pdfReader, rErr := pdf.NewReader(f, info.Size())
-			if rErr != nil {
-				return fmt.Errorf("failed to read PDF file %s: %w", path, rErr)
-			}
-			var sb strings.Builder
-			for i := 1; i <= pdfReader.NumPage(); i++ {
-				page := pdfReader.Page(i)
-				if page.V.IsNull() {
-					continue
-				}
-				text, _ := page.GetPlainText(nil)
-				log.Printf("PDF page %d: %s", i, text)
-				sb.WriteString(text)
-			}
-			content = sb.String()
-		} else if isDocxFile(path) {
-			// Extract text from DOCX
-			doc, err := docx.ReadDocxFile(path)
-			if err != nil {
-				return fmt.Errorf("failed to read DOCX file %s: %w", path, err)
-			}
-			defer doc.Close()
-			docxText := doc.Editable().GetContent()
-			content = cleanDocxText(docxText)
-			log.Printf("DOCX content: %s", content)
-		} else if isDocFile(path) {
-			log.Printf("Skipping legacy .doc file (unsupported): %s", path)
-			return nil
-		} else {
-			// Read and index text file
-			b, rErr := os.ReadFile(path)
-			if rErr != nil {
-				return fmt.Errorf("failed to read file %s: %w", path, rErr)
+	if err := ws.persistIndex(); err != nil {
+		return err
+	}
+	if ws.rebuilding.Swap(false) {
+		log.Printf("Index of workspace %s rebuilt, vector search is available again", ws.name)
+	}
+	return nil
+}
+
+// checkIndexSettings compares the settings the index was built with to the
+// current ones. Vectors of another embedding model or chunks produced with
+// other chunker settings can't be mixed with new ones, so on a mismatch it
+// returns true to rebuild the index, or an error if -auto-reindex is off.
+func (ws *workspace) checkIndexSettings(dim int) (bool, error) {
+	changes, err := ws.indexSettingChanges(dim)
+	if err != nil || len(changes) == 0 {
+		return false, err
+	}
+
+	if !ws.cfg.AutoReindex {
+		return false, ws.settingsMismatchError(changes)
+	}
+	log.Printf("Index settings of workspace %s changed (%s), reindexing all documents", ws.name, strings.Join(changes, ", "))
+	return true, nil
+}
+
+// indexSettingChanges lists the differences between the settings the index
+// was built with and the current ones. A dim of 0 skips the vector
+// dimension, which is only known once the model has been asked.
+func (ws *workspace) indexSettingChanges(dim int) ([]string, error) {
+	ws.mu.RLock()
+	m := *ws.metadata
+	ws.mu.RUnlock()
+	if len(m.Files) == 0 && len(m.Failed) == 0 {
+		return nil, nil
+	}
+
+	if m.SchemaVersion > metadataSchemaVersion {
+		return nil, fmt.Errorf("index of workspace %s was written by a newer version of minirag (format %d, this version supports %d)", ws.name, m.SchemaVersion, metadataSchemaVersion)
+	}
+
+	var changes []string
+	if m.SchemaVersion != metadataSchemaVersion {
+		changes = append(changes, fmt.Sprintf("index format %d -> %d", m.SchemaVersion, metadataSchemaVersion))
+	}
+	if m.EmbedModel != "" && m.EmbedModel != ws.embedModelID() {
+		changes = append(changes, fmt.Sprintf("embedding model %s -> %s", m.EmbedModel, ws.embedModelID()))
+	}
+	if dim != 0 && m.EmbedDim != 0 && m.EmbedDim != dim {
+		changes = append(changes, fmt.Sprintf("embedding dimension %d -> %d", m.EmbedDim, dim))
+	}
+	if m.Chunker != "" && m.Chunker != ws.chunkerSig {
+		changes = append(changes, fmt.Sprintf("chunker %s -> %s", m.Chunker, ws.chunkerSig))
+	}
+	return changes, nil
+}
+
+// Helper to explain why an index can't be used with -auto-reindex off
+func (ws *workspace) settingsMismatchError(changes []string) error {
+	return fmt.Errorf("index of workspace %s does not match the current settings (%s); restart with the previous settings or with -force-reindex to rebuild it", ws.name, strings.Join(changes, ", "))
+}
+
+// Helper to identify the embedding model of the workspace
+func (ws *workspace) embedModelID() string {
+	return embedModelID(ws.embedProvider, ws.embedder.Model())
+}
+
+// Helper to identify an embedding model, including its provider
+func embedModelID(provider, model string) string {
+	return provider + "/" + model
+}
+
+// Helper to list the embedding cache keys of a file's chunks
+func (ws *workspace) chunkCacheKeys(texts []string) []string {
+	model := ws.embedModelID()
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = embeddingCacheKey(model, text)
+	}
+	return keys
+}
+
+// loadCacheKeys records the embedding cache keys of the chunks restored
+// from disk, so that the cache keeps their entries
+func (ws *workspace) loadCacheKeys(ctx context.Context, coll *chromem.Collection) {
+	ws.mu.RLock()
+	files := make(map[string]int, len(ws.metadata.Files))
+	for relPath, fileInfo := range ws.metadata.Files {
+		files[relPath] = fileInfo.Chunks
+	}
+	ws.mu.RUnlock()
+
+	for relPath, count := range files {
+		var texts []string
+		for i := 0; i < count; i++ {
+			if doc, err := coll.GetByID(ctx, chunkID(relPath, i)); err == nil {
+				texts = append(texts, doc.Content)
 			}
-			content = string(b)
 		}
+		ws.cacheKeys.setFile(relPath, ws.chunkCacheKeys(texts))
+	}
+}
 
-		// Split content into chunks
-		chunks := splitIntoChunks(content, 2000) // ~2000 chars per chunk
-		for i, chunk := range chunks {
-			doc := chromem.Document{
-				ID:      fmt.Sprintf("%s#chunk-%d", relPath, i),
-				Content: chunk,
-			}
-			if err := coll.AddDocuments(ctx, []chromem.Document{doc}, runtime.NumCPU()); err != nil {
-				return fmt.Errorf("failed to add document chunk %s: %w", path, err)
+// syncPaths brings the index up to date for the given files or directories
+// only, as reported by the watcher, and persists the result.
+func (ws *workspace) syncPaths(ctx context.Context, paths []string) (err error) {
+	ws.indexMu.Lock()
+	defer ws.indexMu.Unlock()
+
+	ws.progress.start()
+	defer func() { ws.progress.finish(err) }()
+
+	coll, err := ws.collection()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := ws.syncTree(ctx, coll, path, false); err != nil {
+			if perr := ws.persistIndex(); perr != nil {
+				log.Printf("Failed to save index: %v", perr)
 			}
+			return fmt.Errorf("failed to sync %s: %w", path, err)
+		}
+	}
+
+	return ws.persistIndex()
+}
+
+// syncTree indexes new and modified files under root and drops files under
+// root that are in the metadata but no longer on disk. Root may be one of
+// the workspace's directories, a subdirectory or a single file.
+func (ws *workspace) syncTree(ctx context.Context, coll *chromem.Collection, root string, force bool) error {
+	src, ok := ws.rootOf(root)
+	if !ok {
+		return fmt.Errorf("%s is outside of workspace %s", root, ws.name)
+	}
+	rootRel, err := src.rel(root)
+	if err != nil {
+		return err
+	}
+
+	// Track files seen on disk so that removed ones can be dropped afterwards
+	seen := make(map[string]bool)
+
+	if _, err := os.Stat(root); err == nil || root == src.dir {
+		if err := ws.runIndexPipeline(ctx, coll, src, root, force, seen); err != nil {
+			return err
 		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
 
-		// Update metadata (store only for the file, not per chunk)
-		a.metadata.Files[relPath] = FileInfo{
-			Path:         relPath,
-			LastModified: info.ModTime(),
-			Size:         info.Size(),
+	// Drop chunks of files that no longer exist on disk
+	ws.mu.RLock()
+	var removed []string
+	for relPath := range ws.metadata.Files {
+		if !seen[relPath] && isUnderPath(relPath, rootRel) {
+			removed = append(removed, relPath)
 		}
+	}
+	ws.mu.RUnlock()
 
-		log.Printf("Indexed file: %s (%d chunks)", relPath, len(chunks))
-		return nil
-	})
+	ws.mu.Lock()
+	for relPath := range ws.metadata.Failed {
+		if !seen[relPath] && isUnderPath(relPath, rootRel) {
+			delete(ws.metadata.Failed, relPath)
+		}
+	}
+	ws.mu.Unlock()
+
+	for _, relPath := range removed {
+		if err := ws.removeFile(ctx, coll, relPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFile drops a file that disappeared from disk from the collection
+// and the metadata.
+func (ws *workspace) removeFile(ctx context.Context, coll *chromem.Collection, relPath string) error {
+	ws.mu.RLock()
+	fileInfo := ws.metadata.Files[relPath]
+	ws.mu.RUnlock()
 
+	log.Printf("Removing deleted file from index: %s", relPath)
+	if err := ws.deleteFileChunks(ctx, coll, relPath, fileInfo.Chunks); err != nil {
+		return fmt.Errorf("failed to delete chunks of removed file %s: %w", relPath, err)
+	}
+
+	ws.mu.Lock()
+	delete(ws.metadata.Files, relPath)
+	ws.mu.Unlock()
+	ws.progress.removed(relPath)
+	return nil
+}
+
+// collection returns the workspace's collection, creating it if needed.
+func (ws *workspace) collection() (*chromem.Collection, error) {
+	coll, err := ws.db.GetOrCreateCollection(ws.name, map[string]string{}, ws.embeddingFunc)
 	if err != nil {
-		return fmt.Errorf("failed to walk docs directory: %w", err)
+		return nil, fmt.Errorf("failed to create collection: %w", err)
 	}
+	return coll, nil
+}
 
-	// Save metadata and DB
-	if err := a.saveMetadata(); err != nil {
+// persistIndex saves metadata and DB
+func (ws *workspace) persistIndex() error {
+	if err := ws.saveMetadata(); err != nil {
 		return fmt.Errorf("failed to save metadata: %w", err)
 	}
 
-	if err := a.saveDB(); err != nil {
+	if err := ws.saveDB(); err != nil {
 		return fmt.Errorf("failed to save vector database: %w", err)
 	}
 
+	if err := ws.lexical.SaveToFile(ws.lexicalFile); err != nil {
+		return fmt.Errorf("failed to save lexical index: %w", err)
+	}
+
+	if err := ws.embedCache.Save(); err != nil {
+		return fmt.Errorf("failed to save embedding cache: %w", err)
+	}
+
 	return nil
 }
 
-// Add helper for PDF file detection
-func isPDFFile(path string) bool {
-	return strings.ToLower(filepath.Ext(path)) == ".pdf"
+// Helper to compute the SHA-256 of a file's contents
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func isTextFile(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	textExtensions := map[string]bool{
-		".txt": true,
-		".md":  true,
-		".rst": true,
-		".csv": true,
-		".log": true,
+// Helper to check whether relPath is prefix itself or lies below it
+func isUnderPath(relPath, prefix string) bool {
+	if prefix == "." {
+		return true
 	}
-	return textExtensions[ext]
+	return relPath == prefix || strings.HasPrefix(relPath, prefix+string(filepath.Separator))
 }
 
-// Add helpers for DOCX and DOC
-func isDocxFile(path string) bool {
-	return strings.ToLower(filepath.Ext(path)) == ".docx"
+// Helper to build the collection ID of a file chunk
+func chunkID(relPath string, i int) string {
+	return fmt.Sprintf("%s#chunk-%d", relPath, i)
 }
 
-func isDocFile(path string) bool {
-	return strings.ToLower(filepath.Ext(path)) == ".doc"
+// deleteFileChunks removes every chunk of relPath from the collection and
+// the lexical index. IDs past the recorded count are probed as well, so
+// metadata written before chunk counts were tracked still gets cleaned up.
+func (ws *workspace) deleteFileChunks(ctx context.Context, coll *chromem.Collection, relPath string, count int) error {
+	ids := fileChunkIDs(ctx, coll, relPath, count)
+	if len(ids) == 0 {
+		return nil
+	}
+	ws.lexical.Delete(ids...)
+	ws.cacheKeys.removeFile(relPath)
+	return coll.Delete(ctx, nil, nil, ids...)
 }
 
-// Helper to split text into chunks of maxChars length
-func splitIntoChunks(text string, maxChars int) []string {
-	var chunks []string
-	for start := 0; start < len(text); start += maxChars {
-		end := start + maxChars
-		if end > len(text) {
-			end = len(text)
+// Helper to list the IDs of all chunks of relPath that are in the collection
+func fileChunkIDs(ctx context.Context, coll *chromem.Collection, relPath string, count int) []string {
+	var ids []string
+	for i := 0; i < count; i++ {
+		ids = append(ids, chunkID(relPath, i))
+	}
+	for i := count; ; i++ {
+		if _, err := coll.GetByID(ctx, chunkID(relPath, i)); err != nil {
+			break
 		}
-		chunks = append(chunks, text[start:end])
+		ids = append(ids, chunkID(relPath, i))
 	}
-	return chunks
+	return ids
 }
 
-// Helper to clean DOCX text: remove tags and decode entities
-func cleanDocxText(s string) string {
-	re := regexp.MustCompile(`<[^>]+>`)
-	noTags := re.ReplaceAllString(s, " ")
-	decoded := html.UnescapeString(noTags)
-	return strings.Join(strings.Fields(decoded), " ")
+// rebuildLexicalIndex fills the lexical index from the chunks already in the
+// collection, for databases created before it existed
+func (ws *workspace) rebuildLexicalIndex(ctx context.Context, coll *chromem.Collection) {
+	ws.mu.RLock()
+	files := make(map[string]int, len(ws.metadata.Files))
+	for relPath, fileInfo := range ws.metadata.Files {
+		files[relPath] = fileInfo.Chunks
+	}
+	ws.mu.RUnlock()
+
+	for relPath, count := range files {
+		for _, id := range fileChunkIDs(ctx, coll, relPath, count) {
+			if doc, err := coll.GetByID(ctx, id); err == nil {
+				ws.lexical.Add(doc.ID, doc.Content)
+			}
+		}
+	}
+	log.Printf("Rebuilt lexical index with %d chunks", ws.lexical.Count())
 }
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"minirag/internal/config"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// Helper to build a text of n paragraphs, each filling most of a chunk
+func testParagraphs(n int) string {
+	paras := make([]string, n)
+	for i := range paras {
+		paras[i] = strings.Repeat(string(rune('a'+i))+"word ", 300)
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// checkIndexConsistency fails the test unless the collection and the
+// lexical index hold exactly the chunks recorded in the metadata
+func checkIndexConsistency(t *testing.T, ws *workspace) {
+	t.Helper()
+	ctx := context.Background()
+	coll := ws.db.GetCollection(ws.name, ws.embeddingFunc)
+	if coll == nil {
+		t.Fatal("collection missing")
+	}
+
+	total := 0
+	for relPath, fileInfo := range ws.metadata.Files {
+		total += fileInfo.Chunks
+		for i := 0; i < fileInfo.Chunks; i++ {
+			id := chunkID(relPath, i)
+			if _, err := coll.GetByID(ctx, id); err != nil {
+				t.Errorf("chunk %s missing from the collection", id)
+			}
+			if _, ok := ws.lexical.docs[id]; !ok {
+				t.Errorf("chunk %s missing from the lexical index", id)
+			}
+		}
+		if _, err := coll.GetByID(ctx, chunkID(relPath, fileInfo.Chunks)); err == nil {
+			t.Errorf("stale chunk %s left in the collection", chunkID(relPath, fileInfo.Chunks))
+		}
+	}
+	if coll.Count() != total {
+		t.Errorf("collection has %d chunks, metadata records %d", coll.Count(), total)
+	}
+	if ws.lexical.Count() != total {
+		t.Errorf("lexical index has %d chunks, metadata records %d", ws.lexical.Count(), total)
+	}
+}
+
+// Helper to create a workspace indexing dir with the fake embedder
+func newIndexedWorkspace(t *testing.T, cfg *config.Config, db *chromem.DB, dir string, fake *fakeEmbedder) *workspace {
+	t.Helper()
+	ws := newTestWorkspace(t, cfg, db, defaultWorkspaceName, dir)
+	setTestEmbedder(ws, fake)
+	if err := ws.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.indexDocuments(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func TestIndexDocuments(t *testing.T) {
+	cfg := testConfig(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"keep.txt":        "Kept as it is.",
+		"long.txt":        testParagraphs(3),
+		"gone.txt":        "Deleted soon.",
+		"sub/touched.txt": "Touched but unchanged.",
+	})
+	fake := &fakeEmbedder{}
+	ws := newIndexedWorkspace(t, cfg, chromem.NewDB(), dir, fake)
+	if n := ws.metadata.Files["long.txt"].Chunks; n < 3 {
+		t.Fatalf("long.txt has %d chunks, want at least 3", n)
+	}
+	checkIndexConsistency(t, ws)
+	fake.embedded()
+
+	// A deleted file, a shrunk file and a file with only a new mtime
+	if err := os.Remove(filepath.Join(dir, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, dir, map[string]string{"long.txt": "Short now."})
+	touched := filepath.Join(dir, "sub", "touched.txt")
+	mtime := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(touched, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.indexDocuments(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fake.embedded(); strings.Join(got, ",") != "minirag,Short now." {
+		t.Errorf("embedded %q, want the probe and the shrunk file", got)
+	}
+	if _, ok := ws.metadata.Files["gone.txt"]; ok {
+		t.Error("deleted file still in the metadata")
+	}
+	if n := ws.metadata.Files["long.txt"].Chunks; n != 1 {
+		t.Errorf("shrunk file has %d chunks, want 1", n)
+	}
+	if fi := ws.metadata.Files[filepath.Join("sub", "touched.txt")]; !fi.LastModified.Equal(mtime) {
+		t.Errorf("touched file recorded with mtime %v, want %v", fi.LastModified, mtime)
+	}
+	checkIndexConsistency(t, ws)
+	if hits := ws.lexical.Search("deleted", 10); len(hits) != 0 {
+		t.Errorf("lexical search found %v in a deleted file", hits)
+	}
+
+	// Everything is restored after a restart, without embedding again
+	restarted := newIndexedWorkspace(t, cfg, chromem.NewDB(), dir, fake)
+	if got := fake.embedded(); strings.Join(got, ",") != "minirag" {
+		t.Errorf("restart embedded %q, want only the probe", got)
+	}
+	if len(restarted.metadata.Files) != 3 {
+		t.Errorf("restored %d files, want 3", len(restarted.metadata.Files))
+	}
+	checkIndexConsistency(t, restarted)
+
+	// A missing lexical index is rebuilt from the collection
+	if err := os.Remove(cfg.LexicalFile); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt := newTestWorkspace(t, cfg, chromem.NewDB(), defaultWorkspaceName, dir)
+	setTestEmbedder(rebuilt, fake)
+	if err := rebuilt.load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexConsistency(t, rebuilt)
+}
+
+func TestDeleteFileChunks(t *testing.T) {
+	cfg := testConfig(t)
+	ctx := context.Background()
+	ws := newTestWorkspace(t, cfg, chromem.NewDB(), defaultWorkspaceName)
+	setTestEmbedder(ws, &fakeEmbedder{})
+	coll, err := ws.collection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{chunkID("a.txt", 0), chunkID("a.txt", 1), chunkID("a.txt", 2), chunkID("b.txt", 0)} {
+		doc := chromem.Document{ID: id, Content: "text of " + id, Embedding: []float32{1, 0}}
+		if err := coll.AddDocument(ctx, doc); err != nil {
+			t.Fatal(err)
+		}
+		ws.lexical.Add(id, doc.Content)
+	}
+
+	// Chunks past the recorded count go as well
+	if err := ws.deleteFileChunks(ctx, coll, "a.txt", 1); err != nil {
+		t.Fatal(err)
+	}
+	if coll.Count() != 1 || ws.lexical.Count() != 1 {
+		t.Errorf("%d chunks in the collection and %d in the lexical index, want 1", coll.Count(), ws.lexical.Count())
+	}
+	if _, err := coll.GetByID(ctx, chunkID("b.txt", 0)); err != nil {
+		t.Error("chunk of another file deleted")
+	}
+}
@@ -0,0 +1,309 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// openAIChatRequest is the subset of the OpenAI chat completions request
+// minirag understands. Workspace, Mode and Filter are extensions selecting
+// the workspace, the retrieval mode and the documents to search.
+type openAIChatRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Mode        string    `json:"mode,omitempty"`
+
+	Workspace string           `json:"workspace,omitempty"`
+	Filter    *RetrievalFilter `json:"filter,omitempty"`
+}
+
+// UnmarshalJSON accepts the content of a message as a string or as an
+// array of content parts, which newer OpenAI clients send. Text parts are
+// joined with newlines, other parts such as images are rejected.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var msg struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	m.Role = msg.Role
+	m.Content = ""
+
+	content := bytes.TrimSpace(msg.Content)
+	if len(content) == 0 || bytes.Equal(content, []byte("null")) {
+		return nil
+	}
+	if content[0] != '[' {
+		return json.Unmarshal(content, &m.Content)
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return err
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			return fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	m.Content = strings.Join(texts, "\n")
+	return nil
+}
+
+type openAIChoice struct {
+	Index        int          `json:"index"`
+	Message      *Message     `json:"message,omitempty"`
+	Delta        *openAIDelta `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type openAIDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// openAIChatResponse is both the non-streaming response and a streamed
+// chunk. Sources and IndexingInProgress are extensions describing the
+// retrieval; in streams they are sent with the final chunk.
+type openAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+	Sources []Document     `json:"sources,omitempty"`
+
+	IndexingInProgress bool `json:"indexing_in_progress,omitempty"`
+}
+
+// handleOpenAIChatCompletions implements POST /v1/chat/completions. The last
+// user message is answered with retrieved context injected, earlier
+// messages are passed through as history.
+func (a *App) handleOpenAIChatCompletions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req openAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Only the model listed on /v1/models is served, an empty name
+	// selects it as well
+	if req.Model != "" && req.Model != a.llm.Model() {
+		writeOpenAIErrorCode(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("The model '%s' does not exist", req.Model))
+		return
+	}
+
+	n := len(req.Messages)
+	if n == 0 || req.Messages[n-1].Role != "user" {
+		writeOpenAIError(w, http.StatusBadRequest, "The last message must have role 'user'")
+		return
+	}
+
+	ws, err := a.workspaceFor(req.Workspace)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mode, err := a.retrievalMode(req.Mode)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := ws.checkRetrievalMode(mode); err != nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	filter, err := compileFilter(req.Filter)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	temperature := 0.7
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+
+	query := req.Messages[n-1].Content
+	rag := a.prepareRAG(ctx, ws, query, req.Messages[:n-1], mode, filter)
+
+	stream, err := a.llm.StreamChat(ctx, rag.Messages, ChatOptions{Temperature: temperature, MaxTokens: req.MaxTokens})
+	if err != nil {
+		log.Printf("Failed to call chat model: %v", err)
+		writeOpenAIError(w, http.StatusBadGateway, "Failed to call chat model")
+		return
+	}
+	defer stream.Close()
+
+	resp := openAIChatResponse{
+		ID:      "chatcmpl-" + newConversationID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   a.llm.Model(),
+	}
+	stop := "stop"
+
+	if !req.Stream {
+		var answer strings.Builder
+		for {
+			piece, ok := stream.Next()
+			if !ok {
+				break
+			}
+			answer.WriteString(piece)
+		}
+		if err := stream.Err(); err != nil {
+			log.Printf("Chat model stream failed: %v", err)
+			writeOpenAIError(w, http.StatusBadGateway, "The chat model stopped before the answer was complete")
+			return
+		}
+
+		promptTokens := 0
+		for _, msg := range rag.Messages {
+			promptTokens += estimateTokens(msg.Content)
+		}
+		completionTokens := estimateTokens(answer.String())
+
+		resp.Choices = []openAIChoice{{
+			Message:      &Message{Role: "assistant", Content: answer.String()},
+			FinishReason: &stop,
+		}}
+		resp.Usage = &openAIUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
+		resp.Sources = rag.Sources
+		resp.IndexingInProgress = rag.IndexingInProgress
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	resp.Object = "chat.completion.chunk"
+	first := true
+	for {
+		piece, ok := stream.Next()
+		if !ok {
+			break
+		}
+		delta := &openAIDelta{Content: piece}
+		if first {
+			delta.Role = "assistant"
+			first = false
+		}
+		resp.Choices = []openAIChoice{{Delta: delta}}
+		fmt.Fprintf(w, "data: %s\n\n", encodeJSON(resp))
+		flusher.Flush()
+	}
+
+	// The status is already sent, so a failure is reported in the error
+	// format OpenAI uses for streams, without a finish reason
+	if err := stream.Err(); err != nil {
+		log.Printf("Chat model stream failed: %v", err)
+		fmt.Fprintf(w, "data: %s\n\n", encodeJSON(map[string]interface{}{
+			"error": map[string]string{
+				"message": "The chat model stopped before the answer was complete",
+				"type":    "server_error",
+			},
+		}))
+		flusher.Flush()
+		return
+	}
+
+	// Final chunk carries the finish reason and the sources
+	resp.Choices = []openAIChoice{{Delta: &openAIDelta{}, FinishReason: &stop}}
+	resp.Sources = rag.Sources
+	resp.IndexingInProgress = rag.IndexingInProgress
+	fmt.Fprintf(w, "data: %s\n\n", encodeJSON(resp))
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// handleOpenAIModels implements GET /v1/models, listing the chat model
+func (a *App) handleOpenAIModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object": "list",
+		"data": []model{{
+			ID:      a.llm.Model(),
+			Object:  "model",
+			OwnedBy: "minirag",
+		}},
+	})
+}
+
+// Helper to write an error in the OpenAI error format
+func writeOpenAIError(w http.ResponseWriter, status int, message string) {
+	writeOpenAIErrorCode(w, status, "", message)
+}
+
+// Helper to write an OpenAI error with a machine-readable code such as
+// "model_not_found"
+func writeOpenAIErrorCode(w http.ResponseWriter, status int, code, message string) {
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	body := map[string]interface{}{
+		"message": message,
+		"type":    errType,
+	}
+	if code != "" {
+		body["code"] = code
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": body})
+}
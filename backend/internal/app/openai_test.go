@@ -0,0 +1,293 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestApp creates an app answering with a fake chat model from the
+// given files, indexed with the fake embedder
+func newTestApp(t *testing.T, files map[string]string) (*App, *fakeChatProvider) {
+	t.Helper()
+	cfg := testConfig(t)
+	if err := os.MkdirAll(cfg.DocsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, cfg.DocsDir, files)
+	app, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm := &fakeChatProvider{}
+	app.llm = llm
+	ctx := context.Background()
+	for _, ws := range app.workspaces {
+		setTestEmbedder(ws, &fakeEmbedder{})
+		if err := ws.load(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := ws.indexDocuments(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return app, llm
+}
+
+// Helper to split a Server-Sent Events body into the data of its events,
+// failing on anything that isn't a data line followed by a blank line
+func sseData(t *testing.T, body string) []string {
+	t.Helper()
+	if !strings.HasSuffix(body, "\n\n") {
+		t.Fatalf("event stream %q doesn't end with a blank line", body)
+	}
+	var events []string
+	for _, event := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		data, ok := strings.CutPrefix(event, "data: ")
+		if !ok || strings.Contains(data, "\n") {
+			t.Fatalf("malformed event %q", event)
+		}
+		events = append(events, data)
+	}
+	return events
+}
+
+// Helper to send a request to a handler
+func serveTest(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+var testDocs = map[string]string{
+	"animals.txt": "The zebra lives in the savanna of Africa.",
+	"plants.txt":  "Cacti store water in their stems.",
+}
+
+func TestMessageUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    Message
+		wantErr bool
+	}{
+		{"string", `{"role":"user","content":"Hi"}`, Message{Role: "user", Content: "Hi"}, false},
+		{"text parts", `{"role":"user","content":[{"type":"text","text":"Hello"},{"type":"text","text":"there"}]}`,
+			Message{Role: "user", Content: "Hello\nthere"}, false},
+		{"no parts", `{"role":"user","content":[]}`, Message{Role: "user"}, false},
+		{"null", `{"role":"assistant","content":null}`, Message{Role: "assistant"}, false},
+		{"missing", `{"role":"assistant"}`, Message{Role: "assistant"}, false},
+		{"image part", `{"role":"user","content":[{"type":"image_url","image_url":{"url":"x"}}]}`, Message{}, true},
+		{"number", `{"role":"user","content":3}`, Message{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Message
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Messages are still written with a string content
+	if b, _ := json.Marshal(Message{Role: "user", Content: "Hi"}); string(b) != `{"role":"user","content":"Hi"}` {
+		t.Errorf("Marshal() = %s", b)
+	}
+}
+
+func TestOpenAIChatCompletions(t *testing.T) {
+	app, llm := newTestApp(t, testDocs)
+	llm.reply = replyWith("The zebra ", "lives in Africa.")
+	body := `{"model":"fake-chat","messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":[{"type":"text","text":"Where does the zebra live?"}]}]}`
+
+	rec := serveTest(app.handleOpenAIChatCompletions, http.MethodPost, "/v1/chat/completions", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp openAIChatResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Object != "chat.completion" || resp.Model != "fake-chat" || !strings.HasPrefix(resp.ID, "chatcmpl-") {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "The zebra lives in Africa." || *resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("choices = %+v", resp.Choices)
+	}
+	if u := resp.Usage; u == nil || u.CompletionTokens == 0 || u.TotalTokens != u.PromptTokens+u.CompletionTokens {
+		t.Errorf("usage = %+v", u)
+	}
+	if len(resp.Sources) == 0 || resp.Sources[0].Path != "animals.txt" {
+		t.Errorf("sources = %+v, want animals.txt first", resp.Sources)
+	}
+
+	// The history is passed through, the question comes with the context,
+	// and the temperature defaults to OpenAI's
+	if opts := llm.options[len(llm.options)-1]; opts.Temperature != 0.7 {
+		t.Errorf("temperature = %v, want the default 0.7", opts.Temperature)
+	}
+	sent := llm.sent()
+	last := sent[len(sent)-1]
+	if len(last) != 2 || last[0] != (Message{Role: "system", Content: "Be brief."}) {
+		t.Fatalf("sent %+v", last)
+	}
+	if !strings.Contains(last[1].Content, "Where does the zebra live?") || !strings.Contains(last[1].Content, testDocs["animals.txt"]) {
+		t.Errorf("prompt = %q, want the question and the retrieved chunk", last[1].Content)
+	}
+}
+
+func TestOpenAIChatCompletionsStream(t *testing.T) {
+	app, llm := newTestApp(t, testDocs)
+	llm.reply = replyWith("The zebra ", "lives in Africa.")
+	body := `{"messages":[{"role":"user","content":"Where does the zebra live?"}],"stream":true,"temperature":0}`
+
+	rec := serveTest(app.handleOpenAIChatCompletions, http.MethodPost, "/v1/chat/completions", body)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if opts := llm.options[len(llm.options)-1]; opts.Temperature != 0 {
+		t.Errorf("temperature = %v, want the requested 0", opts.Temperature)
+	}
+
+	events := sseData(t, rec.Body.String())
+	if len(events) != 4 || events[3] != "[DONE]" {
+		t.Fatalf("events = %q, want two pieces, the final chunk and [DONE]", events)
+	}
+	var chunks []openAIChatResponse
+	for _, data := range events[:3] {
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Object != "chat.completion.chunk" || len(chunk.Choices) != 1 {
+			t.Fatalf("chunk = %s", data)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if d := chunks[0].Choices[0].Delta; d.Role != "assistant" || d.Content != "The zebra " {
+		t.Errorf("first delta = %+v", d)
+	}
+	if d := chunks[1].Choices[0].Delta; d.Role != "" || d.Content != "lives in Africa." {
+		t.Errorf("second delta = %+v", d)
+	}
+	for _, chunk := range chunks[:2] {
+		if chunk.Choices[0].FinishReason != nil || chunk.Sources != nil {
+			t.Errorf("piece chunk carries a finish reason or sources: %+v", chunk)
+		}
+	}
+	final := chunks[2]
+	if final.Choices[0].FinishReason == nil || *final.Choices[0].FinishReason != "stop" || len(final.Sources) == 0 {
+		t.Errorf("final chunk = %+v, want the finish reason and the sources", final)
+	}
+	if final.ID != chunks[0].ID {
+		t.Errorf("chunk IDs %s and %s differ", chunks[0].ID, final.ID)
+	}
+}
+
+func TestOpenAIChatCompletionsStreamError(t *testing.T) {
+	app, llm := newTestApp(t, testDocs)
+	llm.reply = func([]Message) ([]string, error) {
+		return []string{"The zebra "}, errors.New("connection reset")
+	}
+	body := `{"messages":[{"role":"user","content":"Where does the zebra live?"}],"stream":true}`
+
+	rec := serveTest(app.handleOpenAIChatCompletions, http.MethodPost, "/v1/chat/completions", body)
+	events := sseData(t, rec.Body.String())
+	if len(events) != 2 {
+		t.Fatalf("events = %q, want a piece and the error", events)
+	}
+	var errEvent struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(events[1]), &errEvent); err != nil || errEvent.Error.Type != "server_error" || errEvent.Error.Message == "" {
+		t.Errorf("error event = %s", events[1])
+	}
+}
+
+func TestOpenAIChatCompletionsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		status   int
+		wantCode string
+	}{
+		{"method", http.MethodGet, "", http.StatusMethodNotAllowed, ""},
+		{"invalid JSON", http.MethodPost, `{"messages":`, http.StatusBadRequest, ""},
+		{"image content", http.MethodPost, `{"messages":[{"role":"user","content":[{"type":"image_url"}]}]}`, http.StatusBadRequest, ""},
+		{"unknown model", http.MethodPost, `{"model":"gpt-4","messages":[{"role":"user","content":"Hi"}]}`, http.StatusNotFound, "model_not_found"},
+		{"no messages", http.MethodPost, `{"messages":[]}`, http.StatusBadRequest, ""},
+		{"last message not from the user", http.MethodPost, `{"messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]}`, http.StatusBadRequest, ""},
+		{"unknown workspace", http.MethodPost, `{"workspace":"nope","messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, ""},
+		{"unknown mode", http.MethodPost, `{"mode":"magic","messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest, ""},
+	}
+	app, llm := newTestApp(t, testDocs)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveTest(app.handleOpenAIChatCompletions, tt.method, "/v1/chat/completions", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var resp struct {
+				Error struct {
+					Message string `json:"message"`
+					Type    string `json:"type"`
+					Code    string `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Error.Message == "" || resp.Error.Type != "invalid_request_error" {
+				t.Errorf("error body = %+v, %v", resp, err)
+			}
+			if resp.Error.Code != tt.wantCode {
+				t.Errorf("error code = %q, want %q", resp.Error.Code, tt.wantCode)
+			}
+		})
+	}
+	if sent := llm.sent(); len(sent) != 0 {
+		t.Errorf("invalid requests reached the model: %+v", sent)
+	}
+
+	// A model that can't be reached is a bad gateway
+	llm.start = errors.New("refused")
+	rec := serveTest(app.handleOpenAIChatCompletions, http.MethodPost, "/v1/chat/completions", `{"messages":[{"role":"user","content":"Hi"}]}`)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestOpenAIModels(t *testing.T) {
+	app, _ := newTestApp(t, nil)
+	rec := serveTest(app.handleOpenAIModels, http.MethodGet, "/v1/models", "")
+	var resp struct {
+		Object string `json:"object"`
+		Data   []struct {
+			ID      string `json:"id"`
+			Object  string `json:"object"`
+			OwnedBy string `json:"owned_by"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Object != "list" || len(resp.Data) != 1 || resp.Data[0].ID != "fake-chat" || resp.Data[0].Object != "model" {
+		t.Errorf("models = %+v", resp)
+	}
+
+	if rec := serveTest(app.handleOpenAIModels, http.MethodPost, "/v1/models", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,409 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// indexJob is a file travelling through the indexing pipeline. Each stage
+// fills in its part.
+type indexJob struct {
+	path    string
+	relPath string
+	info    os.FileInfo
+	prev    FileInfo // metadata from the previous run
+	exists  bool     // whether prev is set
+	failed  FailedFile
+	retry   bool // whether failed is set
+	// Version of the extractor for the file's type, a file extracted by
+	// another version is indexed again even if it didn't change
+	extractor int
+
+	hash       string
+	unchanged  bool // same content as before, only the metadata is updated
+	chunks     []Chunk
+	chunkMeta  []map[string]string
+	embeddings [][]float32
+	err        error // extraction failure, recorded instead of stored
+}
+
+// runIndexPipeline indexes new and modified files under walkRoot, which
+// lies in the source directory root, in stages:
+//
+//	discover → extract + chunk → embed → store
+//
+// Extraction and embedding run in bounded worker pools connected by small
+// buffered channels, so a slow stage holds back the ones before it. Storing
+// is done by a single goroutine. Files that can't be extracted are recorded
+// in the metadata and skipped; any other error or the cancellation of ctx
+// stops the pipeline, and files stored by then are kept. Every supported
+// file found on disk is recorded in seen.
+func (ws *workspace) runIndexPipeline(ctx context.Context, coll *chromem.Collection, root docRoot, walkRoot string, force bool, seen map[string]bool) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	extractWorkers := ws.cfg.IndexWorkers
+	if extractWorkers <= 0 {
+		extractWorkers = runtime.NumCPU()
+	}
+	embedWorkers := ws.cfg.EmbedWorkers
+	if embedWorkers <= 0 {
+		embedWorkers = 1
+	}
+
+	var discovered, done atomic.Int64
+	// Stage errors abort the run, but are reported for the file that
+	// caused them
+	fail := func(job *indexJob, err error) error {
+		if ctx.Err() == nil {
+			ws.progress.failed(job.relPath, err)
+		}
+		return err
+	}
+	discoveredCh := make(chan *indexJob, extractWorkers)
+	chunkedCh := make(chan *indexJob, embedWorkers)
+	embeddedCh := make(chan *indexJob, embedWorkers)
+
+	// Discover files that need indexing
+	go func() {
+		defer close(discoveredCh)
+		err := filepath.Walk(walkRoot, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				// Unreadable entries are skipped, only a missing root
+				// aborts the walk
+				if path == walkRoot {
+					return err
+				}
+				log.Printf("Skipping %s: %v", path, err)
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Skip directories and non-text files
+			if info.IsDir() || !isSupportedFile(path) {
+				return nil
+			}
+
+			relPath, _ := root.rel(path)
+			seen[relPath] = true
+
+			// Check if file needs indexing. Matching mtime and size are
+			// trusted, otherwise the content hash decides later on.
+			ws.mu.RLock()
+			prev, exists := ws.metadata.Files[relPath]
+			failed, hasFailed := ws.metadata.Failed[relPath]
+			ws.mu.RUnlock()
+			extractor := extractorVersion(path)
+			if !force && exists && prev.Extractor == extractor && prev.LastModified.Equal(info.ModTime()) && prev.Size == info.Size() {
+				return nil
+			}
+			// Files that failed before are retried only once they change
+			if !force && hasFailed && failed.Extractor == extractor && failed.LastModified.Equal(info.ModTime()) && failed.Size == info.Size() {
+				return nil
+			}
+
+			discovered.Add(1)
+			ws.progress.discovered()
+			job := &indexJob{path: path, relPath: relPath, info: info, prev: prev, exists: exists, failed: failed, retry: hasFailed, extractor: extractor}
+			select {
+			case discoveredCh <- job:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			cancel(err)
+		}
+	}()
+
+	// Extract text and split it into chunks
+	runStage(ctx, cancel, extractWorkers, discoveredCh, chunkedCh, func(ctx context.Context, job *indexJob) (bool, error) {
+		hash, err := fileHash(job.path)
+		if err != nil {
+			job.err = err
+			return true, nil
+		}
+		job.hash = hash
+
+		// Files touched by git checkout, rsync or a copy keep their chunks
+		if !force && ((job.exists && job.prev.Hash == hash && job.prev.Extractor == job.extractor) ||
+			(job.retry && job.failed.Hash == hash && job.failed.Extractor == job.extractor)) {
+			job.unchanged = true
+			return true, nil
+		}
+
+		log.Printf("Indexing file: %s", job.relPath)
+		content, ok, err := extractContentSafe(job.path, job.info)
+		if err != nil {
+			job.err = err
+			return true, nil
+		}
+		if !ok {
+			return false, nil
+		}
+		job.chunks = ws.chunker.Chunk(content.Text)
+		job.chunkMeta = make([]map[string]string, len(job.chunks))
+		for i, chunk := range job.chunks {
+			job.chunkMeta[i] = chunkMetadata(job, content, chunk)
+		}
+		return true, nil
+	})
+
+	// Embed the chunks in batches
+	runStage(ctx, cancel, embedWorkers, chunkedCh, embeddedCh, func(ctx context.Context, job *indexJob) (bool, error) {
+		if job.err != nil || job.unchanged {
+			return true, nil
+		}
+		texts := make([]string, len(job.chunks))
+		for i, chunk := range job.chunks {
+			texts[i] = chunk.Text
+		}
+		embeddings, err := ws.embedder.EmbedBatch(ctx, texts)
+		if err != nil {
+			return false, fail(job, fmt.Errorf("failed to embed chunks of %s: %w", job.path, err))
+		}
+		job.embeddings = embeddings
+		return true, nil
+	})
+
+	// Store chunks and metadata. A file being stored is finished even if
+	// the run is cancelled meanwhile, chromem skips writes on a cancelled
+	// context without an error and the metadata would list missing chunks.
+	storeCtx := context.WithoutCancel(ctx)
+	for job := range embeddedCh {
+		if ctx.Err() != nil {
+			continue // drain
+		}
+		if job.unchanged {
+			ws.touchFile(job)
+			ws.progress.unchanged(job.relPath)
+			done.Add(1)
+			continue
+		}
+		if job.err != nil {
+			log.Printf("Failed to index %s, skipping: %v", job.relPath, job.err)
+			if err := ws.recordFailure(storeCtx, coll, job); err != nil {
+				cancel(err)
+				continue
+			}
+			ws.progress.failed(job.relPath, job.err)
+			continue
+		}
+		if err := ws.storeFile(storeCtx, coll, job); err != nil {
+			cancel(fail(job, err))
+			continue
+		}
+		ws.progress.indexed(job.relPath, len(job.chunks))
+		log.Printf("Indexed file: %s (%d chunks), %d of %d files done", job.relPath, len(job.chunks), done.Add(1), discovered.Load())
+	}
+
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+// runStage starts n workers applying fn to the jobs from in and passing the
+// ones fn keeps on to out, which is closed when all workers are done. After
+// cancellation the workers only drain in so that upstream can finish.
+func runStage(ctx context.Context, cancel context.CancelCauseFunc, n int, in <-chan *indexJob, out chan<- *indexJob, fn func(context.Context, *indexJob) (bool, error)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range in {
+				if ctx.Err() != nil {
+					continue
+				}
+				keep, err := fn(ctx, job)
+				if err != nil {
+					cancel(err)
+					continue
+				}
+				if !keep {
+					continue
+				}
+				select {
+				case out <- job:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+}
+
+// storeFile replaces the chunks of a file in the collection and the lexical
+// index and updates its metadata
+func (ws *workspace) storeFile(ctx context.Context, coll *chromem.Collection, job *indexJob) error {
+	// Replace all chunks of a modified file instead of overlaying them,
+	// otherwise a file that shrank keeps its old tail chunks
+	if job.exists {
+		if err := ws.deleteFileChunks(ctx, coll, job.relPath, job.prev.Chunks); err != nil {
+			return fmt.Errorf("failed to delete old chunks of %s: %w", job.relPath, err)
+		}
+	}
+
+	docs := make([]chromem.Document, len(job.chunks))
+	for i, chunk := range job.chunks {
+		docs[i] = chromem.Document{
+			ID:        chunkID(job.relPath, i),
+			Metadata:  job.chunkMeta[i],
+			Content:   chunk.Text,
+			Embedding: job.embeddings[i],
+		}
+	}
+	if len(docs) > 0 {
+		if err := coll.AddDocuments(ctx, docs, runtime.NumCPU()); err != nil {
+			return fmt.Errorf("failed to add document chunks %s: %w", job.path, err)
+		}
+	}
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		ws.lexical.Add(doc.ID, doc.Content)
+		texts[i] = doc.Content
+	}
+	ws.cacheKeys.setFile(job.relPath, ws.chunkCacheKeys(texts))
+
+	// Update metadata (store only for the file, not per chunk)
+	ws.mu.Lock()
+	delete(ws.metadata.Failed, job.relPath)
+	ws.metadata.Files[job.relPath] = FileInfo{
+		Path:         job.relPath,
+		LastModified: job.info.ModTime(),
+		Size:         job.info.Size(),
+		Chunks:       len(job.chunks),
+		Hash:         job.hash,
+		Extractor:    job.extractor,
+	}
+	ws.mu.Unlock()
+	return nil
+}
+
+// Keys of the chunk metadata stored in the collection
+const (
+	metaPath      = "path"
+	metaFileType  = "file_type"
+	metaPage      = "page"
+	metaSlide     = "slide"
+	metaSheet     = "sheet"
+	metaHeading   = "heading"
+	metaTitle     = "title"
+	metaAuthor    = "author"
+	metaCreated   = "created"
+	metaUpdated   = "updated"
+	metaCharStart = "char_start"
+	metaCharEnd   = "char_end"
+	metaModified  = "modified"
+)
+
+// Separator of the titles in the heading trail of a chunk
+const headingSeparator = " > "
+
+// Helper to describe where a chunk comes from, stored with it in the
+// collection so that citations can point to the exact location
+func chunkMetadata(job *indexJob, doc *extractedDoc, chunk Chunk) map[string]string {
+	meta := map[string]string{
+		metaPath:      filepath.ToSlash(job.relPath),
+		metaFileType:  fileType(job.path),
+		metaCharStart: strconv.Itoa(chunk.Start),
+		metaCharEnd:   strconv.Itoa(chunk.End),
+		metaModified:  job.info.ModTime().UTC().Format(time.RFC3339),
+	}
+	if page := numberAt(doc.Pages, chunk.Start); page > 0 {
+		meta[metaPage] = strconv.Itoa(page)
+	}
+	if slide := numberAt(doc.Slides, chunk.Start); slide > 0 {
+		meta[metaSlide] = strconv.Itoa(slide)
+	}
+	if sheet := numberAt(doc.Sheets, chunk.Start); sheet > 0 {
+		meta[metaSheet] = strconv.Itoa(sheet)
+	}
+	if trail := doc.headingTrail(chunk.Start); len(trail) > 0 {
+		meta[metaHeading] = strings.Join(trail, headingSeparator)
+	}
+	if doc.Title != "" {
+		meta[metaTitle] = doc.Title
+	}
+	if doc.Author != "" {
+		meta[metaAuthor] = doc.Author
+	}
+	if !doc.Created.IsZero() {
+		meta[metaCreated] = doc.Created.UTC().Format(time.RFC3339)
+	}
+	if !doc.Updated.IsZero() {
+		meta[metaUpdated] = doc.Updated.UTC().Format(time.RFC3339)
+	}
+	return meta
+}
+
+// recordFailure drops the stale chunks of a file that could not be
+// extracted and records the failure in the metadata
+func (ws *workspace) recordFailure(ctx context.Context, coll *chromem.Collection, job *indexJob) error {
+	if job.exists {
+		if err := ws.deleteFileChunks(ctx, coll, job.relPath, job.prev.Chunks); err != nil {
+			return fmt.Errorf("failed to delete old chunks of %s: %w", job.relPath, err)
+		}
+	}
+
+	ws.mu.Lock()
+	delete(ws.metadata.Files, job.relPath)
+	ws.metadata.Failed[job.relPath] = FailedFile{
+		Path:         job.relPath,
+		Error:        job.err.Error(),
+		FailedAt:     time.Now(),
+		LastModified: job.info.ModTime(),
+		Size:         job.info.Size(),
+		Hash:         job.hash,
+		Extractor:    job.extractor,
+	}
+	ws.mu.Unlock()
+	return nil
+}
+
+// touchFile records the new mtime and size of a file whose content did not
+// change, so that the next run can skip it without hashing
+func (ws *workspace) touchFile(job *indexJob) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if job.exists {
+		fi := job.prev
+		fi.LastModified = job.info.ModTime()
+		fi.Size = job.info.Size()
+		ws.metadata.Files[job.relPath] = fi
+	} else {
+		f := job.failed
+		f.LastModified = job.info.ModTime()
+		f.Size = job.info.Size()
+		ws.metadata.Failed[job.relPath] = f
+	}
+}
+
+// Helper to extract a file, turning panics of the document parsers on
+// malformed files into errors
+func extractContentSafe(path string, info os.FileInfo) (doc *extractedDoc, ok bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to parse %s: %v", path, r)
+		}
+	}()
+	return extractContent(path, info)
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/philippgille/chromem-go"
+)
+
+func TestRunStage(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	in := make(chan *indexJob)
+	out := make(chan *indexJob, 100)
+	stop := errors.New("stop")
+	runStage(ctx, cancel, 2, in, out, func(ctx context.Context, job *indexJob) (bool, error) {
+		switch job.relPath {
+		case "skip":
+			return false, nil
+		case "stop":
+			return false, stop
+		}
+		return true, nil
+	})
+
+	// After a failure the remaining jobs are drained, so the sender
+	// doesn't block, and out is closed
+	for _, relPath := range []string{"a", "skip", "b", "stop", "c", "d", "e"} {
+		in <- &indexJob{relPath: relPath}
+	}
+	close(in)
+	var passed []string
+	for job := range out {
+		passed = append(passed, job.relPath)
+	}
+	if !errors.Is(context.Cause(ctx), stop) {
+		t.Errorf("cause = %v, want the stage error", context.Cause(ctx))
+	}
+	for _, relPath := range passed {
+		if relPath == "skip" || relPath == "stop" {
+			t.Errorf("job %s passed on", relPath)
+		}
+	}
+}
+
+func TestIndexExtractionFailures(t *testing.T) {
+	cfg := testConfig(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	pdf, err := os.ReadFile(writeTestPDF(t, "/Title (Test)", []string{"Readable text"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, dir, map[string]string{
+		"a.txt":      "Plain text.",
+		"broken.pdf": "not a pdf",
+		"good.pdf":   string(pdf),
+	})
+	ws := newIndexedWorkspace(t, cfg, chromem.NewDB(), dir, &fakeEmbedder{})
+
+	// The failure is recorded and the other files are indexed
+	if _, ok := ws.metadata.Failed["broken.pdf"]; !ok || len(ws.metadata.Failed) != 1 {
+		t.Errorf("failed files = %v, want broken.pdf", ws.metadata.Failed)
+	}
+	if len(ws.metadata.Files) != 2 {
+		t.Errorf("indexed %d files, want 2", len(ws.metadata.Files))
+	}
+	if status := ws.progress.Status(); status.FilesFailed != 1 || status.FilesDone != 2 || status.Error != "" {
+		t.Errorf("status = %+v, want 2 files done and 1 failed", status)
+	}
+	checkIndexConsistency(t, ws)
+
+	// Fixing a file clears its failure, breaking one drops its chunks
+	writeTestFiles(t, dir, map[string]string{"broken.pdf": string(pdf), "good.pdf": "not a pdf anymore"})
+	if err := ws.indexDocuments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ws.metadata.Failed["good.pdf"]; !ok || len(ws.metadata.Failed) != 1 {
+		t.Errorf("failed files = %v, want good.pdf", ws.metadata.Failed)
+	}
+	if _, ok := ws.metadata.Files["broken.pdf"]; !ok {
+		t.Error("fixed file not indexed")
+	}
+	if _, ok := ws.metadata.Files["good.pdf"]; ok {
+		t.Error("broken file still indexed")
+	}
+	checkIndexConsistency(t, ws)
+
+	// Removing the failed file clears it as well
+	if err := os.Remove(filepath.Join(dir, "good.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.indexDocuments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(ws.metadata.Failed) != 0 {
+		t.Errorf("failed files = %v after removing the file", ws.metadata.Failed)
+	}
+}
+
+func TestIndexCancelled(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.EmbedWorkers = 1
+	dir := t.TempDir()
+	files := map[string]string{"stop.txt": "Stop here."}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		files[name+".txt"] = "File " + name + "."
+	}
+	writeTestFiles(t, dir, files)
+	ws := newTestWorkspace(t, cfg, chromem.NewDB(), defaultWorkspaceName, dir)
+	if err := ws.load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Embedding stop.txt cancels the run mid-stage
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := &fakeEmbedder{fail: func(texts []string) error {
+		if texts[0] == "Stop here." {
+			cancel()
+			return context.Canceled
+		}
+		return nil
+	}}
+	setTestEmbedder(ws, fake)
+	if err := ws.indexDocuments(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("indexDocuments() error = %v, want cancellation", err)
+	}
+	if _, ok := ws.metadata.Files["stop.txt"]; ok {
+		t.Error("file being embedded on cancellation was stored")
+	}
+	if len(ws.metadata.Failed) != 0 {
+		t.Errorf("cancellation recorded as failures: %v", ws.metadata.Failed)
+	}
+	if status := ws.progress.Status(); status.Running || status.FilesFailed != 0 || status.Error == "" {
+		t.Errorf("status = %+v, want a finished run with an error and no failed files", status)
+	}
+
+	// The files stored so far were persisted, the next run does the rest
+	fake.fail = nil
+	fake.embedded()
+	restarted := newIndexedWorkspace(t, cfg, chromem.NewDB(), dir, fake)
+	if len(restarted.metadata.Files) != len(files) {
+		t.Errorf("indexed %d files, want %d", len(restarted.metadata.Files), len(files))
+	}
+	for _, text := range fake.embedded() {
+		if text != "minirag" && !strings.HasPrefix(text, "Stop") && !strings.HasPrefix(text, "File") {
+			t.Errorf("embedded %q", text)
+		}
+	}
+	checkIndexConsistency(t, restarted)
+}
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Index event types sent on /index/events
+const (
+	IndexEventStarted = "started"
+	IndexEventIndexed = "indexed"
+	// The file was modified on disk but its content is the same
+	IndexEventUnchanged = "unchanged"
+	IndexEventFailed    = "failed"
+	IndexEventRemoved   = "removed"
+	IndexEventFinished  = "finished"
+)
+
+// IndexStatus is a snapshot of the current or last indexing run
+type IndexStatus struct {
+	Running         bool       `json:"running"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	FilesDiscovered int        `json:"files_discovered"`
+	FilesDone       int        `json:"files_done"`
+	FilesFailed     int        `json:"files_failed"`
+	FilesRemoved    int        `json:"files_removed"`
+	Chunks          int        `json:"chunks"`
+	ETASeconds      *float64   `json:"eta_seconds,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// IndexEvent reports a step of an indexing run
+type IndexEvent struct {
+	Type   string      `json:"type"`
+	Time   time.Time   `json:"time"`
+	Path   string      `json:"path,omitempty"`
+	Chunks int         `json:"chunks,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Status IndexStatus `json:"status"`
+}
+
+// Number of events buffered per /index/events client. Events for clients
+// that fall further behind are dropped.
+const indexEventBuffer = 256
+
+// indexProgress tracks indexing runs and fans their events out to
+// subscribers
+type indexProgress struct {
+	mu          sync.Mutex
+	status      IndexStatus
+	subscribers map[chan IndexEvent]struct{}
+}
+
+func newIndexProgress() *indexProgress {
+	return &indexProgress{subscribers: make(map[chan IndexEvent]struct{})}
+}
+
+// Status returns the current snapshot including the estimated time left
+func (p *indexProgress) Status() IndexStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshot()
+}
+
+// snapshot must be called with p.mu held
+func (p *indexProgress) snapshot() IndexStatus {
+	s := p.status
+	if s.Running && s.StartedAt != nil && s.FilesDone > 0 {
+		// Files still being discovered are not included, so this is a
+		// lower bound early in a run
+		left := s.FilesDiscovered - s.FilesDone - s.FilesFailed
+		perFile := time.Since(*s.StartedAt).Seconds() / float64(s.FilesDone+s.FilesFailed)
+		eta := perFile * float64(left)
+		s.ETASeconds = &eta
+	}
+	return s
+}
+
+func (p *indexProgress) start() {
+	now := time.Now()
+	p.mu.Lock()
+	p.status = IndexStatus{Running: true, StartedAt: &now}
+	p.publish(IndexEvent{Type: IndexEventStarted})
+	p.mu.Unlock()
+}
+
+func (p *indexProgress) discovered() {
+	p.mu.Lock()
+	p.status.FilesDiscovered++
+	p.mu.Unlock()
+}
+
+func (p *indexProgress) indexed(relPath string, chunks int) {
+	p.mu.Lock()
+	p.status.FilesDone++
+	p.status.Chunks += chunks
+	p.publish(IndexEvent{Type: IndexEventIndexed, Path: relPath, Chunks: chunks})
+	p.mu.Unlock()
+}
+
+func (p *indexProgress) unchanged(relPath string) {
+	p.mu.Lock()
+	p.status.FilesDone++
+	p.publish(IndexEvent{Type: IndexEventUnchanged, Path: relPath})
+	p.mu.Unlock()
+}
+
+func (p *indexProgress) failed(relPath string, err error) {
+	p.mu.Lock()
+	p.status.FilesFailed++
+	p.publish(IndexEvent{Type: IndexEventFailed, Path: relPath, Error: err.Error()})
+	p.mu.Unlock()
+}
+
+func (p *indexProgress) removed(relPath string) {
+	p.mu.Lock()
+	p.status.FilesRemoved++
+	p.publish(IndexEvent{Type: IndexEventRemoved, Path: relPath})
+	p.mu.Unlock()
+}
+
+func (p *indexProgress) finish(err error) {
+	now := time.Now()
+	p.mu.Lock()
+	p.status.Running = false
+	p.status.FinishedAt = &now
+	ev := IndexEvent{Type: IndexEventFinished}
+	if err != nil {
+		p.status.Error = err.Error()
+		ev.Error = err.Error()
+	}
+	p.publish(ev)
+	p.mu.Unlock()
+}
+
+// publish must be called with p.mu held
+func (p *indexProgress) publish(ev IndexEvent) {
+	ev.Time = time.Now()
+	ev.Status = p.snapshot()
+	for ch := range p.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel receiving all further events and a function
+// to unsubscribe
+func (p *indexProgress) subscribe() (<-chan IndexEvent, func()) {
+	ch := make(chan IndexEvent, indexEventBuffer)
+	p.mu.Lock()
+	p.subscribers[ch] = struct{}{}
+	p.mu.Unlock()
+	return ch, func() {
+		p.mu.Lock()
+		delete(p.subscribers, ch)
+		p.mu.Unlock()
+	}
+}
+
+// handleIndexStatus implements GET /index/status?workspace=
+func (a *App) handleIndexStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ws, ok := a.workspaceParam(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.progress.Status())
+}
+
+// handleIndexEvents implements GET /index/events?workspace=, an SSE stream
+// that starts with a "status" event holding the current snapshot followed by
+// the events of running and future indexing runs of the workspace
+func (a *App) handleIndexEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ws, ok := a.workspaceParam(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := ws.progress.subscribe()
+	defer unsubscribe()
+
+	fmt.Fprintf(w, "data: %s\n\n", encodeJSON(IndexEvent{
+		Type:   "status",
+		Time:   time.Now(),
+		Status: ws.progress.Status(),
+	}))
+	flusher.Flush()
+
+	// Comment lines keep proxies from closing an idle stream
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ev := <-events:
+			fmt.Fprintf(w, "data: %s\n\n", encodeJSON(ev))
+		}
+		flusher.Flush()
+	}
+}
+
+// handleIndexErrors implements GET /index/errors?workspace=, listing the
+// files skipped because they could not be extracted
+func (a *App) handleIndexErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ws, ok := a.workspaceParam(w, r)
+	if !ok {
+		return
+	}
+
+	ws.mu.RLock()
+	failed := make([]FailedFile, 0, len(ws.metadata.Failed))
+	for _, f := range ws.metadata.Failed {
+		failed = append(failed, f)
+	}
+	ws.mu.RUnlock()
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Path < failed[j].Path })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(failed)
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper to read the next event of a Server-Sent Events stream, skipping
+// comments and failing on anything but a single data line
+func readIndexEvent(t *testing.T, r *bufio.Reader) IndexEvent {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		if strings.HasPrefix(line, ":") {
+			if blank, _ := r.ReadString('\n'); blank != "\n" {
+				t.Fatalf("comment not followed by a blank line: %q", blank)
+			}
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			t.Fatalf("malformed event line %q", line)
+		}
+		if blank, _ := r.ReadString('\n'); blank != "\n" {
+			t.Fatalf("event not followed by a blank line: %q", blank)
+		}
+		var ev IndexEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("event %q: %v", data, err)
+		}
+		return ev
+	}
+}
+
+func TestIndexStatus(t *testing.T) {
+	app, _ := newTestApp(t, map[string]string{"a.txt": "First.", "b.txt": "Second.", "broken.pdf": "not a pdf"})
+
+	rec := serveTest(app.handleIndexStatus, http.MethodGet, "/index/status", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var status IndexStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Running || status.StartedAt == nil || status.FinishedAt == nil || status.ETASeconds != nil {
+		t.Errorf("status = %+v, want a finished run", status)
+	}
+	if status.FilesDiscovered != 3 || status.FilesDone != 2 || status.FilesFailed != 1 || status.Chunks != 2 || status.Error != "" {
+		t.Errorf("status = %+v", status)
+	}
+
+	tests := []struct {
+		method, target string
+		status         int
+	}{
+		{http.MethodGet, "/index/status?workspace=" + defaultWorkspaceName, http.StatusOK},
+		{http.MethodGet, "/index/status?workspace=missing", http.StatusNotFound},
+		{http.MethodPost, "/index/status", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if rec := serveTest(app.handleIndexStatus, tt.method, tt.target, ""); rec.Code != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestIndexStatusETA(t *testing.T) {
+	p := newIndexProgress()
+	p.start()
+	for i := 0; i < 4; i++ {
+		p.discovered()
+	}
+	if s := p.Status(); s.ETASeconds != nil {
+		t.Errorf("ETA = %v before any file is done", *s.ETASeconds)
+	}
+	p.indexed("a.txt", 3)
+	p.failed("b.pdf", os.ErrInvalid)
+	s := p.Status()
+	if s.ETASeconds == nil || *s.ETASeconds < 0 || s.FilesDone != 1 || s.FilesFailed != 1 || s.Chunks != 3 {
+		t.Errorf("status = %+v, want an ETA for the 2 files left", s)
+	}
+	p.finish(context.Canceled)
+	if s := p.Status(); s.Running || s.ETASeconds != nil || s.Error != context.Canceled.Error() {
+		t.Errorf("status = %+v, want a finished run with its error", s)
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	app, _ := newTestApp(t, map[string]string{"a.txt": "First.", "z.pdf": "not a pdf", "sub/b.pdf": "not a pdf either"})
+
+	rec := serveTest(app.handleIndexErrors, http.MethodGet, "/index/errors", "")
+	var failed []FailedFile
+	if err := json.NewDecoder(rec.Body).Decode(&failed); err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 || failed[0].Path != filepath.Join("sub", "b.pdf") || failed[1].Path != "z.pdf" {
+		t.Fatalf("errors = %+v, want the two PDFs sorted by path", failed)
+	}
+	for _, f := range failed {
+		if f.Error == "" || f.FailedAt.IsZero() || f.Size == 0 || f.Hash == "" {
+			t.Errorf("failure recorded without details: %+v", f)
+		}
+	}
+
+	// No failures give an empty list, not null
+	clean, _ := newTestApp(t, map[string]string{"a.txt": "First."})
+	if rec := serveTest(clean.handleIndexErrors, http.MethodGet, "/index/errors", ""); strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("errors = %s, want []", rec.Body)
+	}
+	if rec := serveTest(app.handleIndexErrors, http.MethodGet, "/index/errors?workspace=missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown workspace = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestIndexEvents(t *testing.T) {
+	app, _ := newTestApp(t, map[string]string{"keep.txt": "Kept.", "gone.txt": "Deleted soon."})
+	ws := app.workspaces[0]
+	srv := httptest.NewServer(http.HandlerFunc(app.handleIndexEvents))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/index/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" || resp.Header.Get("Cache-Control") != "no-cache" {
+		t.Fatalf("status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+	r := bufio.NewReader(resp.Body)
+
+	// The stream opens with the current snapshot
+	ev := readIndexEvent(t, r)
+	if ev.Type != "status" || ev.Status.Running || ev.Status.FilesDone != 2 {
+		t.Fatalf("first event = %+v, want the status of the finished run", ev)
+	}
+
+	// Then every step of the next run follows
+	dir := ws.roots[0].dir
+	if err := os.Remove(filepath.Join(dir, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, dir, map[string]string{"new.txt": "New file.", "broken.pdf": "not a pdf"})
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "keep.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.indexDocuments(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := make(map[string]IndexEvent)
+	var types []string
+	for {
+		ev := readIndexEvent(t, r)
+		types = append(types, ev.Type)
+		steps[ev.Type+" "+ev.Path] = ev
+		if ev.Type == IndexEventFinished {
+			break
+		}
+	}
+	if types[0] != IndexEventStarted || len(types) != 6 {
+		t.Errorf("events %q, want started, four steps and finished", types)
+	}
+	for _, key := range []string{"indexed new.txt", "unchanged keep.txt", "failed broken.pdf", "removed gone.txt"} {
+		if _, ok := steps[key]; !ok {
+			t.Errorf("no %s event in %q", key, types)
+		}
+	}
+	if ev := steps["indexed new.txt"]; ev.Chunks != 1 || !ev.Status.Running || ev.Time.IsZero() {
+		t.Errorf("indexed event = %+v", ev)
+	}
+	if ev := steps["failed broken.pdf"]; ev.Error == "" {
+		t.Errorf("failed event without the error: %+v", ev)
+	}
+	final := steps[IndexEventFinished+" "].Status
+	if final.Running || final.FilesDone != 2 || final.FilesFailed != 1 || final.FilesRemoved != 1 {
+		t.Errorf("final status = %+v", final)
+	}
+
+	// Closing the stream unsubscribes
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ws.progress.mu.Lock()
+		n := len(ws.progress.subscribers)
+		ws.progress.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber kept after the client left")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
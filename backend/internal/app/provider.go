@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"minirag/internal/config"
+)
+
+// Chat providers for the -llm-provider flag
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai"
+)
+
+// ChatProvider generates answers with a chat model served by some backend
+type ChatProvider interface {
+	// Model returns the name of the chat model
+	Model() string
+	// EnsureReady checks that the backend is reachable and the model is
+	// available, pulling it if the backend supports that
+	EnsureReady(ctx context.Context) error
+	// StreamChat sends the messages to the model and streams the answer
+	StreamChat(ctx context.Context, messages []Message, opts ChatOptions) (ChatStream, error)
+}
+
+// ChatOptions are the generation settings of one request
+type ChatOptions struct {
+	Temperature float64
+	MaxTokens   int
+}
+
+// ChatStream yields the answer of a model piece by piece
+type ChatStream interface {
+	// Next returns the next piece of the answer, false once it's finished
+	// or failed
+	Next() (string, bool)
+	// Err returns the error that ended the stream, nil if the answer is
+	// complete
+	Err() error
+	Close() error
+}
+
+// NewChatProvider creates the chat provider selected in the config
+func NewChatProvider(cfg *config.Config) (ChatProvider, error) {
+	switch cfg.ChatProvider {
+	case ProviderOllama:
+		return &ollamaProvider{url: cfg.OllamaURL, model: cfg.OllamaModel}, nil
+	case ProviderOpenAI:
+		if cfg.OpenAIModel == "" {
+			return nil, fmt.Errorf("-openai-model is required for the %s provider", ProviderOpenAI)
+		}
+		return &openAIProvider{
+			url:    strings.TrimRight(cfg.OpenAIURL, "/"),
+			apiKey: cfg.OpenAIAPIKey,
+			model:  cfg.OpenAIModel,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown chat provider %q (expected %s or %s)", cfg.ChatProvider, ProviderOllama, ProviderOpenAI)
+	}
+}
+
+// completeChat sends messages to the provider and returns the whole answer
+func completeChat(ctx context.Context, p ChatProvider, messages []Message, opts ChatOptions) (string, error) {
+	stream, err := p.StreamChat(ctx, messages, opts)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var sb strings.Builder
+	for {
+		piece, ok := stream.Next()
+		if !ok {
+			break
+		}
+		sb.WriteString(piece)
+	}
+	if err := stream.Err(); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
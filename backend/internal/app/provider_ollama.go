@@ -0,0 +1,118 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ollamaProvider talks to Ollama's /api/chat
+type ollamaProvider struct {
+	url   string
+	model string
+}
+
+type ollamaRequest struct {
+	Model    string        `json:"model"`
+	Messages []Message     `json:"messages"`
+	Options  ollamaOptions `json:"options"`
+	Stream   bool          `json:"stream"`
+}
+
+// ollamaOptions are the model parameters, which Ollama ignores at the top
+// level of a request. A temperature of 0 is sent, it's a valid setting.
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type ollamaResponseChunk struct {
+	CreatedAt time.Time `json:"created_at"`
+	Done      bool      `json:"done"`
+	Message   Message   `json:"message"`
+	Model     string    `json:"model"`
+	Error     string    `json:"error,omitempty"`
+}
+
+func (p *ollamaProvider) Model() string {
+	return p.model
+}
+
+func (p *ollamaProvider) EnsureReady(ctx context.Context) error {
+	return ensureOllamaModels(p.url, p.model)
+}
+
+func (p *ollamaProvider) StreamChat(ctx context.Context, messages []Message, opts ChatOptions) (ChatStream, error) {
+	ollamaReq := ollamaRequest{
+		Model:    p.model,
+		Messages: messages,
+		Options: ollamaOptions{
+			Temperature: &opts.Temperature,
+			NumPredict:  opts.MaxTokens,
+		},
+		Stream: true,
+	}
+
+	ollamaBody, err := json.Marshal(ollamaReq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/api/chat", bytes.NewBuffer(ollamaBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	}
+
+	return &ollamaStream{body: resp.Body, decoder: json.NewDecoder(resp.Body)}, nil
+}
+
+// ollamaStream reads the newline-delimited JSON chunks of a streamed
+// Ollama chat response
+type ollamaStream struct {
+	body    io.ReadCloser
+	decoder *json.Decoder
+	done    bool
+	err     error
+}
+
+func (s *ollamaStream) Next() (string, bool) {
+	if s.done || s.err != nil {
+		return "", false
+	}
+	var chunk ollamaResponseChunk
+	if err := s.decoder.Decode(&chunk); err == io.EOF {
+		s.err = fmt.Errorf("ollama closed the stream before the answer was complete")
+		return "", false
+	} else if err != nil {
+		s.err = fmt.Errorf("failed to read ollama stream: %w", err)
+		return "", false
+	}
+	if chunk.Error != "" {
+		s.err = fmt.Errorf("ollama: %s", chunk.Error)
+		return "", false
+	}
+	s.done = chunk.Done
+	return chunk.Message.Content, true
+}
+
+func (s *ollamaStream) Err() error {
+	return s.err
+}
+
+func (s *ollamaStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Helper to run an Ollama server answering /api/chat with body, passing
+// the decoded request to check
+func newTestOllama(t *testing.T, status int, body string, check func(req map[string]any)) *ollamaProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/chat" {
+			t.Errorf("request %s %s, want POST /api/chat", r.Method, r.URL.Path)
+		}
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("request body: %v", err)
+		}
+		if check != nil {
+			check(req)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return &ollamaProvider{url: srv.URL, model: "llama"}
+}
+
+// Helper to read a whole answer
+func readChatStream(s ChatStream) (string, error) {
+	defer s.Close()
+	var answer strings.Builder
+	for {
+		piece, ok := s.Next()
+		if !ok {
+			return answer.String(), s.Err()
+		}
+		answer.WriteString(piece)
+	}
+}
+
+func TestOllamaStreamChat(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        ChatOptions
+		wantOptions string
+	}{
+		{"options", ChatOptions{Temperature: 0.2, MaxTokens: 100}, `{"num_predict":100,"temperature":0.2}`},
+		{"zero temperature", ChatOptions{Temperature: 0}, `{"temperature":0}`},
+	}
+	stream := `{"message":{"role":"assistant","content":"Hel"},"done":false}
+{"message":{"role":"assistant","content":"lo"},"done":false}
+{"message":{"role":"assistant","content":""},"done":true}
+`
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestOllama(t, http.StatusOK, stream, func(req map[string]any) {
+				options, _ := json.Marshal(req["options"])
+				if string(options) != tt.wantOptions {
+					t.Errorf("options = %s, want %s", options, tt.wantOptions)
+				}
+				for _, key := range []string{"temperature", "num_predict", "max_tokens"} {
+					if _, ok := req[key]; ok {
+						t.Errorf("%s sent outside of the options", key)
+					}
+				}
+				messages, _ := json.Marshal(req["messages"])
+				if req["model"] != "llama" || req["stream"] != true || string(messages) != `[{"content":"Hi","role":"user"}]` {
+					t.Errorf("request = %v", req)
+				}
+			})
+			s, err := p.StreamChat(context.Background(), []Message{{Role: "user", Content: "Hi"}}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			answer, err := readChatStream(s)
+			if err != nil || answer != "Hello" {
+				t.Errorf("answer = %q, %v, want %q", answer, err, "Hello")
+			}
+		})
+	}
+}
+
+func TestOllamaStreamChatErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"status", http.StatusNotFound, `{"error":"model not found"}`, "status 404"},
+		{"error chunk", http.StatusOK, `{"message":{"content":"Hi"}}` + "\n" + `{"error":"out of memory"}`, "ollama: out of memory"},
+		{"cut off", http.StatusOK, `{"message":{"content":"Hi"}}`, "before the answer was complete"},
+		{"invalid JSON", http.StatusOK, `{"message":`, "failed to read ollama stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestOllama(t, tt.status, tt.body, nil)
+			s, err := p.StreamChat(context.Background(), []Message{{Role: "user", Content: "Hi"}}, ChatOptions{})
+			if err == nil {
+				_, err = readChatStream(s)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// openAIProvider talks to any server implementing the OpenAI chat
+// completions API, such as llama.cpp server, vLLM or LM Studio
+type openAIProvider struct {
+	url    string // base URL including /v1
+	apiKey string
+	model  string
+}
+
+func (p *openAIProvider) Model() string {
+	return p.model
+}
+
+// EnsureReady checks that the server answers /models. Servers that can't
+// pull models are expected to have it loaded, so a missing model is only
+// logged.
+func (p *openAIProvider) EnsureReady(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/models", nil)
+	if err != nil {
+		return err
+	}
+	p.setHeaders(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return fmt.Errorf("OpenAI-compatible server is not running or not reachable at %s", p.url)
+	}
+	defer resp.Body.Close()
+
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return fmt.Errorf("failed to decode model list: %w", err)
+	}
+	for _, m := range models.Data {
+		if m.ID == p.model {
+			log.Printf("Model %s is available", p.model)
+			return nil
+		}
+	}
+	log.Printf("Warning: model %s is not listed by %s/models", p.model, p.url)
+	return nil
+}
+
+func (p *openAIProvider) StreamChat(ctx context.Context, messages []Message, opts ChatOptions) (ChatStream, error) {
+	body := map[string]interface{}{
+		"model":       p.model,
+		"messages":    messages,
+		"temperature": opts.Temperature,
+		"stream":      true,
+	}
+	if opts.MaxTokens > 0 {
+		body["max_tokens"] = opts.MaxTokens
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/chat/completions", bytes.NewBuffer(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	p.setHeaders(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("chat completion failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return &openAIStream{body: resp.Body, scanner: bufio.NewScanner(resp.Body)}, nil
+}
+
+func (p *openAIProvider) setHeaders(req *http.Request) {
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+}
+
+// openAIStream reads the server-sent events of a streamed chat completion
+type openAIStream struct {
+	body     io.ReadCloser
+	scanner  *bufio.Scanner
+	finished bool // a finish reason or [DONE] was received
+	err      error
+}
+
+func (s *openAIStream) Next() (string, bool) {
+	if s.err != nil {
+		return "", false
+	}
+	for s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			s.finished = true
+			return "", false
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			s.err = fmt.Errorf("failed to decode chat completion chunk: %w", err)
+			return "", false
+		}
+		if chunk.Error != nil {
+			s.err = fmt.Errorf("chat completion failed: %s", chunk.Error.Message)
+			return "", false
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if chunk.Choices[0].FinishReason != nil {
+			s.finished = true
+		}
+		if chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		return chunk.Choices[0].Delta.Content, true
+	}
+
+	// Some servers end the stream after the finish reason without [DONE]
+	if err := s.scanner.Err(); err != nil {
+		s.err = fmt.Errorf("failed to read chat completion stream: %w", err)
+	} else if !s.finished {
+		s.err = fmt.Errorf("chat completion stream ended before the answer was complete")
+	}
+	return "", false
+}
+
+func (s *openAIStream) Err() error {
+	return s.err
+}
+
+func (s *openAIStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeChatProvider answers with the pieces returned by reply, recording
+// the messages it was sent
+type fakeChatProvider struct {
+	mu       sync.Mutex
+	requests [][]Message
+	options  []ChatOptions
+	// Returns the pieces of the answer and the error ending the stream
+	// after them, or fails the request when start is set
+	reply func(messages []Message) (pieces []string, err error)
+	start error
+}
+
+func (p *fakeChatProvider) Model() string {
+	return "fake-chat"
+}
+
+func (p *fakeChatProvider) EnsureReady(ctx context.Context) error {
+	return nil
+}
+
+func (p *fakeChatProvider) StreamChat(ctx context.Context, messages []Message, opts ChatOptions) (ChatStream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, append([]Message(nil), messages...))
+	p.options = append(p.options, opts)
+	if p.start != nil {
+		return nil, p.start
+	}
+	s := &fakeChatStream{}
+	if p.reply != nil {
+		s.pieces, s.err = p.reply(messages)
+	}
+	return s, nil
+}
+
+// Helper to get the requests sent so far and forget them
+func (p *fakeChatProvider) sent() [][]Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	requests := p.requests
+	p.requests = nil
+	p.options = nil
+	return requests
+}
+
+type fakeChatStream struct {
+	pieces []string
+	err    error
+}
+
+func (s *fakeChatStream) Next() (string, bool) {
+	if len(s.pieces) == 0 {
+		return "", false
+	}
+	piece := s.pieces[0]
+	s.pieces = s.pieces[1:]
+	return piece, true
+}
+
+func (s *fakeChatStream) Err() error {
+	if len(s.pieces) > 0 {
+		return nil
+	}
+	return s.err
+}
+
+func (s *fakeChatStream) Close() error {
+	return nil
+}
+
+// Helper to make a provider replying with fixed pieces
+func replyWith(pieces ...string) func([]Message) ([]string, error) {
+	return func([]Message) ([]string, error) {
+		return pieces, nil
+	}
+}
+
+func TestCompleteChat(t *testing.T) {
+	ctx := context.Background()
+	p := &fakeChatProvider{reply: replyWith("Hel", "lo")}
+	if answer, err := completeChat(ctx, p, []Message{{Role: "user", Content: "Hi"}}, ChatOptions{}); err != nil || answer != "Hello" {
+		t.Errorf("completeChat() = %q, %v, want %q", answer, err, "Hello")
+	}
+
+	p.reply = func([]Message) ([]string, error) {
+		return []string{"Hel"}, errors.New("connection reset")
+	}
+	if _, err := completeChat(ctx, p, nil, ChatOptions{}); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("completeChat() error = %v, want the stream error", err)
+	}
+
+	p.start = errors.New("refused")
+	if _, err := completeChat(ctx, p, nil, ChatOptions{}); err == nil {
+		t.Error("completeChat() succeeded with a failing provider")
+	}
+}
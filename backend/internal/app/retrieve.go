@@ -0,0 +1,230 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// Retrieval modes for the "mode" request parameter
+const (
+	RetrievalVector  = "vector"
+	RetrievalLexical = "lexical"
+	RetrievalHybrid  = "hybrid"
+)
+
+// Constant k of reciprocal rank fusion, dampens the weight of top ranks
+const rrfK = 60
+
+// Helper to validate a retrieval mode, falling back to the configured default
+func (a *App) retrievalMode(mode string) (string, error) {
+	if mode == "" {
+		mode = a.cfg.RetrievalMode
+	}
+	switch mode {
+	case RetrievalVector, RetrievalLexical, RetrievalHybrid:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown retrieval mode %q (expected %s, %s or %s)", mode, RetrievalVector, RetrievalLexical, RetrievalHybrid)
+	}
+}
+
+// errIndexRebuilding rejects vector and hybrid retrieval while the index is
+// rebuilt for a new embedding model or chunker
+var errIndexRebuilding = errors.New("the index is being rebuilt for changed settings, only lexical retrieval is available until it's done")
+
+// Helper to check that the workspace can answer in the retrieval mode
+func (ws *workspace) checkRetrievalMode(mode string) error {
+	if mode != RetrievalLexical && ws.rebuilding.Load() {
+		return fmt.Errorf("workspace %s: %w", ws.name, errIndexRebuilding)
+	}
+	return nil
+}
+
+// retrieve returns up to n chunks for the query, ranked by embedding
+// similarity, BM25 or both fused with reciprocal rank fusion. A non-nil
+// filter restricts the search to the files it matches.
+func (ws *workspace) retrieve(ctx context.Context, coll *chromem.Collection, query string, n int, mode string, filter *fileFilter) ([]Document, error) {
+	if err := ws.checkRetrievalMode(mode); err != nil {
+		return nil, err
+	}
+	// The collection is recreated on a full reindex
+	if coll == nil {
+		return nil, nil
+	}
+	if n > coll.Count() {
+		n = coll.Count()
+	}
+
+	var files map[string]bool
+	if filter != nil {
+		var chunks int
+		files, chunks = ws.matchingFiles(filter)
+		if n > chunks {
+			n = chunks
+		}
+	}
+	if n == 0 || query == "" {
+		return nil, nil
+	}
+
+	switch mode {
+	case RetrievalVector:
+		return ws.vectorSearch(ctx, coll, query, n, files)
+	case RetrievalLexical:
+		return ws.lexicalSearch(ctx, coll, query, n, files)
+	}
+
+	// Fetch deeper lists than requested so that chunks ranked well by only
+	// one of the retrievers still get a chance
+	depth := n * 3
+	if depth > coll.Count() {
+		depth = coll.Count()
+	}
+	vector, err := ws.vectorSearch(ctx, coll, query, depth, files)
+	if err != nil {
+		return nil, err
+	}
+	lexical, err := ws.lexicalSearch(ctx, coll, query, depth, files)
+	if err != nil {
+		return nil, err
+	}
+	return fuseRRF(n, vector, lexical), nil
+}
+
+// vectorSearch returns the n chunks most similar to the query. With files
+// set, chromem can't filter by them, so it ranks ever more chunks until n
+// of them belong to the files.
+func (ws *workspace) vectorSearch(ctx context.Context, coll *chromem.Collection, query string, n int, files map[string]bool) ([]Document, error) {
+	embedding, err := ws.embeddingFunc(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	depth := n
+	if files != nil {
+		depth = n * 4
+	}
+	for {
+		// Chunks may have been deleted by indexing since n was picked
+		count := coll.Count()
+		if depth > count {
+			depth = count
+		}
+		if depth == 0 {
+			return nil, nil
+		}
+		results, err := coll.QueryEmbedding(ctx, embedding, depth, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		docs := make([]Document, 0, n)
+		for _, res := range results {
+			if files != nil && !files[chunkFile(res.ID)] {
+				continue
+			}
+			doc := documentFromChunk(res.ID, res.Content, res.Metadata)
+			doc.Similarity = float64(res.Similarity)
+			doc.Score = float64(res.Similarity)
+			docs = append(docs, doc)
+			if len(docs) == n {
+				break
+			}
+		}
+		if len(docs) == n || depth == count {
+			return docs, nil
+		}
+		depth *= 4
+	}
+}
+
+func (ws *workspace) lexicalSearch(ctx context.Context, coll *chromem.Collection, query string, n int, files map[string]bool) ([]Document, error) {
+	depth := n
+	if files != nil {
+		// Scoring is done for every matching chunk anyway
+		depth = ws.lexical.Count()
+	}
+	hits := ws.lexical.Search(query, depth)
+
+	docs := make([]Document, 0, n)
+	for _, hit := range hits {
+		if len(docs) == n {
+			break
+		}
+		if files != nil && !files[chunkFile(hit.ID)] {
+			continue
+		}
+		doc, err := coll.GetByID(ctx, hit.ID)
+		if err != nil {
+			// The lexical index may briefly be ahead of the collection
+			continue
+		}
+		d := documentFromChunk(doc.ID, doc.Content, doc.Metadata)
+		d.Score = hit.Score
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
+
+// Helper to build a result from a chunk and its metadata in the collection
+func documentFromChunk(id, content string, meta map[string]string) Document {
+	doc := Document{
+		ID:       id,
+		Content:  content,
+		Path:     meta[metaPath],
+		FileType: meta[metaFileType],
+		Heading:  meta[metaHeading],
+		Title:    meta[metaTitle],
+		Author:   meta[metaAuthor],
+		Created:  meta[metaCreated],
+		Updated:  meta[metaUpdated],
+		Modified: meta[metaModified],
+	}
+	doc.Page, _ = strconv.Atoi(meta[metaPage])
+	doc.Slide, _ = strconv.Atoi(meta[metaSlide])
+	doc.Sheet, _ = strconv.Atoi(meta[metaSheet])
+	doc.CharStart, _ = strconv.Atoi(meta[metaCharStart])
+	doc.CharEnd, _ = strconv.Atoi(meta[metaCharEnd])
+	return doc
+}
+
+// fuseRRF merges ranked lists with reciprocal rank fusion and returns the
+// top n. Similarity is kept from the vector list where available.
+func fuseRRF(n int, lists ...[]Document) []Document {
+	fused := make(map[string]*Document)
+	for _, list := range lists {
+		for rank, doc := range list {
+			f, ok := fused[doc.ID]
+			if !ok {
+				d := doc
+				d.Score = 0
+				f = &d
+				fused[doc.ID] = f
+			}
+			if f.Similarity == 0 {
+				f.Similarity = doc.Similarity
+			}
+			f.Score += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	docs := make([]Document, 0, len(fused))
+	for _, d := range fused {
+		docs = append(docs, *d)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Score != docs[j].Score {
+			return docs[i].Score > docs[j].Score
+		}
+		return docs[i].ID < docs[j].ID
+	})
+	if len(docs) > n {
+		docs = docs[:n]
+	}
+	return docs
+}
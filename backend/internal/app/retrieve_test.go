@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// Helper to list the IDs of documents
+func docIDs(docs []Document) []string {
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids
+}
+
+func TestFuseRRF(t *testing.T) {
+	d := func(id string) Document {
+		return Document{ID: id, Score: 42}
+	}
+	tests := []struct {
+		name    string
+		n       int
+		vector  []Document
+		lexical []Document
+		want    []string
+	}{
+		{"ties broken by ID", 4, []Document{d("a"), d("b"), d("c")}, []Document{d("b"), d("a"), d("d")}, []string{"a", "b", "c", "d"}},
+		{"found by both beats top of one", 3, []Document{d("x"), d("y")}, []Document{d("z"), d("y")}, []string{"y", "x", "z"}},
+		{"found by one only", 3, []Document{d("a"), d("b")}, []Document{d("c")}, []string{"a", "c", "b"}},
+		{"only vector results", 2, []Document{d("b"), d("a"), d("c")}, nil, []string{"b", "a"}},
+		{"only lexical results", 5, nil, []Document{d("c"), d("a")}, []string{"c", "a"}},
+		{"no results", 3, nil, nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := docIDs(fuseRRF(tt.n, tt.vector, tt.lexical)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fuseRRF() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Scores are the fused ones, similarities come from the vector list
+	vector := []Document{{ID: "a", Similarity: 0.9, Score: 0.9}, {ID: "b", Similarity: 0.5, Score: 0.5}}
+	lexical := []Document{{ID: "b", Score: 7}, {ID: "a", Score: 3}}
+	fused := fuseRRF(2, lexical, vector)
+	rank := func(r int) float64 {
+		return 1 / float64(rrfK+r)
+	}
+	want := []Document{
+		{ID: "a", Similarity: 0.9, Score: rank(2) + rank(1)},
+		{ID: "b", Similarity: 0.5, Score: rank(1) + rank(2)},
+	}
+	if !reflect.DeepEqual(fused, want) {
+		t.Errorf("fuseRRF() = %+v, want %+v", fused, want)
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	cfg := testConfig(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	// The fake embedder compares letter counts: "abrezz" is close to
+	// "zebra" but has no matching term, the stripes are further off
+	writeTestFiles(t, dir, map[string]string{
+		"zebra.txt":    "zebra",
+		"abrezz.txt":   "abrezz",
+		"sub/herd.txt": "Stripes of a zebra herd.",
+		"other.txt":    "Cacti store water.",
+	})
+	ws := newIndexedWorkspace(t, cfg, chromem.NewDB(), dir, &fakeEmbedder{})
+	coll := ws.db.GetCollection(ws.name, ws.embeddingFunc)
+	id := func(path string) string {
+		return chunkID(path, 0)
+	}
+	herd := chunkID(filepath.FromSlash("sub/herd.txt"), 0)
+	herdFilter, err := compileFilter(&RetrievalFilter{PathPrefix: "sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		n      int
+		mode   string
+		filter *fileFilter
+		want   []string
+	}{
+		{"vector", "zebra", 4, RetrievalVector, nil, []string{id("zebra.txt"), id("abrezz.txt"), herd, id("other.txt")}},
+		{"lexical", "zebra", 4, RetrievalLexical, nil, []string{id("zebra.txt"), herd}},
+		{"hybrid", "zebra", 4, RetrievalHybrid, nil, []string{id("zebra.txt"), herd, id("abrezz.txt"), id("other.txt")}},
+		{"hybrid top", "zebra", 2, RetrievalHybrid, nil, []string{id("zebra.txt"), herd}},
+		{"more than indexed", "zebra", 10, RetrievalHybrid, nil, []string{id("zebra.txt"), herd, id("abrezz.txt"), id("other.txt")}},
+		{"filtered", "zebra", 4, RetrievalHybrid, herdFilter, []string{herd}},
+		{"no lexical match", "abrezz", 1, RetrievalLexical, nil, []string{id("abrezz.txt")}},
+		{"empty query", "", 4, RetrievalHybrid, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := ws.retrieve(ctx, coll, tt.query, tt.n, tt.mode, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := docIDs(docs)
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("retrieve(%q, %d, %s) = %q, want %q", tt.query, tt.n, tt.mode, got, tt.want)
+			}
+		})
+	}
+
+	// Results carry the metadata of their chunks
+	docs, err := ws.retrieve(ctx, coll, "herd", 1, RetrievalLexical, nil)
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("retrieve() = %v, %v", docs, err)
+	}
+	if docs[0].Path != "sub/herd.txt" || docs[0].FileType == "" || docs[0].CharEnd != len("Stripes of a zebra herd.") {
+		t.Errorf("result = %+v", docs[0])
+	}
+
+	// Only lexical retrieval works while the index is rebuilt
+	ws.rebuilding.Store(true)
+	if _, err := ws.retrieve(ctx, coll, "zebra", 4, RetrievalHybrid, nil); !errors.Is(err, errIndexRebuilding) {
+		t.Errorf("hybrid retrieval during a rebuild: %v", err)
+	}
+	if _, err := ws.retrieve(ctx, coll, "zebra", 4, RetrievalLexical, nil); err != nil {
+		t.Errorf("lexical retrieval during a rebuild: %v", err)
+	}
+}
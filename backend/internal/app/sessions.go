@@ -0,0 +1,249 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session is a stored chat conversation
+type Session struct {
+	ID        string        `json:"id"`
+	Title     string        `json:"title"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Turns     []SessionTurn `json:"turns"`
+}
+
+// SessionTurn is one question with the answer it got
+type SessionTurn struct {
+	Question         string     `json:"question"`
+	SearchQuery      string     `json:"search_query,omitempty"`
+	Workspace        string     `json:"workspace,omitempty"`
+	Answer           string     `json:"answer"`
+	Sources          []Document `json:"sources"`
+	Model            string     `json:"model"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ProcessingTimeMs int64      `json:"processing_time_ms"`
+}
+
+// SessionSummary is the list view of a session
+type SessionSummary struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Turns     int       `json:"turns"`
+}
+
+// Session IDs become file names, so only a safe alphabet is accepted
+var sessionIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// sessionStore keeps chat sessions in memory and persists each one as a
+// JSON file in the sessions directory
+type sessionStore struct {
+	dir      string
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+func newSessionStore(dir string) (*sessionStore, error) {
+	s := &sessionStore{
+		dir:      dir,
+		sessions: make(map[string]*Session),
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			log.Printf("Failed to read session %s: %v", e.Name(), err)
+			continue
+		}
+		var sess Session
+		if err := json.Unmarshal(b, &sess); err != nil || !sessionIDRe.MatchString(sess.ID) {
+			log.Printf("Skipping invalid session file %s: %v", e.Name(), err)
+			continue
+		}
+		s.sessions[sess.ID] = &sess
+	}
+	log.Printf("Loaded %d chat sessions", len(s.sessions))
+	return s, nil
+}
+
+// History returns the last maxHistoryMessages messages of a session
+func (s *sessionStore) History(id string) []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	var msgs []Message
+	for _, t := range sess.Turns {
+		msgs = append(msgs,
+			Message{Role: "user", Content: t.Question},
+			Message{Role: "assistant", Content: t.Answer},
+		)
+	}
+	return trimHistory(msgs)
+}
+
+// AddTurn records a turn, creating the session if needed
+func (s *sessionStore) AddTurn(id string, turn SessionTurn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		sess = &Session{
+			ID:        id,
+			Title:     sessionTitle(turn.Question),
+			CreatedAt: turn.CreatedAt,
+		}
+		s.sessions[id] = sess
+	}
+	sess.Turns = append(sess.Turns, turn)
+	sess.UpdatedAt = turn.CreatedAt
+
+	return s.save(sess)
+}
+
+// Get returns a copy of a session
+func (s *sessionStore) Get(id string) (Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	cp := *sess
+	cp.Turns = append([]SessionTurn(nil), sess.Turns...)
+	return cp, true
+}
+
+// List returns all sessions, most recently updated first
+func (s *sessionStore) List() []SessionSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]SessionSummary, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		list = append(list, SessionSummary{
+			ID:        sess.ID,
+			Title:     sess.Title,
+			CreatedAt: sess.CreatedAt,
+			UpdatedAt: sess.UpdatedAt,
+			Turns:     len(sess.Turns),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UpdatedAt.After(list[j].UpdatedAt)
+	})
+	return list
+}
+
+// Delete removes a session from memory and disk
+func (s *sessionStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return false, nil
+	}
+	delete(s.sessions, id)
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return true, err
+	}
+	return true, nil
+}
+
+func (s *sessionStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// save writes a session atomically, the caller must hold the lock
+func (s *sessionStore) save(sess *Session) error {
+	b, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(sess.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(sess.ID))
+}
+
+// Helper to derive a session title from its first question
+func sessionTitle(question string) string {
+	title := strings.Join(strings.Fields(question), " ")
+	if r := []rune(title); len(r) > 80 {
+		title = string(r[:80]) + "…"
+	}
+	return title
+}
+
+// handleSessions lists stored chat sessions
+func (a *App) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.sessions.List())
+}
+
+// handleSession returns (GET) or deletes (DELETE) the session at /sessions/{id}
+func (a *App) handleSession(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/sessions/")
+	if !sessionIDRe.MatchString(id) {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sess, ok := a.sessions.Get(id)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sess)
+	case http.MethodDelete:
+		found, err := a.sessions.Delete(id)
+		if err != nil {
+			log.Printf("Failed to delete session %s: %v", id, err)
+			http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,237 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Helper to build a turn asked at the given minute
+func testTurn(question string, minute int) SessionTurn {
+	return SessionTurn{
+		Question:  question,
+		Answer:    "Answer to " + question,
+		Model:     "fake-chat",
+		CreatedAt: time.Date(2024, 1, 1, 10, minute, 0, 0, time.UTC),
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first turn creates the session, later ones are appended
+	if err := s.AddTurn("one", testTurn("  How does\n indexing work? ", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTurn("one", testTurn("And the watcher?", 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTurn("two", testTurn("Other question", 3)); err != nil {
+		t.Fatal(err)
+	}
+	sess, ok := s.Get("one")
+	if !ok || sess.Title != "How does indexing work?" || len(sess.Turns) != 2 {
+		t.Fatalf("Get() = %+v, %v", sess, ok)
+	}
+	if !sess.CreatedAt.Equal(testTurn("", 0).CreatedAt) || !sess.UpdatedAt.Equal(testTurn("", 5).CreatedAt) {
+		t.Errorf("created %v, updated %v", sess.CreatedAt, sess.UpdatedAt)
+	}
+
+	// Get returns a copy
+	sess.Turns[0].Answer = "changed"
+	if again, _ := s.Get("one"); again.Turns[0].Answer == "changed" {
+		t.Error("Get() shares the turns with the store")
+	}
+	if _, ok := s.Get("missing"); ok {
+		t.Error("Get() found a missing session")
+	}
+
+	list := s.List()
+	if len(list) != 2 || list[0].ID != "one" || list[0].Turns != 2 || list[1].ID != "two" {
+		t.Errorf("List() = %+v, want the most recently updated first", list)
+	}
+
+	history := s.History("one")
+	want := []Message{
+		{Role: "user", Content: "  How does\n indexing work? "},
+		{Role: "assistant", Content: "Answer to   How does\n indexing work? "},
+		{Role: "user", Content: "And the watcher?"},
+		{Role: "assistant", Content: "Answer to And the watcher?"},
+	}
+	if fmt.Sprint(history) != fmt.Sprint(want) {
+		t.Errorf("History() = %q, want %q", history, want)
+	}
+	if s.History("missing") != nil {
+		t.Error("History() of a missing session isn't empty")
+	}
+
+	// Sessions are kept across restarts, broken files are skipped
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad-id.json"), []byte(`{"id":"../escape"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := newSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.List(); len(got) != 2 || got[0] != list[0] || got[1] != list[1] {
+		t.Errorf("reloaded List() = %+v, want %+v", got, list)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+
+	// Deleted sessions are gone from memory and disk
+	if found, err := reloaded.Delete("one"); !found || err != nil {
+		t.Fatalf("Delete() = %v, %v", found, err)
+	}
+	if found, _ := reloaded.Delete("one"); found {
+		t.Error("second Delete() found the session")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "one.json")); !os.IsNotExist(err) {
+		t.Errorf("session file not removed: %v", err)
+	}
+	if again, _ := newSessionStore(dir); len(again.List()) != 1 {
+		t.Errorf("deleted session restored after a restart")
+	}
+}
+
+func TestSessionHistoryCap(t *testing.T) {
+	s, err := newSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 12; i++ {
+		if err := s.AddTurn("long", testTurn(fmt.Sprintf("question %d", i), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := s.History("long")
+	if len(history) != maxHistoryMessages || history[0].Content != "question 2" || history[len(history)-1].Content != "Answer to question 11" {
+		t.Errorf("History() kept %d messages from %q to %q", len(history), history[0].Content, history[len(history)-1].Content)
+	}
+}
+
+func TestSessionStoreConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const writers, turns = 8, 10
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		id := fmt.Sprintf("session-%d", w%3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < turns; i++ {
+				if err := s.AddTurn(id, testTurn("question", i)); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < turns; i++ {
+				s.History(id)
+				s.List()
+				if sess, ok := s.Get(id); ok && len(sess.Turns) == 0 {
+					t.Error("session without turns")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, sum := range s.List() {
+		total += sum.Turns
+	}
+	if total != writers*turns {
+		t.Errorf("stored %d turns, want %d", total, writers*turns)
+	}
+	reloaded, err := newSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sum := range s.List() {
+		if sess, _ := reloaded.Get(sum.ID); len(sess.Turns) != sum.Turns {
+			t.Errorf("session %s saved with %d turns, want %d", sum.ID, len(sess.Turns), sum.Turns)
+		}
+	}
+}
+
+func TestSessionTitle(t *testing.T) {
+	long := strings.Repeat("ä", 100)
+	tests := []struct {
+		question, want string
+	}{
+		{"Short question?", "Short question?"},
+		{"  spaced \n\t out  ", "spaced out"},
+		{long, strings.Repeat("ä", 80) + "…"},
+		{strings.Repeat("ä", 80), strings.Repeat("ä", 80)},
+	}
+	for _, tt := range tests {
+		if got := sessionTitle(tt.question); got != tt.want {
+			t.Errorf("sessionTitle(%q) = %q, want %q", tt.question, got, tt.want)
+		}
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	s, err := newSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTurn("abc", testTurn("Question", 0)); err != nil {
+		t.Fatal(err)
+	}
+	app := &App{sessions: s}
+
+	rec := serveTest(app.handleSessions, http.MethodGet, "/sessions", "")
+	var list []SessionSummary
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list) != 1 || list[0].ID != "abc" {
+		t.Errorf("GET /sessions = %+v, %v", list, err)
+	}
+
+	rec = serveTest(app.handleSession, http.MethodGet, "/sessions/abc", "")
+	var sess Session
+	if err := json.NewDecoder(rec.Body).Decode(&sess); err != nil || len(sess.Turns) != 1 || sess.Turns[0].Question != "Question" {
+		t.Errorf("GET /sessions/abc = %+v, %v", sess, err)
+	}
+
+	tests := []struct {
+		method, target string
+		status         int
+	}{
+		{http.MethodPost, "/sessions", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/sessions/..%2Fx", http.StatusBadRequest},
+		{http.MethodGet, "/sessions/missing", http.StatusNotFound},
+		{http.MethodPut, "/sessions/abc", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/sessions/abc", http.StatusNoContent},
+		{http.MethodDelete, "/sessions/abc", http.StatusNotFound},
+		{http.MethodGet, "/sessions/abc", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		handler := app.handleSession
+		if tt.target == "/sessions" {
+			handler = app.handleSessions
+		}
+		if rec := serveTest(handler, tt.method, tt.target, ""); rec.Code != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"unicode"
+)
+
+// estimateTokens approximates the number of tokens a model's tokenizer
+// produces for s without loading the tokenizer. It assumes about four
+// characters per token for ASCII words, three for other alphabets such as
+// Cyrillic, one token per CJK character and one per punctuation mark. The
+// estimate errs on the high side, which is what a budget needs.
+func estimateTokens(s string) int {
+	tokens := 0
+	ascii, other := 0, 0
+
+	flushWord := func() {
+		tokens += (ascii + 3) / 4
+		tokens += (other + 2) / 3
+		ascii, other = 0, 0
+	}
+
+	for _, r := range s {
+		switch {
+		case isCJK(r):
+			flushWord()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if r < unicode.MaxASCII {
+				ascii++
+			} else {
+				other++
+			}
+		case unicode.IsSpace(r):
+			flushWord()
+		default:
+			flushWord()
+			tokens++
+		}
+	}
+	flushWord()
+	return tokens
+}
+
+// truncateToTokens cuts s so that its estimated size is at most maxTokens,
+// preferring to cut at whitespace
+func truncateToTokens(s string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	if estimateTokens(s) <= maxTokens {
+		return s
+	}
+
+	// Binary search for the longest rune prefix that fits
+	runes := []rune(s)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if estimateTokens(string(runes[:mid])) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	cut := lo
+	for i := lo - 1; i > lo/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return string(runes[:cut])
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
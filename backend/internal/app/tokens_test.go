@@ -0,0 +1,78 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"hi", 1},
+		{"hello", 2},
+		{"hello world", 4},
+		{"Hello, world!", 6},
+		{"  spaced\n\tout  ", 3},
+		{"2024", 1},
+		{"café", 2},
+		{"привет", 2},
+		{"日本語", 3},
+		{"日本語のテキスト", 8},
+		{"한국어", 3},
+		{"abc日本", 3},
+		{"日本 abc", 3},
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.s); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateToTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"fits", "one two", 5, "one two"},
+		{"exact fit", "one two", 2, "one two"},
+		{"no budget", "one two", 0, ""},
+		{"negative budget", "one two", -1, ""},
+		{"cut at whitespace", "one two three four", 3, "one two"},
+		{"no whitespace", "abcdefghijklmnop", 2, "abcdefgh"},
+		{"CJK", "日本語テキスト", 3, "日本語"},
+		{"Cyrillic", "привет мир", 2, "привет"},
+		{"mixed", "日本 abc 日本", 3, "日本 abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateToTokens(tt.s, tt.max); got != tt.want {
+				t.Errorf("truncateToTokens(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+		})
+	}
+
+	// Cuts never split a rune and always fit
+	texts := []string{
+		strings.Repeat("日本語のテキスト ", 20),
+		strings.Repeat("привет, мир! ", 20),
+		strings.Repeat("emoji 🙂🙂 and text ", 20),
+	}
+	for _, s := range texts {
+		for max := 1; max < estimateTokens(s); max += 7 {
+			got := truncateToTokens(s, max)
+			if !utf8.ValidString(got) || !strings.HasPrefix(s, got) {
+				t.Fatalf("truncateToTokens(%q, %d) = %q, not a valid prefix", s, max, got)
+			}
+			if n := estimateTokens(got); n > max {
+				t.Fatalf("truncateToTokens(%q, %d) = %q of %d tokens", s, max, got, n)
+			}
+		}
+	}
+}
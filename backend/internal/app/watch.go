@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How long a watched directory has to stay quiet before a batch of changes
+// is reindexed
+const watchDebounce = time.Second
+
+// fsWatcher reports paths below a watched directory that may have been
+// added, modified or deleted. Events is closed when the watcher stops.
+type fsWatcher interface {
+	Events() <-chan string
+	Close() error
+}
+
+// startWatcher watches the workspace's directories and reindexes changed
+// files in the background until ctx is cancelled.
+func (ws *workspace) startWatcher(ctx context.Context) error {
+	for _, root := range ws.roots {
+		w, err := newFSWatcher(root.dir, ws.cfg.WatchInterval)
+		if err != nil {
+			return err
+		}
+		log.Printf("Watching %s for changes", root.dir)
+		go ws.watchDocuments(ctx, w)
+	}
+	return nil
+}
+
+func (ws *workspace) watchDocuments(ctx context.Context, w fsWatcher) {
+	defer w.Close()
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case path, ok := <-w.Events():
+			if !ok {
+				log.Printf("Watcher stopped")
+				return
+			}
+			pending[path] = true
+			timer.Reset(watchDebounce)
+		case <-timer.C:
+			if len(pending) == 0 {
+				continue
+			}
+			paths := compactPaths(pending)
+			pending = make(map[string]bool)
+			log.Printf("Detected changes in %d paths, reindexing...", len(paths))
+			if err := ws.syncPaths(ctx, paths); err != nil {
+				log.Printf("Failed to reindex changed files: %v", err)
+			}
+		}
+	}
+}
+
+// Helper to sort changed paths and drop the ones already covered by a
+// changed parent directory
+func compactPaths(set map[string]bool) []string {
+	paths := make([]string, 0, len(set))
+	for p := range set {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var out []string
+	for _, p := range paths {
+		if len(out) > 0 && isUnderPath(p, out[len(out)-1]) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+type pollFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// pollWatcher detects changes by rescanning the tree at a fixed interval.
+// It is used where inotify is not available.
+type pollWatcher struct {
+	root      string
+	interval  time.Duration
+	events    chan string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPollWatcher(root string, interval time.Duration) (*pollWatcher, error) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+	w := &pollWatcher{
+		root:     root,
+		interval: interval,
+		events:   make(chan string, 256),
+		done:     make(chan struct{}),
+	}
+	go w.loop(w.scan())
+	return w, nil
+}
+
+func (w *pollWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *pollWatcher) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	return nil
+}
+
+func (w *pollWatcher) loop(prev map[string]pollFileState) {
+	defer close(w.events)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		cur := w.scan()
+		for path, state := range cur {
+			if old, ok := prev[path]; !ok || !old.modTime.Equal(state.modTime) || old.size != state.size {
+				if !w.emit(path) {
+					return
+				}
+			}
+		}
+		for path := range prev {
+			if _, ok := cur[path]; !ok {
+				if !w.emit(path) {
+					return
+				}
+			}
+		}
+		prev = cur
+	}
+}
+
+func (w *pollWatcher) scan() map[string]pollFileState {
+	state := make(map[string]pollFileState)
+	filepath.Walk(w.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		state[path] = pollFileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return state
+}
+
+func (w *pollWatcher) emit(path string) bool {
+	select {
+	case w.events <- path:
+		return true
+	case <-w.done:
+		return false
+	}
+}
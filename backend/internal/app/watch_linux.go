@@ -0,0 +1,165 @@
+//go:build linux
+
+package app
+
+import (
+	"encoding/binary"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+func newFSWatcher(root string, interval time.Duration) (fsWatcher, error) {
+	w, err := newInotifyWatcher(root)
+	if err != nil {
+		log.Printf("inotify is unavailable (%v), falling back to polling", err)
+		return newPollWatcher(root, interval)
+	}
+	return w, nil
+}
+
+// inotifyWatcher watches every directory of the tree with inotify. New
+// subdirectories are added as they appear.
+type inotifyWatcher struct {
+	root      string
+	fd        int // kept separately, calling f.Fd() would make reads blocking
+	f         *os.File
+	events    chan string
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	watches map[int32]string
+}
+
+func newInotifyWatcher(root string) (*inotifyWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotifyWatcher{
+		root:    root,
+		fd:      fd,
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		events:  make(chan string, 256),
+		done:    make(chan struct{}),
+		watches: make(map[int32]string),
+	}
+	if err := w.addTree(root); err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.f.Close()
+	})
+	return err
+}
+
+// addTree adds a watch for dir and all its subdirectories
+func (w *inotifyWatcher) addTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			log.Printf("Failed to watch %s: %v", path, err)
+			return nil
+		}
+		w.mu.Lock()
+		w.watches[int32(wd)] = path
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) readEvents() {
+	defer close(w.events)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			default:
+				log.Printf("Failed to read inotify events: %v", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			// struct inotify_event { int wd; uint32 mask, cookie, len; char name[]; }
+			wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+nameLen]), "\x00")
+			offset = nameStart + nameLen
+
+			if mask&syscall.IN_Q_OVERFLOW != 0 {
+				// Events were lost, rescan everything
+				if !w.emit(w.root) {
+					return
+				}
+				continue
+			}
+
+			w.mu.Lock()
+			dir, ok := w.watches[wd]
+			if mask&syscall.IN_IGNORED != 0 {
+				delete(w.watches, wd)
+			}
+			w.mu.Unlock()
+			if !ok || name == "" {
+				continue
+			}
+
+			path := filepath.Join(dir, name)
+			if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				if err := w.addTree(path); err != nil {
+					log.Printf("Failed to watch %s: %v", path, err)
+				}
+			}
+			if !w.emit(path) {
+				return
+			}
+		}
+	}
+}
+
+func (w *inotifyWatcher) emit(path string) bool {
+	select {
+	case w.events <- path:
+		return true
+	case <-w.done:
+		return false
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package app
+
+import "time"
+
+func newFSWatcher(root string, interval time.Duration) (fsWatcher, error) {
+	return newPollWatcher(root, interval)
+}
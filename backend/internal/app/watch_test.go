@@ -0,0 +1,121 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCompactPaths(t *testing.T) {
+	p := func(parts ...string) string {
+		return filepath.Join(append([]string{string(filepath.Separator) + "docs"}, parts...)...)
+	}
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{"single file", []string{p("a.md")}, []string{p("a.md")}},
+		{"sorted", []string{p("b.md"), p("a.md")}, []string{p("a.md"), p("b.md")}},
+		{"parent then child", []string{p("sub"), p("sub", "a.md")}, []string{p("sub")}},
+		{"child then parent", []string{p("sub", "a.md"), p("sub", "x", "b.md"), p("sub")}, []string{p("sub")}},
+		{"nested directories", []string{p("a", "b", "c"), p("a", "b"), p("a", "b", "c", "d.md")}, []string{p("a", "b")}},
+		{"shared name prefix", []string{p("sub"), p("sub2", "a.md"), p("sub.md")}, []string{p("sub"), p("sub.md"), p("sub2", "a.md")}},
+		{"siblings", []string{p("x", "a.md"), p("y", "b.md")}, []string{p("x", "a.md"), p("y", "b.md")}},
+		{"root", []string{p("a.md"), p(), p("sub", "b.md")}, []string{p()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := make(map[string]bool)
+			for _, path := range tt.paths {
+				set[path] = true
+			}
+			if got := compactPaths(set); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compactPaths(%q) = %q, want %q", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+// Helper to wait until the watcher has reported all of want, failing on
+// paths outside of it
+func expectWatchEvents(t *testing.T, w fsWatcher, want ...string) {
+	t.Helper()
+	missing := make(map[string]bool)
+	for _, path := range want {
+		missing[path] = true
+	}
+	timeout := time.After(5 * time.Second)
+	for len(missing) > 0 {
+		select {
+		case path, ok := <-w.Events():
+			if !ok {
+				t.Fatal("watcher stopped")
+			}
+			if !slices.Contains(want, path) {
+				t.Errorf("unexpected event for %s", path)
+			}
+			delete(missing, path)
+		case <-timeout:
+			t.Fatalf("no events for %v", missing)
+		}
+	}
+}
+
+func TestPollWatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"old.md": "old", "sub/a.md": "a", "sub/deep/b.md": "b"})
+	w, err := newPollWatcher(dir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := filepath.Join(dir, "new.md")
+	writeTestFiles(t, dir, map[string]string{"new.md": "new"})
+	expectWatchEvents(t, w, created)
+
+	writeTestFiles(t, dir, map[string]string{"old.md": "modified"})
+	expectWatchEvents(t, w, filepath.Join(dir, "old.md"))
+
+	if err := os.Remove(created); err != nil {
+		t.Fatal(err)
+	}
+	expectWatchEvents(t, w, created)
+
+	// Removing a directory reports the files that were in it
+	if err := os.RemoveAll(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	expectWatchEvents(t, w, filepath.Join(dir, "sub", "a.md"), filepath.Join(dir, "sub", "deep", "b.md"))
+
+	// Nothing changed, nothing is reported
+	select {
+	case path := <-w.Events():
+		t.Errorf("unexpected event for %s", path)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+	select {
+	case _, ok := <-w.Events():
+		if ok {
+			t.Error("event after Close()")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("events not closed after Close()")
+	}
+}
+
+func TestPollWatcherMissingRoot(t *testing.T) {
+	if _, err := newPollWatcher(filepath.Join(t.TempDir(), "missing"), time.Second); err == nil {
+		t.Error("newPollWatcher() succeeded on a missing directory")
+	}
+}
@@ -0,0 +1,431 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"minirag/internal/config"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// Name of the workspace built from -docs. Its files keep their names from
+// before workspaces existed so that existing indexes are picked up.
+const defaultWorkspaceName = "docs"
+
+// Workspace names become collection and directory names
+var workspaceNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// workspace is a named set of document directories with its own collection,
+// lexical index, metadata and indexing settings
+type workspace struct {
+	name  string
+	roots []docRoot
+	cfg   *config.Config
+	db    *chromem.DB
+
+	metadataFile string
+	dbFile       string
+	lexicalFile  string
+
+	metadata      *Metadata
+	embeddingFunc chromem.EmbeddingFunc
+	embedder      Embedder
+	embedCache    *embeddingCache
+	cacheKeys     *cacheSource
+	embedProvider string
+	chunker       Chunker
+	chunkerSig    string
+	lexical       *lexicalIndex
+	progress      *indexProgress
+
+	// Set once the first indexing pass has finished
+	initialIndexDone atomic.Bool
+	// Set while the index is rebuilt because the embedding model or the
+	// chunker changed, its vectors can't be compared to queries until then
+	rebuilding atomic.Bool
+
+	mu      sync.RWMutex // guards metadata
+	indexMu sync.Mutex   // serializes indexing passes
+}
+
+// docRoot is a source directory of a workspace. With several directories
+// the paths of their files are prefixed with the directory's base name to
+// keep them apart.
+type docRoot struct {
+	dir    string // absolute
+	prefix string
+}
+
+// Helper to reject names that can't be used for collections and
+// directories
+func checkWorkspaceName(name string) error {
+	if !workspaceNameRe.MatchString(name) {
+		return fmt.Errorf("invalid workspace name %q (letters, digits, - and _ only)", name)
+	}
+	return nil
+}
+
+// Helper to get the path of a file below the root as stored in the index
+func (r docRoot) rel(path string) (string, error) {
+	rel, err := filepath.Rel(r.dir, path)
+	if err != nil {
+		return "", err
+	}
+	if r.prefix != "" {
+		rel = filepath.Join(r.prefix, rel)
+	}
+	return rel, nil
+}
+
+func newWorkspace(cfg *config.Config, wc config.Workspace, db *chromem.DB, embedCache *embeddingCache) (*workspace, error) {
+	if err := checkWorkspaceName(wc.Name); err != nil {
+		return nil, err
+	}
+	if len(wc.Dirs) == 0 {
+		return nil, fmt.Errorf("workspace %s has no directories", wc.Name)
+	}
+
+	ws := &workspace{
+		name:       wc.Name,
+		cfg:        cfg,
+		db:         db,
+		embedCache: embedCache,
+		metadata:   &Metadata{Files: make(map[string]FileInfo), Failed: make(map[string]FailedFile)},
+		lexical:    newLexicalIndex(),
+		progress:   newIndexProgress(),
+	}
+
+	prefixes := make(map[string]string)
+	for _, dir := range wc.Dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path of %s: %w", dir, err)
+		}
+		root := docRoot{dir: abs}
+		if len(wc.Dirs) > 1 {
+			root.prefix = filepath.Base(abs)
+			if other, ok := prefixes[root.prefix]; ok {
+				return nil, fmt.Errorf("directories %s and %s of workspace %s have the same name", other, abs, wc.Name)
+			}
+			prefixes[root.prefix] = abs
+		}
+		ws.roots = append(ws.roots, root)
+	}
+
+	if wc.Name == defaultWorkspaceName {
+		ws.metadataFile = cfg.MetadataFile
+		ws.dbFile = cfg.DBFile
+		ws.lexicalFile = cfg.LexicalFile
+	} else {
+		dir := filepath.Join(cfg.DataDir, "workspaces", wc.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+		}
+		ws.metadataFile = filepath.Join(dir, "metadata.json")
+		ws.dbFile = filepath.Join(dir, "vectordb.gob")
+		ws.lexicalFile = filepath.Join(dir, "lexical.gob")
+	}
+
+	// Initialize embedder from the global settings with the workspace's
+	// overrides, chunks go through the shared on-disk cache while queries
+	// are embedded directly
+	embedCfg := *cfg
+	if wc.EmbedProvider != "" {
+		embedCfg.EmbedProvider = wc.EmbedProvider
+	}
+	if wc.EmbedModel != "" {
+		if embedCfg.EmbedProvider == ProviderOpenAI {
+			embedCfg.OpenAIEmbedModel = wc.EmbedModel
+		} else {
+			embedCfg.OllamaEmbedModel = wc.EmbedModel
+		}
+	}
+	embedder, err := NewEmbedder(&embedCfg)
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s: %w", wc.Name, err)
+	}
+	ws.embedProvider = embedCfg.EmbedProvider
+	ws.embedder = &cachedEmbedder{Embedder: embedder, provider: embedCfg.EmbedProvider, cache: embedCache, batchSize: cfg.EmbedBatchSize}
+	ws.cacheKeys = embedCache.newSource()
+	ws.embeddingFunc = embeddingFuncFor(embedder)
+
+	// Initialize chunker
+	strategy, size, overlap := cfg.Chunker, cfg.ChunkSize, cfg.ChunkOverlap
+	if wc.Chunker != "" {
+		strategy = wc.Chunker
+	}
+	if wc.ChunkSize != 0 {
+		size = wc.ChunkSize
+	}
+	if wc.ChunkOverlap != 0 {
+		overlap = wc.ChunkOverlap
+	}
+	chunker, err := NewChunker(strategy, size, overlap)
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s: %w", wc.Name, err)
+	}
+	ws.chunker = chunker
+	ws.chunkerSig = chunkerSignature(strategy, size, overlap)
+
+	return ws, nil
+}
+
+// load restores the metadata, collection and lexical index saved by a
+// previous run, starting over if the directories changed
+func (ws *workspace) load(ctx context.Context) error {
+	// Load metadata first
+	_ = ws.loadMetadata() // ignore error, may not exist
+
+	// Invalidate metadata if the directories changed
+	dataPath := ws.dataPath()
+	if ws.isLegacyDataPath(ws.metadata.DataPath) {
+		log.Printf("Updating directory of workspace %s recorded by an older version from %s to %s", ws.name, ws.metadata.DataPath, dataPath)
+		ws.metadata.DataPath = dataPath
+	}
+	needInvalidate := ws.metadata.DataPath != "" && !sameDataPath(ws.metadata.DataPath, dataPath)
+	if needInvalidate {
+		log.Printf("Directories of workspace %s changed from %s to %s, invalidating metadata and index...", ws.name, ws.metadata.DataPath, dataPath)
+		ws.metadata.Files = make(map[string]FileInfo)
+		ws.metadata.Failed = make(map[string]FailedFile)
+		ws.metadata.DataPath = dataPath
+		_ = os.Remove(ws.metadataFile)
+		_ = os.Remove(ws.dbFile)
+		_ = os.Remove(ws.lexicalFile)
+		ws.db.DeleteCollection(ws.name)
+		log.Printf("Deleted metadata and DB files")
+		// Save the new (empty) metadata with updated DataPath
+		if err := ws.saveMetadata(); err != nil {
+			return fmt.Errorf("failed to save new metadata: %w", err)
+		}
+	}
+
+	// Catch changed settings before serving, the vector dimension is
+	// checked once indexing has asked the model
+	changes, err := ws.indexSettingChanges(0)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		if !ws.cfg.AutoReindex && !ws.cfg.ForceReindex {
+			return ws.settingsMismatchError(changes)
+		}
+		log.Printf("Index settings of workspace %s changed (%s), vector search is disabled until it's rebuilt", ws.name, strings.Join(changes, ", "))
+		ws.rebuilding.Store(true)
+	}
+
+	// Load existing DB if it exists
+	if _, err := os.Stat(ws.dbFile); err == nil {
+		log.Printf("Found existing DB file, loading...")
+		if err := ws.loadDB(); err != nil {
+			return fmt.Errorf("failed to load vector database: %w", err)
+		}
+
+		log.Printf("Successfully restored collection with %d documents", len(ws.metadata.Files))
+		if coll := ws.db.GetCollection(ws.name, ws.embeddingFunc); coll != nil {
+			ws.loadCacheKeys(ctx, coll)
+		}
+
+		// Load the lexical index, rebuilding it if it's missing
+		if err := ws.lexical.LoadFromFile(ws.lexicalFile); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to load lexical index: %v", err)
+		}
+		if coll := ws.db.GetCollection(ws.name, ws.embeddingFunc); coll != nil && coll.Count() > 0 && ws.lexical.Count() == 0 {
+			log.Printf("Lexical index is empty, rebuilding from the collection...")
+			ws.rebuildLexicalIndex(ctx, coll)
+		}
+	} else {
+		log.Printf("No existing DB file found for workspace %s, starting fresh", ws.name)
+		// Create initial collection if no DB exists
+		if _, err := ws.db.CreateCollection(ws.name, map[string]string{}, ws.embeddingFunc); err != nil {
+			return fmt.Errorf("failed to create initial collection: %w", err)
+		}
+	}
+	return nil
+}
+
+// Helper to identify the directories the index was built from
+func (ws *workspace) dataPath() string {
+	dirs := make([]string, len(ws.roots))
+	for i, root := range ws.roots {
+		dirs[i] = root.dir
+	}
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
+
+// Helper to compare recorded directory lists, which may have been written
+// with relative or unclean paths
+func sameDataPath(a, b string) bool {
+	as, bs := filepath.SplitList(a), filepath.SplitList(b)
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		x, errX := filepath.Abs(as[i])
+		y, errY := filepath.Abs(bs[i])
+		if errX != nil || errY != nil || x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// Helper to recognize the data directory, which versions before the docs
+// directory was tracked recorded as the data path of the default workspace
+func (ws *workspace) isLegacyDataPath(recorded string) bool {
+	if ws.name != defaultWorkspaceName || recorded == "" || ws.cfg.DataDir == "" {
+		return false
+	}
+	return sameDataPath(recorded, ws.cfg.DataDir) && !sameDataPath(recorded, ws.dataPath())
+}
+
+// Helper to find the source directory a path lies in
+func (ws *workspace) rootOf(path string) (docRoot, bool) {
+	for _, root := range ws.roots {
+		if path == root.dir || strings.HasPrefix(path, root.dir+string(filepath.Separator)) {
+			return root, true
+		}
+	}
+	return docRoot{}, false
+}
+
+// Helper to tell whether answers may be missing documents because the
+// index is still being built or updated
+func (ws *workspace) indexingInProgress() bool {
+	return !ws.initialIndexDone.Load() || ws.progress.Status().Running
+}
+
+func (ws *workspace) loadMetadata() error {
+	f, err := os.Open(ws.metadataFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&ws.metadata); err != nil {
+		return err
+	}
+	if ws.metadata.Failed == nil {
+		ws.metadata.Failed = make(map[string]FailedFile)
+	}
+	return nil
+}
+
+func (ws *workspace) saveMetadata() error {
+	f, err := os.Create(ws.metadataFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	return json.NewEncoder(f).Encode(ws.metadata)
+}
+
+func (ws *workspace) loadDB() error {
+	log.Printf("Loading vector database from: %s", ws.dbFile)
+	err := ws.db.ImportFromFile(ws.dbFile, "", ws.name)
+	if err != nil {
+		return fmt.Errorf("failed to import DB: %w", err)
+	}
+
+	// Проверяем состояние после загрузки
+	coll := ws.db.GetCollection(ws.name, ws.embeddingFunc)
+	if coll == nil {
+		log.Printf("Warning: Collection '%s' not found after DB load", ws.name)
+	} else {
+		log.Printf("Successfully loaded vector database and found '%s' collection", ws.name)
+	}
+
+	return nil
+}
+
+// saveDB exports only the workspace's own collection
+func (ws *workspace) saveDB() error {
+	return ws.db.ExportToFile(ws.dbFile, true, "", ws.name)
+}
+
+// Helper to look up the workspace named in a request, "" selects the
+// default one
+func (a *App) workspaceFor(name string) (*workspace, error) {
+	if name == "" {
+		return a.workspaces[0], nil
+	}
+	for _, ws := range a.workspaces {
+		if ws.name == name {
+			return ws, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown workspace %q", name)
+}
+
+// WorkspaceInfo describes a workspace on /workspaces
+type WorkspaceInfo struct {
+	Name       string   `json:"name"`
+	Default    bool     `json:"default"`
+	Dirs       []string `json:"dirs"`
+	Chunker    string   `json:"chunker"`
+	EmbedModel string   `json:"embed_model"`
+	Files      int      `json:"files"`
+	Chunks     int      `json:"chunks"`
+	Failed     int      `json:"failed"`
+	Indexing   bool     `json:"indexing"`
+	Rebuilding bool     `json:"rebuilding"`
+}
+
+// handleWorkspaces implements GET /workspaces
+func (a *App) handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	infos := make([]WorkspaceInfo, 0, len(a.workspaces))
+	for i, ws := range a.workspaces {
+		info := WorkspaceInfo{
+			Name:       ws.name,
+			Default:    i == 0,
+			Chunker:    ws.chunkerSig,
+			EmbedModel: ws.embedModelID(),
+			Indexing:   ws.indexingInProgress(),
+			Rebuilding: ws.rebuilding.Load(),
+		}
+		for _, root := range ws.roots {
+			info.Dirs = append(info.Dirs, root.dir)
+		}
+		ws.mu.RLock()
+		info.Files = len(ws.metadata.Files)
+		info.Failed = len(ws.metadata.Failed)
+		for _, fi := range ws.metadata.Files {
+			info.Chunks += fi.Chunks
+		}
+		ws.mu.RUnlock()
+		infos = append(infos, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+// Helper to pick the workspace from the ?workspace= parameter, writing an
+// error response if it doesn't exist
+func (a *App) workspaceParam(w http.ResponseWriter, r *http.Request) (*workspace, bool) {
+	ws, err := a.workspaceFor(r.URL.Query().Get("workspace"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return ws, true
+}
@@ -0,0 +1,215 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"minirag/internal/config"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// testConfig returns a config keeping all data in a temporary directory,
+// with the defaults of the command line flags
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dataDir := t.TempDir()
+	return &config.Config{
+		DocsDir:          filepath.Join(dataDir, "docs"),
+		DataDir:          dataDir,
+		OllamaURL:        "http://127.0.0.1:1",
+		OllamaModel:      "chat-model",
+		OllamaEmbedModel: "embed-model",
+		ChatProvider:     ProviderOllama,
+		EmbedProvider:    ProviderOllama,
+		EmbedBatchSize:   32,
+		IndexWorkers:     2,
+		EmbedWorkers:     2,
+		EmbedCacheFile:   filepath.Join(dataDir, "embeddings.gob"),
+		MetadataFile:     filepath.Join(dataDir, "metadata.json"),
+		DBFile:           filepath.Join(dataDir, "vectordb.gob"),
+		LexicalFile:      filepath.Join(dataDir, "lexical.gob"),
+		SessionsDir:      filepath.Join(dataDir, "sessions"),
+		AutoReindex:      true,
+		Chunker:          "paragraph",
+		ChunkSize:        500,
+		ChunkOverlap:     50,
+		ContextTokens:    4096,
+		RetrievalMode:    RetrievalHybrid,
+	}
+}
+
+// newTestWorkspace creates a workspace on the given database, indexing the
+// directories given or a new temporary one
+func newTestWorkspace(t *testing.T, cfg *config.Config, db *chromem.DB, name string, dirs ...string) *workspace {
+	t.Helper()
+	if len(dirs) == 0 {
+		dirs = []string{t.TempDir()}
+	}
+	cache, err := newEmbeddingCache(cfg.EmbedCacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := newWorkspace(cfg, config.Workspace{Name: name, Dirs: dirs}, db, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func TestSameDataPath(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sep := string(os.PathListSeparator)
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"/data/docs", "/data/docs", true},
+		{"/data/docs/", "/data/docs", true},
+		{"/data/./other/../docs", "/data/docs", true},
+		{"docs", filepath.Join(wd, "docs"), true},
+		{"/data/a" + sep + "/data/b", "/data/a/" + sep + "/data/b", true},
+		{"/data/a" + sep + "/data/b", "/data/b" + sep + "/data/a", false},
+		{"/data/a" + sep + "/data/b", "/data/a", false},
+		{"/data/docs", "/data/docs2", false},
+	}
+	for _, tt := range tests {
+		if got := sameDataPath(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameDataPath(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestIsLegacyDataPath(t *testing.T) {
+	cfg := testConfig(t)
+	docsDir := t.TempDir()
+	db := chromem.NewDB()
+	def := newTestWorkspace(t, cfg, db, defaultWorkspaceName, docsDir)
+	other := newTestWorkspace(t, cfg, db, "other", docsDir)
+
+	tests := []struct {
+		name     string
+		ws       *workspace
+		recorded string
+		want     bool
+	}{
+		{"data directory", def, cfg.DataDir, true},
+		{"unclean data directory", def, cfg.DataDir + "/.", true},
+		{"docs directory", def, docsDir, false},
+		{"nothing recorded", def, "", false},
+		{"another directory", def, t.TempDir(), false},
+		{"named workspace", other, cfg.DataDir, false},
+	}
+	for _, tt := range tests {
+		if got := tt.ws.isLegacyDataPath(tt.recorded); got != tt.want {
+			t.Errorf("%s: isLegacyDataPath(%q) = %v, want %v", tt.name, tt.recorded, got, tt.want)
+		}
+	}
+
+	// Docs kept in the data directory itself aren't mistaken for an old
+	// recording
+	inData := newTestWorkspace(t, cfg, db, defaultWorkspaceName, cfg.DataDir)
+	if inData.isLegacyDataPath(cfg.DataDir) {
+		t.Error("isLegacyDataPath() = true for docs in the data directory")
+	}
+}
+
+func TestNewAppWorkspaceNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		wantErr string
+	}{
+		{"valid", []string{"docs", "notes", "team_2-a"}, ""},
+		{"empty name", []string{""}, "invalid workspace name"},
+		{"empty name after a valid one", []string{"docs", ""}, "invalid workspace name"},
+		{"path in the name", []string{"../docs"}, "invalid workspace name"},
+		{"too long", []string{strings.Repeat("a", 65)}, "invalid workspace name"},
+		{"duplicate", []string{"notes", "docs", "notes"}, "duplicate workspace notes"},
+		{"names differing in case", []string{"Notes", "notes"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			for _, name := range tt.names {
+				cfg.Workspaces = append(cfg.Workspaces, config.Workspace{Name: name, Dirs: []string{t.TempDir()}})
+			}
+			app, err := NewApp(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewApp() error = %v", err)
+				}
+				if len(app.workspaces) != len(tt.names) {
+					t.Errorf("NewApp() created %d workspaces, want %d", len(app.workspaces), len(tt.names))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewApp() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWorkspaceFiles(t *testing.T) {
+	cfg := testConfig(t)
+	db := chromem.NewDB()
+	def := newTestWorkspace(t, cfg, db, defaultWorkspaceName)
+	other := newTestWorkspace(t, cfg, db, "other")
+
+	if def.metadataFile != cfg.MetadataFile || def.dbFile != cfg.DBFile || def.lexicalFile != cfg.LexicalFile {
+		t.Errorf("default workspace files = %s, %s, %s", def.metadataFile, def.dbFile, def.lexicalFile)
+	}
+	dir := filepath.Join(cfg.DataDir, "workspaces", "other")
+	if filepath.Dir(other.metadataFile) != dir || filepath.Dir(other.dbFile) != dir || filepath.Dir(other.lexicalFile) != dir {
+		t.Errorf("workspace files = %s, %s, %s, want them in %s", other.metadataFile, other.dbFile, other.lexicalFile, dir)
+	}
+}
+
+func TestWorkspaceCollectionIsolation(t *testing.T) {
+	cfg := testConfig(t)
+	ctx := context.Background()
+	db := chromem.NewDB()
+	workspaces := []*workspace{newTestWorkspace(t, cfg, db, "a"), newTestWorkspace(t, cfg, db, "b")}
+	for _, ws := range workspaces {
+		if err := ws.load(ctx); err != nil {
+			t.Fatal(err)
+		}
+		coll := db.GetCollection(ws.name, ws.embeddingFunc)
+		doc := chromem.Document{ID: ws.name + ".md#chunk-0", Content: "text of " + ws.name, Embedding: []float32{1, 0}}
+		if err := coll.AddDocument(ctx, doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := ws.saveDB(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each workspace restores only its own collection, even into a
+	// database another workspace has already loaded into
+	restored := chromem.NewDB()
+	for i, ws := range workspaces {
+		ws.db = restored
+		if err := ws.loadDB(); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(restored.ListCollections()); got != i+1 {
+			t.Errorf("after loading %s the database has %d collections, want %d", ws.name, got, i+1)
+		}
+	}
+	for _, ws := range workspaces {
+		coll := restored.GetCollection(ws.name, ws.embeddingFunc)
+		if coll == nil || coll.Count() != 1 {
+			t.Fatalf("collection %s not restored with one document", ws.name)
+		}
+		if _, err := coll.GetByID(ctx, ws.name+".md#chunk-0"); err != nil {
+			t.Errorf("collection %s: %v", ws.name, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNode is an element of a parsed XML document. Text nodes have an empty
+// name and their content in Text.
+type xmlNode struct {
+	Name     xml.Name
+	Attr     []xml.Attr
+	Children []*xmlNode
+	Text     string
+}
+
+// parseXML reads a whole XML document into a tree. Element and attribute
+// names carry their namespace URI, not the prefix.
+func parseXML(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = xmlCharsetReader
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Name: t.Name, Attr: t.Attr}
+			parent.Children = append(parent.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.Children = append(parent.Children, &xmlNode{Text: string(t)})
+		}
+	}
+	return root, nil
+}
+
+// xmlCharsetReader decodes the 8-bit encodings still found in older XML
+// files, e.g. FictionBook. Latin-1 is read as its superset cp1252.
+func xmlCharsetReader(label string, input io.Reader) (io.Reader, error) {
+	var decode func([]byte) []rune
+	switch strings.ToLower(label) {
+	case "windows-1252", "cp1252", "iso-8859-1", "latin1", "us-ascii":
+		decode = decodeCp1252
+	case "windows-1251", "cp1251":
+		decode = decodeCp1251
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", label)
+	}
+	b, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(string(decode(b))), nil
+}
+
+// Characters of the upper half of cp1251, mostly Cyrillic
+var cp1251High = [64]rune{
+	'Ђ', 'Ѓ', '‚', 'ѓ', '„', '…', '†', '‡', '€', '‰', 'Љ', '‹', 'Њ', 'Ќ', 'Ћ', 'Џ',
+	'ђ', '‘', '’', '“', '”', '•', '–', '—', 0x98, '™', 'љ', '›', 'њ', 'ќ', 'ћ', 'џ',
+	0xA0, 'Ў', 'ў', 'Ј', '¤', 'Ґ', '¦', '§', 'Ё', '©', 'Є', '«', '¬', 0xAD, '®', 'Ї',
+	'°', '±', 'І', 'і', 'ґ', 'µ', '¶', '·', 'ё', '№', 'є', '»', 'ј', 'Ѕ', 'ѕ', 'ї',
+}
+
+func decodeCp1251(b []byte) []rune {
+	out := make([]rune, len(b))
+	for i, c := range b {
+		switch {
+		case c >= 0xC0:
+			out[i] = 'А' + rune(c-0xC0)
+		case c >= 0x80:
+			out[i] = cp1251High[c-0x80]
+		default:
+			out[i] = rune(c)
+		}
+	}
+	return out
+}
+
+// is reports whether n is the element local in namespace space
+func (n *xmlNode) is(space, local string) bool {
+	return n.Name.Local == local && n.Name.Space == space
+}
+
+// attr returns the value of an attribute, "" if it's not set
+func (n *xmlNode) attr(space, local string) string {
+	for _, a := range n.Attr {
+		if a.Name.Local == local && a.Name.Space == space {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// find returns the first element below n, in document order
+func (n *xmlNode) find(space, local string) *xmlNode {
+	for _, c := range n.Children {
+		if c.is(space, local) {
+			return c
+		}
+		if found := c.find(space, local); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns the elements below n, without looking inside matches
+func (n *xmlNode) findAll(space, local string) []*xmlNode {
+	var found []*xmlNode
+	for _, c := range n.Children {
+		if c.is(space, local) {
+			found = append(found, c)
+		} else {
+			found = append(found, c.findAll(space, local)...)
+		}
+	}
+	return found
+}
+
+// text returns all character data below n
+func (n *xmlNode) text() string {
+	if n.Name.Local == "" {
+		return n.Text
+	}
+	var sb strings.Builder
+	for _, c := range n.Children {
+		sb.WriteString(c.text())
+	}
+	return sb.String()
+}
+
+// Parts of zip-based documents are read fully into memory, larger ones are
+// refused
+const maxZipPartSize = 256 << 20
+
+// Helper to read a file from a zip archive
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, maxZipPartSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(b) > maxZipPartSize {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+	return b, nil
+}
+
+// Helper to read and parse an XML file from a zip archive
+func readZipXML(zr *zip.Reader, name string) (*xmlNode, error) {
+	b, err := readZipFile(zr, name)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseXML(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return root, nil
+}
@@ -1,14 +1,127 @@
 package config
 
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
 type Config struct {
 	DocsDir          string
 	DataDir          string
 	OllamaURL        string
 	OllamaModel      string
 	OllamaEmbedModel string
+	ChatProvider     string
+	OpenAIURL        string
+	OpenAIAPIKey     string
+	OpenAIModel      string
+	EmbedProvider    string
+	OpenAIEmbedModel string
+	EmbedBatchSize   int
+	IndexWorkers     int
+	EmbedWorkers     int
+	EmbedCacheFile   string
 	Port             int
+	HTTPAddr         string
 	MetadataFile     string
 	DBFile           string
+	LexicalFile      string
+	SessionsDir      string
 	DevMode          bool
 	ForceReindex     bool
+	AutoReindex      bool
+	Watch            bool
+	WatchInterval    time.Duration
+	Chunker          string
+	ChunkSize        int
+	ChunkOverlap     int
+	ContextTokens    int
+	RetrievalMode    string
+	// Workspaces from -workspaces; when empty, DocsDir is indexed as the
+	// single workspace "docs"
+	Workspaces []Workspace
+}
+
+// Parse defines the command line flags on fs and parses args into a
+// Config. getenv supplies the defaults taken from the environment.
+func Parse(fs *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+	cfg := &Config{}
+
+	fs.StringVar(&cfg.DocsDir, "docs", "./docs", "Directory containing documents to index")
+	fs.StringVar(&cfg.DataDir, "data", "", "Directory for storing index and metadata")
+	fs.StringVar(&cfg.OllamaURL, "ollama-url", "http://127.0.0.1:11434", "Ollama API URL")
+	fs.StringVar(&cfg.OllamaModel, "ollama-model", "gemma3:12b", "Ollama model name for chat")
+	fs.StringVar(&cfg.OllamaEmbedModel, "ollama-embed-model", "nomic-embed-text:latest", "Ollama model name for embeddings")
+	fs.StringVar(&cfg.ChatProvider, "llm-provider", "ollama", "Chat model provider: ollama or openai (any OpenAI-compatible server)")
+	fs.StringVar(&cfg.OpenAIURL, "openai-url", "http://127.0.0.1:8080/v1", "Base URL of the OpenAI-compatible server, including /v1")
+	fs.StringVar(&cfg.OpenAIAPIKey, "openai-api-key", getenv("OPENAI_API_KEY"), "API key for the OpenAI-compatible server (default: $OPENAI_API_KEY)")
+	fs.StringVar(&cfg.OpenAIModel, "openai-model", "", "Chat model name on the OpenAI-compatible server")
+	fs.StringVar(&cfg.EmbedProvider, "embed-provider", "ollama", "Embedding provider: ollama or openai (any OpenAI-compatible server)")
+	fs.StringVar(&cfg.OpenAIEmbedModel, "openai-embed-model", "", "Embedding model name on the OpenAI-compatible server")
+	fs.IntVar(&cfg.EmbedBatchSize, "embed-batch-size", 32, "Number of chunks embedded per request")
+	fs.IntVar(&cfg.IndexWorkers, "index-workers", runtime.NumCPU(), "Number of files extracted and chunked in parallel while indexing")
+	fs.IntVar(&cfg.EmbedWorkers, "embed-workers", 2, "Number of concurrent embedding requests while indexing")
+	fs.StringVar(&cfg.HTTPAddr, "http", ":7492", "HTTP listen address (e.g. ':7492' or '0.0.0.0:7492')")
+	fs.BoolVar(&cfg.DevMode, "dev", false, "Run in development mode")
+	fs.BoolVar(&cfg.ForceReindex, "force-reindex", false, "Force reindexing of all documents, ignoring saved state")
+	fs.BoolVar(&cfg.AutoReindex, "auto-reindex", true, "Rebuild the index when the embedding model or chunker settings changed; if false, refuse to start instead")
+	fs.BoolVar(&cfg.Watch, "watch", false, "Watch the docs directory and reindex changed files while running")
+	fs.DurationVar(&cfg.WatchInterval, "watch-interval", 5*time.Second, "Polling interval for the watcher on platforms without inotify")
+	fs.StringVar(&cfg.Chunker, "chunker", "paragraph", "Chunking strategy: fixed, paragraph or markdown")
+	fs.IntVar(&cfg.ChunkSize, "chunk-size", 500, "Maximum chunk size in tokens (estimated)")
+	fs.IntVar(&cfg.ChunkOverlap, "chunk-overlap", 50, "Number of tokens repeated from the previous chunk")
+	fs.IntVar(&cfg.ContextTokens, "context-tokens", 4096, "Token budget for retrieved document context in the chat prompt")
+	fs.StringVar(&cfg.RetrievalMode, "retrieval", "hybrid", "Default retrieval mode: vector, lexical or hybrid")
+	workspacesFile := fs.String("workspaces", "", "JSON file defining named workspaces with their own directories and settings (replaces -docs)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *workspacesFile != "" {
+		workspaces, err := LoadWorkspaces(*workspacesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load workspaces: %w", err)
+		}
+		cfg.Workspaces = workspaces
+	}
+	return cfg, nil
+}
+
+// Workspace is a named set of document directories indexed into a
+// collection of its own. Settings left empty fall back to the global flags.
+type Workspace struct {
+	Name          string   `json:"name"`
+	Dirs          []string `json:"dirs"`
+	Chunker       string   `json:"chunker,omitempty"`
+	ChunkSize     int      `json:"chunk_size,omitempty"`
+	ChunkOverlap  int      `json:"chunk_overlap,omitempty"`
+	EmbedProvider string   `json:"embed_provider,omitempty"`
+	EmbedModel    string   `json:"embed_model,omitempty"`
+}
+
+// LoadWorkspaces reads a JSON array of workspaces. Relative directories are
+// resolved against the directory of the file.
+func LoadWorkspaces(path string) ([]Workspace, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var workspaces []Workspace
+	if err := json.Unmarshal(b, &workspaces); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	base := filepath.Dir(path)
+	for i := range workspaces {
+		for j, dir := range workspaces[i].Dirs {
+			if !filepath.IsAbs(dir) {
+				workspaces[i].Dirs[j] = filepath.Join(base, dir)
+			}
+		}
+	}
+	return workspaces, nil
 }
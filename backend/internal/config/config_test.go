@@ -0,0 +1,157 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper to parse args with the given environment
+func parse(args []string, env map[string]string) (*Config, error) {
+	fs := flag.NewFlagSet("minirag", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Parse(fs, args, func(key string) string { return env[key] })
+}
+
+func TestParseDefaults(t *testing.T) {
+	cfg, err := parse(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		DocsDir:          "./docs",
+		OllamaURL:        "http://127.0.0.1:11434",
+		OllamaModel:      "gemma3:12b",
+		OllamaEmbedModel: "nomic-embed-text:latest",
+		ChatProvider:     "ollama",
+		OpenAIURL:        "http://127.0.0.1:8080/v1",
+		EmbedProvider:    "ollama",
+		EmbedBatchSize:   32,
+		IndexWorkers:     runtime.NumCPU(),
+		EmbedWorkers:     2,
+		HTTPAddr:         ":7492",
+		AutoReindex:      true,
+		WatchInterval:    5 * time.Second,
+		Chunker:          "paragraph",
+		ChunkSize:        500,
+		ChunkOverlap:     50,
+		ContextTokens:    4096,
+		RetrievalMode:    "hybrid",
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Parse() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	cfg, err := parse([]string{
+		"-docs", "/srv/docs", "-llm-provider", "openai", "-openai-model", "qwen",
+		"-embed-workers", "4", "-auto-reindex=false", "-watch", "-watch-interval", "1m",
+		"-chunker", "markdown", "-http", "127.0.0.1:9000",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DocsDir != "/srv/docs" || cfg.ChatProvider != "openai" || cfg.OpenAIModel != "qwen" ||
+		cfg.EmbedWorkers != 4 || cfg.AutoReindex || !cfg.Watch || cfg.WatchInterval != time.Minute ||
+		cfg.Chunker != "markdown" || cfg.HTTPAddr != "127.0.0.1:9000" {
+		t.Errorf("Parse() = %+v", cfg)
+	}
+
+	for _, args := range [][]string{{"-chunk-size", "big"}, {"-unknown"}, {"-watch-interval", "5"}} {
+		if _, err := parse(args, nil); err == nil {
+			t.Errorf("Parse(%q) succeeded", args)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	env := map[string]string{"OPENAI_API_KEY": "sk-env"}
+	cfg, err := parse(nil, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OpenAIAPIKey != "sk-env" {
+		t.Errorf("OpenAIAPIKey = %q, want the key from the environment", cfg.OpenAIAPIKey)
+	}
+
+	// The flag wins over the environment
+	cfg, err = parse([]string{"-openai-api-key", "sk-flag"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OpenAIAPIKey != "sk-flag" {
+		t.Errorf("OpenAIAPIKey = %q, want the key from the flag", cfg.OpenAIAPIKey)
+	}
+}
+
+func TestParseWorkspaces(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "workspaces.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "notes", "dirs": ["notes"]}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parse([]string{"-workspaces", path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Workspace{{Name: "notes", Dirs: []string{filepath.Join(dir, "notes")}}}
+	if !reflect.DeepEqual(cfg.Workspaces, want) {
+		t.Errorf("Workspaces = %+v, want %+v", cfg.Workspaces, want)
+	}
+
+	if _, err := parse([]string{"-workspaces", filepath.Join(dir, "missing.json")}, nil); err == nil || !strings.Contains(err.Error(), "failed to load workspaces") {
+		t.Errorf("Parse() error = %v, want a workspaces error", err)
+	}
+}
+
+func TestLoadWorkspaces(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(t.TempDir(), "shared")
+	tests := []struct {
+		name    string
+		data    string
+		want    []Workspace
+		wantErr string
+	}{
+		{"settings", `[{"name": "code", "dirs": ["src", "` + abs + `"], "chunker": "fixed", "chunk_size": 200, "chunk_overlap": 20, "embed_provider": "openai", "embed_model": "e5"}]`,
+			[]Workspace{{Name: "code", Dirs: []string{filepath.Join(dir, "src"), abs}, Chunker: "fixed", ChunkSize: 200, ChunkOverlap: 20, EmbedProvider: "openai", EmbedModel: "e5"}}, ""},
+		{"several", `[{"name": "a", "dirs": ["a"]}, {"name": "b"}]`,
+			[]Workspace{{Name: "a", Dirs: []string{filepath.Join(dir, "a")}}, {Name: "b"}}, ""},
+		{"empty", `[]`, []Workspace{}, ""},
+		{"invalid JSON", `[{"name": "a",}]`, nil, "failed to parse"},
+		{"not an array", `{"name": "a"}`, nil, "failed to parse"},
+		{"wrong type", `[{"name": "a", "chunk_size": "big"}]`, nil, "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "workspaces.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadWorkspaces(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), path) {
+					t.Errorf("LoadWorkspaces() error = %v, want %q with the path", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadWorkspaces() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadWorkspaces(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("LoadWorkspaces() of a missing file = %v", err)
+	}
+}